@@ -0,0 +1,88 @@
+package Auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Josiah-B/Cyclone/Interfaces"
+)
+
+// TokenAuthenticator finds the token an API key belongs to; it is implemented by Interfaces.Storage
+type TokenAuthenticator interface {
+	AuthenticateToken(key string) (*Interfaces.APIToken, error)
+}
+
+// Guard checks the API token of each request against the scope the route needs
+type Guard struct {
+	Tokens TokenAuthenticator
+	// AnonymousRead lets requests without a key use the routes that only need Interfaces.ScopeRead
+	AnonymousRead bool
+	// WriteError sends the error to the client in the router's error format
+	WriteError func(http.ResponseWriter, error)
+}
+
+type contextKey int
+
+const tokenContextKey contextKey = 0
+
+// Require wraps 'next' so it is only called for requests with a token that has 'scope'. The token is added to the request's context.
+func (guard *Guard) Require(scope string, next http.HandlerFunc) http.HandlerFunc {
+	if scope == Interfaces.ScopePublic {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := RequestKey(r)
+		if key == "" && scope == Interfaces.ScopeRead && guard.AnonymousRead {
+			next(w, r)
+			return
+		}
+
+		token, err := guard.authenticate(key)
+		if err == nil && !token.Allows(scope, "") {
+			err = fmt.Errorf("%w: the token '%v' does not have the '%v' scope", Interfaces.ErrForbidden, token.Name, scope)
+		}
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			guard.WriteError(w, err)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), tokenContextKey, token)))
+	}
+}
+
+func (guard *Guard) authenticate(key string) (*Interfaces.APIToken, error) {
+	if key == "" {
+		return nil, fmt.Errorf("%w: an API key is required; send it as 'Authorization: Bearer <key>'", Interfaces.ErrUnauthorized)
+	}
+	return guard.Tokens.AuthenticateToken(key)
+}
+
+// RequestKey returns the API key sent with the request, from the Authorization or X-API-Key header or the 'apiKey' parameter.
+// The parameter is for clients, such as browsers opening an EventSource or WebSocket, that can not set headers.
+func RequestKey(r *http.Request) string {
+	if authorization := r.Header.Get("Authorization"); len(authorization) > 7 && strings.EqualFold(authorization[:7], "Bearer ") {
+		return strings.TrimSpace(authorization[7:])
+	}
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	return r.URL.Query().Get("apiKey")
+}
+
+// TokenFromContext returns the token that authenticated the request, or nil if the request was allowed without one
+func TokenFromContext(ctx context.Context) *Interfaces.APIToken {
+	token, _ := ctx.Value(tokenContextKey).(*Interfaces.APIToken)
+	return token
+}
+
+// CheckStation returns Interfaces.ErrForbidden unless the request's token allows 'scope' for the station 'stationName'
+func CheckStation(r *http.Request, scope string, stationName string) error {
+	token := TokenFromContext(r.Context())
+	if token == nil || !token.Allows(scope, stationName) {
+		return fmt.Errorf("%w: the API key is not allowed to %v for station '%v'", Interfaces.ErrForbidden, scope, stationName)
+	}
+	return nil
+}
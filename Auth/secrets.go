@@ -0,0 +1,69 @@
+/*
+	Auth holds the credential handling shared by the storage layer and the HTTP routers
+*/
+package Auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// saltLength is the number of random bytes mixed into every key hash
+const saltLength = 16
+
+// HashSecret returns a bcrypt hash of 'secret' that is safe to store. It is slow on purpose, so use it for passwords chosen by people.
+func HashSecret(secret string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+// VerifySecret returns true if 'secret' matches the hash created by HashSecret.
+// Hashes stored before passwords were hashed with bcrypt, of the form "salt$hash", are still accepted.
+func VerifySecret(secret string, hashed string) bool {
+	if !NeedsRehash(hashed) {
+		return bcrypt.CompareHashAndPassword([]byte(hashed), []byte(secret)) == nil
+	}
+	return VerifyKey(secret, hashed)
+}
+
+// NeedsRehash returns true if the hash was not created by HashSecret and should be replaced the next time the secret is verified
+func NeedsRehash(hashed string) bool {
+	_, err := bcrypt.Cost([]byte(hashed))
+	return err != nil
+}
+
+// HashKey returns a salted SHA-256 hash of an API key's secret, of the form "salt$hash" with both hex encoded.
+// It is fast enough to check on every request, which is only safe because the secrets are long and random; use HashSecret for passwords.
+func HashKey(secret string) (string, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(salt) + "$" + hashWithSalt(salt, secret), nil
+}
+
+// VerifyKey returns true if 'secret' matches the hash created by HashKey
+func VerifyKey(secret string, hashed string) bool {
+	parts := strings.SplitN(hashed, "$", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	salt, err := hex.DecodeString(parts[0])
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashWithSalt(salt, secret)), []byte(parts[1])) == 1
+}
+
+func hashWithSalt(salt []byte, secret string) string {
+	sum := sha256.Sum256(append(append([]byte(nil), salt...), secret...))
+	return hex.EncodeToString(sum[:])
+}
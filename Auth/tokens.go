@@ -0,0 +1,42 @@
+package Auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// keyPrefix starts every API key so they are easy to recognise, e.g. in a config file or a leaked log
+const keyPrefix = "cyc"
+
+// lengths, in random bytes, of the two parts of an API key
+const (
+	keyIDLength     = 6
+	keySecretLength = 24
+)
+
+// GenerateKey creates a new API key of the form "cyc_<id>_<secret>". The id is stored as is to find the token the key belongs to;
+// only a hash of the secret is stored.
+func GenerateKey() (key string, id string, secret string, err error) {
+	idBytes := make([]byte, keyIDLength)
+	secretBytes := make([]byte, keySecretLength)
+	if _, err = rand.Read(idBytes); err != nil {
+		return "", "", "", err
+	}
+	if _, err = rand.Read(secretBytes); err != nil {
+		return "", "", "", err
+	}
+
+	id = hex.EncodeToString(idBytes)
+	secret = hex.EncodeToString(secretBytes)
+	return keyPrefix + "_" + id + "_" + secret, id, secret, nil
+}
+
+// ParseKey splits an API key created by GenerateKey into its id and secret
+func ParseKey(key string) (id string, secret string, ok bool) {
+	parts := strings.Split(key, "_")
+	if len(parts) != 3 || parts[0] != keyPrefix || parts[1] == "" || parts[2] == "" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
@@ -0,0 +1,96 @@
+package ConfigAPI
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Josiah-B/Cyclone/Interfaces"
+	"github.com/gorilla/mux"
+)
+
+// streamKeepAlive is how often an idle stream is sent something so proxies and clients do not time it out
+const streamKeepAlive = 30 * time.Second
+
+// parseLineCount reads the 'lines' parameter, returning 'defaultCount' if it is not set
+func parseLineCount(r *http.Request, defaultCount int) (int, error) {
+	lines := r.URL.Query().Get("lines")
+	if lines == "" {
+		return defaultCount, nil
+	}
+	count, err := strconv.Atoi(lines)
+	if err != nil || count < 0 {
+		return 0, Interfaces.ValidationError("'lines' must be a whole number that is not negative, got '%v'", lines)
+	}
+	return count, nil
+}
+
+// GetProcessOutput returns the last lines a process wrote to stdout and stderr
+func (httpMux *HTTPMux) GetProcessOutput(webResponseWriter http.ResponseWriter, r *http.Request) {
+	processName := mux.Vars(r)["processName"]
+	count, err := parseLineCount(r, 100)
+	if err != nil {
+		writeResult(webResponseWriter, nil, err)
+		return
+	}
+
+	lines, err := httpMux.procMgr.Output(processName, count, r.URL.Query().Get("stream"))
+	writeResult(webResponseWriter, lines, err)
+}
+
+// TailProcessOutput sends the lines a process writes as Server-Sent Events as they are written
+func (httpMux *HTTPMux) TailProcessOutput(webResponseWriter http.ResponseWriter, r *http.Request) {
+	flusher, ok := webResponseWriter.(http.Flusher)
+	if !ok {
+		writeResult(webResponseWriter, nil, errors.New("streaming is not supported by this connection"))
+		return
+	}
+	processName := mux.Vars(r)["processName"]
+	backlog, err := parseLineCount(r, 10)
+	if err != nil {
+		writeResult(webResponseWriter, nil, err)
+		return
+	}
+	var lastEventID uint64
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		if lastEventID, err = strconv.ParseUint(id, 10, 64); err != nil {
+			writeResult(webResponseWriter, nil, Interfaces.ValidationError("'Last-Event-ID' must be a whole number, got '%v'", id))
+			return
+		}
+	}
+
+	tail, err := httpMux.procMgr.TailOutput(processName, backlog, lastEventID)
+	if err != nil {
+		writeResult(webResponseWriter, nil, err)
+		return
+	}
+	defer tail.Close()
+
+	webResponseWriter.Header().Set("Content-Type", "text/event-stream")
+	webResponseWriter.Header().Set("Cache-Control", "no-cache")
+	webResponseWriter.Header().Set("Connection", "keep-alive")
+	webResponseWriter.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case line, ok := <-tail.Lines:
+			if !ok {
+				// the process was stopped
+				return
+			}
+			data, _ := json.Marshal(line)
+			fmt.Fprintf(webResponseWriter, "id: %v\nevent: %v\ndata: %s\n\n", line.ID, line.Stream, data)
+		case <-keepAlive.C:
+			fmt.Fprint(webResponseWriter, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
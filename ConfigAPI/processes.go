@@ -0,0 +1,88 @@
+package ConfigAPI
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/Josiah-B/Cyclone/Interfaces"
+	"github.com/Josiah-B/Cyclone/ProcessManager"
+	"github.com/gorilla/mux"
+)
+
+// GetProcesses returns every process, ordered by name
+func (httpMux *HTTPMux) GetProcesses(webResponseWriter http.ResponseWriter, r *http.Request) {
+	writeResult(webResponseWriter, httpMux.procMgr.ListProcesses(), nil)
+}
+
+// GetProcess returns a single process
+func (httpMux *HTTPMux) GetProcess(webResponseWriter http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	status, err := httpMux.procMgr.Process(vars["processName"])
+	writeResult(webResponseWriter, status, err)
+}
+
+// CreateProcess adds a process and starts it unless it is disabled
+func (httpMux *HTTPMux) CreateProcess(webResponseWriter http.ResponseWriter, r *http.Request) {
+	var definition ProcessManager.ProcessDefinition
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &definition)
+	}
+	if err != nil {
+		writeResult(webResponseWriter, nil, Interfaces.ValidationError("the request body is not a valid process: %v", err))
+		return
+	}
+
+	status, err := httpMux.procMgr.CreateProc(definition)
+	if err != nil {
+		writeResult(webResponseWriter, nil, err)
+		return
+	}
+	objects, _ := json.MarshalIndent(status, "", "\t")
+	webResponseWriter.Header().Set("Content-Type", "application/json")
+	webResponseWriter.WriteHeader(http.StatusCreated)
+	webResponseWriter.Write(objects)
+}
+
+// RemoveProcess stops a process and forgets it, returning the process's last status
+func (httpMux *HTTPMux) RemoveProcess(webResponseWriter http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	status, err := httpMux.procMgr.Remove(vars["processName"])
+	writeResult(webResponseWriter, status, err)
+}
+
+// StartProcess starts a process that was stopped or has failed
+func (httpMux *HTTPMux) StartProcess(webResponseWriter http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	status, err := httpMux.procMgr.StartProc(vars["processName"])
+	writeResult(webResponseWriter, status, err)
+}
+
+// StopProcess stops a process without removing it
+func (httpMux *HTTPMux) StopProcess(webResponseWriter http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	status, err := httpMux.procMgr.Stop(vars["processName"])
+	writeResult(webResponseWriter, status, err)
+}
+
+// RestartProcess stops then starts a process
+func (httpMux *HTTPMux) RestartProcess(webResponseWriter http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	status, err := httpMux.procMgr.Restart(vars["processName"])
+	writeResult(webResponseWriter, status, err)
+}
+
+// EnableProcess allows a process to run and starts it
+func (httpMux *HTTPMux) EnableProcess(webResponseWriter http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	status, err := httpMux.procMgr.Enable(vars["processName"])
+	writeResult(webResponseWriter, status, err)
+}
+
+// DisableProcess stops a process and keeps it from being started
+func (httpMux *HTTPMux) DisableProcess(webResponseWriter http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	status, err := httpMux.procMgr.Disable(vars["processName"])
+	writeResult(webResponseWriter, status, err)
+}
@@ -2,18 +2,28 @@ package ConfigAPI
 
 import (
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 
-	"strconv"
-
+	"github.com/Josiah-B/Cyclone/Auth"
 	"github.com/Josiah-B/Cyclone/Interfaces"
+	"github.com/Josiah-B/Cyclone/Logger"
+	"github.com/Josiah-B/Cyclone/MQTTBridge"
 	"github.com/Josiah-B/Cyclone/ProcessManager"
+	"github.com/Josiah-B/Cyclone/Settings"
 	"github.com/gorilla/mux"
 )
 
 type HTTPMux struct {
-	Router  *mux.Router
-	procMgr *ProcessManager.ProcessMgr
+	Router     *mux.Router
+	procMgr    *ProcessManager.ProcessMgr
+	mqttBridge *MQTTBridge.Bridge
+	logger     *Logger.Logger
+	settings   Settings.Settings
+	storage    Interfaces.Storage
+	// guard checks that each request has a token with the scope its route needs
+	guard Auth.Guard
 }
 
 var (
@@ -23,37 +33,160 @@ var (
 )
 
 // Create the url mappings for the REST operations
-func (httpMux *HTTPMux) Create(processManager *ProcessManager.ProcessMgr) {
+func (httpMux *HTTPMux) Create(processManager *ProcessManager.ProcessMgr, mqttBridge *MQTTBridge.Bridge, logger *Logger.Logger, settings Settings.Settings, storage Interfaces.Storage) {
 	httpMux.procMgr = processManager
+	httpMux.mqttBridge = mqttBridge
+	httpMux.logger = logger
+	httpMux.settings = settings
+	httpMux.storage = storage
+	httpMux.guard = Auth.Guard{Tokens: storage, WriteError: func(w http.ResponseWriter, err error) { writeResult(w, nil, err) }}
 	httpMux.Router = mux.NewRouter()
 
 	//setup the api mapping
 	apiRoutes = []Interfaces.APIRoute{
+		Interfaces.APIRoute{
+			Route:         "/settings",
+			HandlerMethod: httpMux.GetSettings,
+			HTTPMethod:    "GET",
+			Description:   "Returns the settings the program is running with, after the config file, environment variables and flags are applied"},
+
 		Interfaces.APIRoute{
 			Route:         "/processes",
 			HandlerMethod: httpMux.GetProcesses,
 			HTTPMethod:    "GET",
-			Description:   "Returns a all processes"},
-
+			Description:   "Returns all processes with their status, exit codes and restart history"},
 		Interfaces.APIRoute{
-			Route:         "/process/start/{processPath}",
-			HandlerMethod: httpMux.StartProcess,
+			Route:         "/processes",
+			HandlerMethod: httpMux.CreateProcess,
+			HTTPMethod:    "POST",
+			Description:   "Creates and starts a process: {\"Name\":\"...\",\"Path\":\"...\",\"Args\":[],\"Env\":[\"KEY=value\"],\"Disabled\":false}; Path is relative to the station executable folder"},
+		Interfaces.APIRoute{
+			Route:         "/processes/{processName}",
+			HandlerMethod: httpMux.GetProcess,
 			HTTPMethod:    "GET",
-			Description:   "Starts a process"},
+			Description:   "Returns a process with its arguments, environment, PID, uptime and restarts"},
 		Interfaces.APIRoute{
-			Route:         "/process/stop/{processID}",
+			Route:         "/processes/{processName}",
+			HandlerMethod: httpMux.RemoveProcess,
+			HTTPMethod:    "DELETE",
+			Description:   "Stops a process and removes it"},
+		Interfaces.APIRoute{
+			Route:         "/processes/{processName}/start",
 			HandlerMethod: httpMux.StartProcess,
+			HTTPMethod:    "POST",
+			Description:   "Starts a process that was stopped or has failed"},
+		Interfaces.APIRoute{
+			Route:         "/processes/{processName}/stop",
+			HandlerMethod: httpMux.StopProcess,
+			HTTPMethod:    "POST",
+			Description:   "Stops a process; it is not restarted until it is started again"},
+		Interfaces.APIRoute{
+			Route:         "/processes/{processName}/restart",
+			HandlerMethod: httpMux.RestartProcess,
+			HTTPMethod:    "POST",
+			Description:   "Stops then starts a process with the same arguments"},
+		Interfaces.APIRoute{
+			Route:         "/processes/{processName}/enable",
+			HandlerMethod: httpMux.EnableProcess,
+			HTTPMethod:    "POST",
+			Description:   "Allows a disabled process to run and starts it"},
+		Interfaces.APIRoute{
+			Route:         "/processes/{processName}/disable",
+			HandlerMethod: httpMux.DisableProcess,
+			HTTPMethod:    "POST",
+			Description:   "Stops a process and keeps it from being started until it is enabled; set Disabled in the station's config file to keep it disabled when the program restarts"},
+		Interfaces.APIRoute{
+			Route:         "/processes/{processName}/output",
+			HandlerMethod: httpMux.GetProcessOutput,
+			HTTPMethod:    "GET",
+			Description:   "Returns the last lines a process wrote. Query parameters: lines (default 100), stream (stdout|stderr, default both)"},
+		Interfaces.APIRoute{
+			Route:         "/processes/{processName}/output/stream",
+			HandlerMethod: httpMux.TailProcessOutput,
+			HTTPMethod:    "GET",
+			Description:   "Streams the lines a process writes as Server-Sent Events, starting with the last 'lines' (default 10); reconnecting clients resume after their Last-Event-ID"},
+
+		Interfaces.APIRoute{
+			Route:         "/stationconfigs",
+			HandlerMethod: httpMux.GetStationConfigs,
+			HTTPMethod:    "GET",
+			Description:   "Lists the station config files with the driver each one runs"},
+		Interfaces.APIRoute{
+			Route:         "/stationconfigs/{configName}",
+			HandlerMethod: httpMux.GetStationConfig,
+			HTTPMethod:    "GET",
+			Description:   "Returns a station config file"},
+		Interfaces.APIRoute{
+			Route:         "/stationconfigs/{configName}",
+			HandlerMethod: httpMux.CreateStationConfig,
+			HTTPMethod:    "POST",
+			Description:   "Saves a new station config file, the request body, and starts its process. The config needs an ExecName and is checked against the driver's schema"},
+		Interfaces.APIRoute{
+			Route:         "/stationconfigs/{configName}",
+			HandlerMethod: httpMux.UpdateStationConfig,
+			HTTPMethod:    "PUT",
+			Description:   "Replaces a station config file with the request body and restarts its process"},
+		Interfaces.APIRoute{
+			Route:         "/stationconfigs/{configName}",
+			HandlerMethod: httpMux.DeleteStationConfig,
+			HTTPMethod:    "DELETE",
+			Description:   "Stops a station's process and deletes its config file"},
+
+		Interfaces.APIRoute{
+			Route:         "/mqtt",
+			HandlerMethod: httpMux.GetMQTTStatus,
+			HTTPMethod:    "GET",
+			Description:   "Returns the connection state of the MQTT bridge and each of its subscriptions"},
+
+		Interfaces.APIRoute{
+			Route:         "/logging",
+			HandlerMethod: httpMux.GetLoggingSettings,
 			HTTPMethod:    "GET",
-			Description:   "Stops a process"},
+			Description:   "Returns the logging settings of every station"},
+		Interfaces.APIRoute{
+			Route:         "/logging/{stationName}",
+			HandlerMethod: httpMux.GetStationLoggingSettings,
+			HTTPMethod:    "GET",
+			Description:   "Returns the logging settings of a station"},
+		Interfaces.APIRoute{
+			Route:         "/logging/{stationName}",
+			HandlerMethod: httpMux.SetStationLoggingSettings,
+			HTTPMethod:    "PUT",
+			Description:   "Saves the logging settings of a station: {\"Enabled\":true,\"Interval\":15,\"IncludeSensors\":[],\"ExcludeSensors\":[]}; an Interval of 0 uses the default interval"},
+		Interfaces.APIRoute{
+			Route:         "/logging/{stationName}",
+			HandlerMethod: httpMux.ResetStationLoggingSettings,
+			HTTPMethod:    "DELETE",
+			Description:   "Removes the saved logging settings of a station so it uses the defaults"},
+
+		Interfaces.APIRoute{
+			Route:         "/tokens",
+			HandlerMethod: httpMux.GetTokens,
+			HTTPMethod:    "GET",
+			Description:   "Returns every API token that has not been revoked; the keys themselves are not stored"},
+		Interfaces.APIRoute{
+			Route:         "/tokens",
+			HandlerMethod: httpMux.IssueToken,
+			HTTPMethod:    "POST",
+			Description:   "Issues an API token: {\"Name\":\"...\",\"Scopes\":[\"read\",\"upload\",\"admin\"],\"StationName\":\"...\"}; StationName limits an upload token to one station. The key is only returned once"},
+		Interfaces.APIRoute{
+			Route:         "/tokens/{tokenID}",
+			HandlerMethod: httpMux.RevokeToken,
+			HTTPMethod:    "DELETE",
+			Description:   "Revokes an API token"},
 	}
 
 	//fmt.Println(apiRoutes)
 
 	httpMux.Router.HandleFunc("/", httpMux.showAPIRouting)
 
-	//Setup the webserver to handle the apiRoutes
-	for _, v := range apiRoutes {
-		httpMux.Router.HandleFunc(v.Route, v.HandlerMethod).Methods(v.HTTPMethod)
+	//Setup the webserver to handle the apiRoutes; every route manages the program, so they all need ScopeAdmin
+	for i, v := range apiRoutes {
+		if v.Scope == "" {
+			v.Scope = Interfaces.ScopeAdmin
+			apiRoutes[i].Scope = v.Scope
+		}
+		httpMux.Router.HandleFunc(v.Route, httpMux.guard.Require(v.Scope, v.HandlerMethod)).Methods(v.HTTPMethod)
 	}
 
 	// webserver functions
@@ -72,24 +205,122 @@ func writeResponsePrettyfied(webResponseWriter http.ResponseWriter, obj interfac
 	webResponseWriter.Write(objects)
 }
 
-func (httpMux *HTTPMux) GetProcesses(webResponseWriter http.ResponseWriter, r *http.Request) {
+// errorResponse is the JSON body sent to the client when a request fails
+type errorResponse struct {
+	Status int
+	Error  string
+}
+
+// writeResult sends 'obj' to the client if 'err' is nil, otherwise the error is sent with the matching http status code
+func writeResult(webResponseWriter http.ResponseWriter, obj interface{}, err error) {
+	if err == nil {
+		writeResponsePrettyfied(webResponseWriter, obj, "\t")
+		return
+	}
+
+	statusCode := Interfaces.HTTPStatusCode(err)
+	if statusCode == http.StatusInternalServerError {
+		fmt.Println(err)
+	}
+	objects, _ := json.MarshalIndent(errorResponse{Status: statusCode, Error: err.Error()}, "", "\t")
 	webResponseWriter.Header().Set("Content-Type", "application/json")
-	webResponseWriter.Write(httpMux.procMgr.ListProcesses())
+	webResponseWriter.WriteHeader(statusCode)
+	webResponseWriter.Write(objects)
+}
+
+//GetSettings returns the effective settings; they are read only since they are loaded when the program starts
+func (httpMux *HTTPMux) GetSettings(webResponseWriter http.ResponseWriter, r *http.Request) {
+	writeResponsePrettyfied(webResponseWriter, httpMux.settings, "\t")
+}
+
+//GetMQTTStatus returns the state of the MQTT bridge
+func (httpMux *HTTPMux) GetMQTTStatus(webResponseWriter http.ResponseWriter, r *http.Request) {
+	writeResponsePrettyfied(webResponseWriter, httpMux.mqttBridge.Status(), "\t")
 }
 
-//StartProcess runs the specified command
-func (httpMux *HTTPMux) StartProcess(webResponseWriter http.ResponseWriter, r *http.Request) {
+//GetLoggingSettings returns the logging settings of every station
+func (httpMux *HTTPMux) GetLoggingSettings(webResponseWriter http.ResponseWriter, r *http.Request) {
+	configs, err := httpMux.logger.GetLoggingSettings()
+	writeResult(webResponseWriter, configs, err)
+}
+
+//GetStationLoggingSettings returns the logging settings of a single station
+func (httpMux *HTTPMux) GetStationLoggingSettings(webResponseWriter http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	config, err := httpMux.logger.GetStationLoggingSettings(vars["stationName"])
+	writeResult(webResponseWriter, config, err)
+}
+
+//SetStationLoggingSettings saves the logging settings of a station
+func (httpMux *HTTPMux) SetStationLoggingSettings(webResponseWriter http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	httpMux.procMgr.CreateProc(vars["processPath"])
+	var config Interfaces.LoggingConfig
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &config)
+	}
+	if err != nil {
+		writeResult(webResponseWriter, nil, Interfaces.ValidationError("the request body is not valid logging settings: %v", err))
+		return
+	}
+
+	config.StationName = vars["stationName"]
+	err = httpMux.logger.SetLoggingSettings(&config)
+	writeResult(webResponseWriter, config, err)
 }
 
-//StopProcess kills the specified process
-func (httpMux *HTTPMux) StopProcess(webResponseWriter http.ResponseWriter, r *http.Request) {
+//ResetStationLoggingSettings removes the saved logging settings of a station
+func (httpMux *HTTPMux) ResetStationLoggingSettings(webResponseWriter http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	procID, err := strconv.Atoi(vars["processID"])
+	if err := httpMux.logger.ResetLoggingSettings(vars["stationName"]); err != nil {
+		writeResult(webResponseWriter, nil, err)
+		return
+	}
+	webResponseWriter.WriteHeader(http.StatusNoContent)
+}
+
+// issuedToken is returned when a token is issued; it is the only time the key is available
+type issuedToken struct {
+	Interfaces.APIToken
+	Key string
+}
+
+//GetTokens returns every API token that has not been revoked
+func (httpMux *HTTPMux) GetTokens(webResponseWriter http.ResponseWriter, r *http.Request) {
+	tokens, err := httpMux.storage.GetAPITokens()
+	writeResult(webResponseWriter, tokens, err)
+}
+
+//IssueToken creates an API token and returns its key
+func (httpMux *HTTPMux) IssueToken(webResponseWriter http.ResponseWriter, r *http.Request) {
+	var token Interfaces.APIToken
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &token)
+	}
+	if err != nil {
+		writeResult(webResponseWriter, nil, Interfaces.ValidationError("the request body is not a valid token: %v", err))
+		return
+	}
+
+	key, err := httpMux.storage.IssueAPIToken(&token)
 	if err != nil {
-		webResponseWriter.Write([]byte("That Process ID does not exist"))
+		writeResult(webResponseWriter, nil, err)
+		return
+	}
+	objects, _ := json.MarshalIndent(issuedToken{APIToken: token, Key: key}, "", "\t")
+	webResponseWriter.Header().Set("Content-Type", "application/json")
+	webResponseWriter.Header().Set("Cache-Control", "no-store")
+	webResponseWriter.WriteHeader(http.StatusCreated)
+	webResponseWriter.Write(objects)
+}
+
+//RevokeToken deletes an API token so its key is no longer accepted
+func (httpMux *HTTPMux) RevokeToken(webResponseWriter http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := httpMux.storage.RevokeAPIToken(vars["tokenID"]); err != nil {
+		writeResult(webResponseWriter, nil, err)
 		return
 	}
-	httpMux.procMgr.Stop(procID)
+	webResponseWriter.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,63 @@
+package ConfigAPI
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/Josiah-B/Cyclone/Interfaces"
+	"github.com/gorilla/mux"
+)
+
+// GetStationConfigs lists the station config files
+func (httpMux *HTTPMux) GetStationConfigs(webResponseWriter http.ResponseWriter, r *http.Request) {
+	configs, err := httpMux.procMgr.StationConfigs()
+	writeResult(webResponseWriter, configs, err)
+}
+
+// GetStationConfig returns a station config file
+func (httpMux *HTTPMux) GetStationConfig(webResponseWriter http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	config, err := httpMux.procMgr.StationConfig(vars["configName"])
+	writeResult(webResponseWriter, config, err)
+}
+
+// CreateStationConfig saves a new station config file and starts its process
+func (httpMux *HTTPMux) CreateStationConfig(webResponseWriter http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeResult(webResponseWriter, nil, Interfaces.ValidationError("the request body could not be read: %v", err))
+		return
+	}
+
+	config, err := httpMux.procMgr.CreateStationConfig(vars["configName"], body)
+	if err != nil {
+		writeResult(webResponseWriter, nil, err)
+		return
+	}
+	objects, _ := json.MarshalIndent(config, "", "\t")
+	webResponseWriter.Header().Set("Content-Type", "application/json")
+	webResponseWriter.WriteHeader(http.StatusCreated)
+	webResponseWriter.Write(objects)
+}
+
+// UpdateStationConfig replaces a station config file and restarts its process
+func (httpMux *HTTPMux) UpdateStationConfig(webResponseWriter http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeResult(webResponseWriter, nil, Interfaces.ValidationError("the request body could not be read: %v", err))
+		return
+	}
+
+	config, err := httpMux.procMgr.UpdateStationConfig(vars["configName"], body)
+	writeResult(webResponseWriter, config, err)
+}
+
+// DeleteStationConfig stops a station's process and deletes its config file, returning the deleted config
+func (httpMux *HTTPMux) DeleteStationConfig(webResponseWriter http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	config, err := httpMux.procMgr.DeleteStationConfig(vars["configName"])
+	writeResult(webResponseWriter, config, err)
+}
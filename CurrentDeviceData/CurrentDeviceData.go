@@ -1,23 +1,191 @@
 package CurrentDeviceData
 
-import "github.com/Josiah-B/Cyclone/Interfaces"
+import (
+	"sync"
+	"time"
 
+	"github.com/Josiah-B/Cyclone/Interfaces"
+)
+
+//Data holds the current sensor readings of every station. It is safe for concurrent use.
 type Data struct {
-	SensorReadings map[string]Interfaces.StationUploadTemplate
+	//StaleAfter is how long a sensor can go without an update before its reading is marked stale; 0 never marks readings stale
+	StaleAfter time.Duration
+
+	lock     sync.RWMutex
+	stations map[string]*stationReadings
+	//sequence counts the merges, so derived readings computed from an older merge are not stored over newer ones
+	sequence uint64
+}
+
+//stationReadings holds a station's current readings along with the times each of its sensors was last updated
+type stationReadings struct {
+	conditions Interfaces.StationUploadTemplate
+	times      map[string]sensorTimes
+	//sequence is the number of the last merge into the readings
+	sequence uint64
+}
+
+//sensorTimes holds the time stamp a reading was uploaded with and the time it was received
+type sensorTimes struct {
+	timeStamp   time.Time
+	lastUpdated time.Time
 }
 
 func init() {
 }
 
-func (data *Data) GetCurrentSensorReadings(StationName string) Interfaces.StationUploadTemplate {
-	return data.SensorReadings[StationName]
+//GetCurrentSensorReadings returns a copy of the current readings for the station, with their staleness filled in, and whether the station has uploaded any
+func (data *Data) GetCurrentSensorReadings(StationName string) (Interfaces.StationUploadTemplate, bool) {
+	data.lock.RLock()
+	defer data.lock.RUnlock()
+
+	stn, ok := data.stations[StationName]
+	if !ok {
+		return Interfaces.StationUploadTemplate{}, false
+	}
+	return data.withStatus(stn, time.Now()), true
 }
 
-func (data *Data) SetCurrentSensorReadings(currentConditions *Interfaces.StationUploadTemplate) {
+//GetAllCurrentSensorReadings returns a copy of the current readings of every station that has uploaded
+func (data *Data) GetAllCurrentSensorReadings() []Interfaces.StationUploadTemplate {
+	data.lock.RLock()
+	defer data.lock.RUnlock()
+
+	now := time.Now()
+	all := make([]Interfaces.StationUploadTemplate, 0, len(data.stations))
+	for _, stn := range data.stations {
+		all = append(all, data.withStatus(stn, now))
+	}
+	return all
+}
+
+//SetCurrentSensorReadings merges the uploaded readings into the station's current readings, each sensor keeping the time it was last uploaded,
+//and returns the station's readings after the merge along with the merge's sequence number. If the upload has Replace set, the station's readings
+//are replaced by the upload instead.
+func (data *Data) SetCurrentSensorReadings(currentConditions *Interfaces.StationUploadTemplate) (Interfaces.StationUploadTemplate, uint64) {
+	data.lock.Lock()
+	defer data.lock.Unlock()
+
 	//Create the data structure if it has not been initilized yet
-	if data.SensorReadings == nil {
-		data.SensorReadings = make(map[string]Interfaces.StationUploadTemplate)
+	if data.stations == nil {
+		data.stations = make(map[string]*stationReadings)
+	}
+
+	stn, ok := data.stations[currentConditions.StationName]
+	if !ok || currentConditions.Replace {
+		stn = &stationReadings{
+			conditions: Interfaces.StationUploadTemplate{StationName: currentConditions.StationName},
+			times:      make(map[string]sensorTimes, len(currentConditions.SensorReadings))}
+		stn.conditions.SensorReadings = make(map[string]Interfaces.SensorReading, len(currentConditions.SensorReadings))
+		data.stations[currentConditions.StationName] = stn
+	}
+
+	now := time.Now()
+	times := sensorTimes{timeStamp: currentConditions.TimeStamp, lastUpdated: now}
+	if times.timeStamp.IsZero() {
+		times.timeStamp = now
+	}
+	if times.timeStamp.After(stn.conditions.TimeStamp) {
+		stn.conditions.TimeStamp = times.timeStamp
+	}
+	for sensorName, reading := range currentConditions.SensorReadings {
+		stn.conditions.SensorReadings[sensorName] = reading
+		stn.times[sensorName] = times
+	}
+	data.sequence++
+	stn.sequence = data.sequence
+	return data.withStatus(stn, now), stn.sequence
+}
+
+//SetDerivedReadings replaces the station's derived readings with 'derived', computed from the readings of the merge 'sequence', and returns the station's readings.
+//'sources' holds the sensors each derived reading was computed from. The derived readings are left out if readings have been merged since,
+//the newer merge's derived readings are stored instead. False is returned if the station has not uploaded any readings.
+func (data *Data) SetDerivedReadings(StationName string, sequence uint64, derived map[string]Interfaces.SensorReading, sources map[string][]string) (Interfaces.StationUploadTemplate, bool) {
+	data.lock.Lock()
+	defer data.lock.Unlock()
+
+	stn, ok := data.stations[StationName]
+	if !ok {
+		return Interfaces.StationUploadTemplate{}, false
+	}
+	if stn.sequence != sequence {
+		return data.withStatus(stn, time.Now()), true
 	}
 
-	data.SensorReadings[currentConditions.StationName] = *currentConditions
+	for sensorName, reading := range stn.conditions.SensorReadings {
+		if _, stillDerived := derived[sensorName]; reading.Derived && !stillDerived {
+			delete(stn.conditions.SensorReadings, sensorName)
+			delete(stn.times, sensorName)
+		}
+	}
+
+	now := time.Now()
+	for sensorName, reading := range derived {
+		stn.conditions.SensorReadings[sensorName] = reading
+		stn.times[sensorName] = stn.oldestTimes(sources[sensorName], now)
+	}
+	return data.withStatus(stn, now), true
+}
+
+//oldestTimes returns the times of the least recently updated of the sensors, as a derived reading is only as recent as its oldest input.
+//If none of the sensors have readings the station's time stamp is used.
+func (stn *stationReadings) oldestTimes(sensorNames []string, now time.Time) sensorTimes {
+	oldest := sensorTimes{timeStamp: stn.conditions.TimeStamp, lastUpdated: now}
+	found := false
+	for _, sensorName := range sensorNames {
+		times, ok := stn.times[sensorName]
+		if ok && (!found || times.lastUpdated.Before(oldest.lastUpdated)) {
+			oldest = times
+			found = true
+		}
+	}
+	return oldest
+}
+
+//DeleteCurrentSensorReadings removes the current sensor readings for the specified station
+func (data *Data) DeleteCurrentSensorReadings(StationName string) {
+	data.lock.Lock()
+	defer data.lock.Unlock()
+	delete(data.stations, StationName)
+}
+
+//withStatus copies the station's readings and fills in when each sensor was last updated and whether it is stale. The lock must be held.
+func (data *Data) withStatus(stn *stationReadings, now time.Time) Interfaces.StationUploadTemplate {
+	conditions := copyConditions(stn.conditions)
+	conditions.SensorStatus = make(map[string]Interfaces.SensorStatus, len(stn.times))
+
+	var stationUpdated time.Time
+	for sensorName, times := range stn.times {
+		conditions.SensorStatus[sensorName] = Interfaces.SensorStatus{
+			TimeStamp:   times.timeStamp,
+			LastUpdated: times.lastUpdated,
+			Stale:       data.isStale(times.lastUpdated, now)}
+		if times.lastUpdated.After(stationUpdated) {
+			stationUpdated = times.lastUpdated
+		}
+	}
+
+	// the station is only stale once every one of its sensors is
+	conditions.LastUpdated = &stationUpdated
+	conditions.Stale = data.isStale(stationUpdated, now)
+	return conditions
+}
+
+func (data *Data) isStale(updated time.Time, now time.Time) bool {
+	return data.StaleAfter > 0 && now.Sub(updated) > data.StaleAfter
+}
+
+//copyConditions copies the readings map so callers can not change the stored readings
+func copyConditions(conditions Interfaces.StationUploadTemplate) Interfaces.StationUploadTemplate {
+	readings := make(map[string]Interfaces.SensorReading, len(conditions.SensorReadings))
+	for sensorName, reading := range conditions.SensorReadings {
+		readings[sensorName] = reading
+	}
+	conditions.SensorReadings = readings
+	conditions.SensorStatus = nil
+	conditions.LastUpdated = nil
+	conditions.Stale = false
+	conditions.Replace = false
+	return conditions
 }
@@ -0,0 +1,167 @@
+/*
+	Derived computes meteorological quantities, such as dew point and wind chill, from a station's current readings.
+	Each quantity is computed by a Deriver; derivers are looked up by the ObservedProperty names of the readings they need.
+*/
+package Derived
+
+import (
+	"strings"
+
+	"github.com/Josiah-B/Cyclone/Interfaces"
+	"github.com/Josiah-B/Cyclone/Units"
+)
+
+// ObservedProperty names used as inputs by the built in derivers. Names are matched ignoring case, spaces and underscores.
+const (
+	Temperature = "Temperature"
+	Humidity    = "Humidity"
+	WindSpeed   = "WindSpeed"
+	Pressure    = "Pressure"
+)
+
+// inputUnits is the unit every input is converted to before it is passed to a deriver
+var inputUnits = map[string]string{
+	normalizeName(Temperature): "C",
+	normalizeName(WindSpeed):   "m/s",
+	normalizeName(Pressure):    "hPa",
+}
+
+// Input is a single reading passed to the derivers
+type Input struct {
+	// SensorName is the sensor the reading came from
+	SensorName string
+	// Property is the name of the ObservedProperty the reading measures
+	Property string
+	Value    float64
+	// Unit is the unit of measure of Value; inputs without a unit are assumed to already be in the unit the derivers expect (°C, m/s, hPa and %)
+	Unit string
+}
+
+// Values holds a station's inputs, converted to the units the derivers expect, keyed by their normalized ObservedProperty name
+type Values map[string]float64
+
+// Get returns the value of the ObservedProperty 'property'
+func (values Values) Get(property string) (float64, bool) {
+	value, ok := values[normalizeName(property)]
+	return value, ok
+}
+
+// Deriver computes one derived quantity
+type Deriver interface {
+	// Name is the ObservedProperty name of the computed quantity; it is also used as the reading's sensor name
+	Name() string
+	// Unit is the unit of measure of the computed quantity
+	Unit() string
+	// Inputs lists the ObservedProperty names that must be present for Derive to be called
+	Inputs() []string
+	// Derive computes the quantity; false is returned if it can not be computed for these values
+	Derive(values Values, stn *Interfaces.Station) (float64, bool)
+}
+
+// OptionalInputs is implemented by derivers that also use inputs which do not have to be present, so they are counted as sources when they are
+type OptionalInputs interface {
+	OptionalInputs() []string
+}
+
+// Derivation is a derived reading along with the sensors whose readings it was computed from
+type Derivation struct {
+	Reading Interfaces.SensorReading
+	Sources []string
+}
+
+// Registry holds the set of derivers that are run on every upload
+type Registry struct {
+	derivers []Deriver
+}
+
+// NewRegistry creates a registry holding the 'derivers'
+func NewRegistry(derivers ...Deriver) *Registry {
+	return &Registry{derivers: derivers}
+}
+
+// DefaultRegistry creates a registry holding all of the built in derivers
+func DefaultRegistry() *Registry {
+	return NewRegistry(
+		dewPoint{},
+		heatIndex{},
+		windChill{},
+		feelsLike{},
+		humidex{},
+		absoluteHumidity{},
+		seaLevelPressure{})
+}
+
+// Register adds a deriver to the registry
+func (registry *Registry) Register(deriver Deriver) {
+	registry.derivers = append(registry.derivers, deriver)
+}
+
+// Derivers returns the registered derivers
+func (registry *Registry) Derivers() []Deriver {
+	return registry.derivers
+}
+
+// Derive runs every deriver whose inputs are available and returns the computed readings, with their sources, keyed by the deriver's name.
+// 'stn' may be nil if the station is not in the database yet; derivers that need station details are skipped in that case.
+func (registry *Registry) Derive(inputs []Input, stn *Interfaces.Station) map[string]Derivation {
+	values := Values{}
+	// sensorNames holds the sensor each value came from
+	sensorNames := make(map[string]string)
+	for _, input := range inputs {
+		key := normalizeName(input.Property)
+		value := input.Value
+		if target, ok := inputUnits[key]; ok && input.Unit != "" {
+			converted, err := Units.Convert(value, input.Unit, target)
+			if err != nil {
+				continue
+			}
+			value = converted
+		}
+		values[key] = value
+		sensorNames[key] = input.SensorName
+	}
+
+	derived := make(map[string]Derivation)
+	for _, deriver := range registry.derivers {
+		if !hasInputs(values, deriver.Inputs()) {
+			continue
+		}
+		if value, ok := deriver.Derive(values, stn); ok {
+			reading := Interfaces.NumericReading(value)
+			reading.Unit = deriver.Unit()
+			reading.Derived = true
+			derived[deriver.Name()] = Derivation{Reading: reading, Sources: sources(deriver, sensorNames)}
+		}
+	}
+	return derived
+}
+
+// sources returns the sensors of the deriver's inputs, and of the optional inputs that are present
+func sources(deriver Deriver, sensorNames map[string]string) []string {
+	properties := deriver.Inputs()
+	if optional, ok := deriver.(OptionalInputs); ok {
+		properties = append(append([]string(nil), properties...), optional.OptionalInputs()...)
+	}
+
+	var sensors []string
+	for _, property := range properties {
+		if sensorName, ok := sensorNames[normalizeName(property)]; ok {
+			sensors = append(sensors, sensorName)
+		}
+	}
+	return sensors
+}
+
+func hasInputs(values Values, inputs []string) bool {
+	for _, input := range inputs {
+		if _, ok := values.Get(input); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeName lower cases the name and removes spaces and underscores so that "Wind Speed", "wind_speed" and "WindSpeed" match
+func normalizeName(name string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "_", "", "-", "").Replace(name))
+}
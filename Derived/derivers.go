@@ -0,0 +1,160 @@
+package Derived
+
+import (
+	"math"
+
+	"github.com/Josiah-B/Cyclone/Interfaces"
+)
+
+// saturationVaporPressure returns the saturation vapor pressure in hPa at 'tempC' using the Magnus formula
+func saturationVaporPressure(tempC float64) float64 {
+	return 6.112 * math.Exp(17.62*tempC/(243.12+tempC))
+}
+
+func celsiusToFahrenheit(tempC float64) float64 {
+	return tempC*9/5 + 32
+}
+
+func fahrenheitToCelsius(tempF float64) float64 {
+	return (tempF - 32) * 5 / 9
+}
+
+// calcDewPoint returns the dew point in °C
+func calcDewPoint(tempC float64, humidity float64) (float64, bool) {
+	if humidity <= 0 || humidity > 100 {
+		return 0, false
+	}
+	gamma := math.Log(humidity/100) + 17.62*tempC/(243.12+tempC)
+	return 243.12 * gamma / (17.62 - gamma), true
+}
+
+// calcHeatIndex returns the NWS heat index in °C
+func calcHeatIndex(tempC float64, humidity float64) float64 {
+	t := celsiusToFahrenheit(tempC)
+
+	// the simple formula is used below 80°F
+	hi := 0.5 * (t + 61.0 + (t-68.0)*1.2 + humidity*0.094)
+	if (hi+t)/2 < 80 {
+		return fahrenheitToCelsius(hi)
+	}
+
+	hi = -42.379 + 2.04901523*t + 10.14333127*humidity - 0.22475541*t*humidity - 0.00683783*t*t -
+		0.05481717*humidity*humidity + 0.00122874*t*t*humidity + 0.00085282*t*humidity*humidity - 0.00000199*t*t*humidity*humidity
+	if humidity < 13 && t >= 80 && t <= 112 {
+		hi -= ((13 - humidity) / 4) * math.Sqrt((17-math.Abs(t-95))/17)
+	} else if humidity > 85 && t >= 80 && t <= 87 {
+		hi += ((humidity - 85) / 10) * ((87 - t) / 5)
+	}
+	return fahrenheitToCelsius(hi)
+}
+
+// calcWindChill returns the NWS / Environment Canada wind chill in °C; false is returned outside of the range the formula is defined for
+func calcWindChill(tempC float64, windMS float64) (float64, bool) {
+	windKPH := windMS * 3.6
+	if tempC > 10 || windKPH <= 4.8 {
+		return tempC, false
+	}
+	v := math.Pow(windKPH, 0.16)
+	return 13.12 + 0.6215*tempC - 11.37*v + 0.3965*tempC*v, true
+}
+
+type dewPoint struct{}
+
+func (dewPoint) Name() string     { return "DewPoint" }
+func (dewPoint) Unit() string     { return "C" }
+func (dewPoint) Inputs() []string { return []string{Temperature, Humidity} }
+func (dewPoint) Derive(values Values, stn *Interfaces.Station) (float64, bool) {
+	t, _ := values.Get(Temperature)
+	h, _ := values.Get(Humidity)
+	return calcDewPoint(t, h)
+}
+
+type heatIndex struct{}
+
+func (heatIndex) Name() string     { return "HeatIndex" }
+func (heatIndex) Unit() string     { return "C" }
+func (heatIndex) Inputs() []string { return []string{Temperature, Humidity} }
+func (heatIndex) Derive(values Values, stn *Interfaces.Station) (float64, bool) {
+	t, _ := values.Get(Temperature)
+	h, _ := values.Get(Humidity)
+	return calcHeatIndex(t, h), true
+}
+
+type windChill struct{}
+
+func (windChill) Name() string     { return "WindChill" }
+func (windChill) Unit() string     { return "C" }
+func (windChill) Inputs() []string { return []string{Temperature, WindSpeed} }
+func (windChill) Derive(values Values, stn *Interfaces.Station) (float64, bool) {
+	t, _ := values.Get(Temperature)
+	w, _ := values.Get(WindSpeed)
+	// outside of the formula's range the wind chill is the air temperature
+	chill, _ := calcWindChill(t, w)
+	return chill, true
+}
+
+// feelsLike uses the heat index when it is hot, the wind chill when it is cold and windy, and the air temperature otherwise
+type feelsLike struct{}
+
+func (feelsLike) Name() string     { return "FeelsLike" }
+func (feelsLike) Unit() string     { return "C" }
+func (feelsLike) Inputs() []string { return []string{Temperature} }
+func (feelsLike) OptionalInputs() []string {
+	return []string{Humidity, WindSpeed}
+}
+func (feelsLike) Derive(values Values, stn *Interfaces.Station) (float64, bool) {
+	t, _ := values.Get(Temperature)
+	if h, ok := values.Get(Humidity); ok && t >= 26.7 {
+		return calcHeatIndex(t, h), true
+	}
+	if w, ok := values.Get(WindSpeed); ok {
+		if chill, ok := calcWindChill(t, w); ok {
+			return chill, true
+		}
+	}
+	return t, true
+}
+
+type humidex struct{}
+
+func (humidex) Name() string     { return "Humidex" }
+func (humidex) Unit() string     { return "C" }
+func (humidex) Inputs() []string { return []string{Temperature, Humidity} }
+func (humidex) Derive(values Values, stn *Interfaces.Station) (float64, bool) {
+	t, _ := values.Get(Temperature)
+	h, _ := values.Get(Humidity)
+	dew, ok := calcDewPoint(t, h)
+	if !ok {
+		return 0, false
+	}
+	e := 6.11 * math.Exp(5417.7530*(1/273.16-1/(273.15+dew)))
+	return t + 0.5555*(e-10), true
+}
+
+// absoluteHumidity is the mass of water vapor in the air in grams per cubic meter
+type absoluteHumidity struct{}
+
+func (absoluteHumidity) Name() string     { return "AbsoluteHumidity" }
+func (absoluteHumidity) Unit() string     { return "g/m3" }
+func (absoluteHumidity) Inputs() []string { return []string{Temperature, Humidity} }
+func (absoluteHumidity) Derive(values Values, stn *Interfaces.Station) (float64, bool) {
+	t, _ := values.Get(Temperature)
+	h, _ := values.Get(Humidity)
+	return saturationVaporPressure(t) * h * 2.1674 / (273.15 + t), true
+}
+
+// seaLevelPressure reduces the station pressure to sea level using the barometric formula; it needs the station's elevation
+type seaLevelPressure struct{}
+
+func (seaLevelPressure) Name() string     { return "SeaLevelPressure" }
+func (seaLevelPressure) Unit() string     { return "hPa" }
+func (seaLevelPressure) Inputs() []string { return []string{Pressure, Temperature} }
+func (seaLevelPressure) Derive(values Values, stn *Interfaces.Station) (float64, bool) {
+	if stn == nil || stn.Elevation == nil {
+		return 0, false
+	}
+	p, _ := values.Get(Pressure)
+	t, _ := values.Get(Temperature)
+	h := *stn.Elevation
+	return p * math.Pow(1-(0.0065*h)/(t+0.0065*h+273.15), -5.257), true
+}
@@ -0,0 +1,182 @@
+/*
+	EventBus passes each station's current readings on to the clients streaming them as they arrive.
+	It keeps a short history of events so a client that reconnects can resume from the last event it received.
+*/
+package EventBus
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/Josiah-B/Cyclone/Interfaces"
+)
+
+// Event is a single update of a station's current readings
+type Event struct {
+	// ID increases by one with every event; clients send the last ID they received to resume a stream
+	ID uint64
+	Interfaces.StationUploadTemplate
+}
+
+// Filter selects the events a subscriber receives. Empty lists match everything; names are matched ignoring case.
+type Filter struct {
+	Stations []string
+	Sensors  []string
+}
+
+// Bus receives the current readings of every station and hands them to the subscribers whose filter matches
+type Bus struct {
+	lock        sync.Mutex
+	lastID      uint64
+	history     []Event
+	historySize int
+	subscribers map[*Subscription]bool
+}
+
+// Subscription receives the events matching its filter on Events until it is closed
+type Subscription struct {
+	Events chan Event
+	bus    *Bus
+	filter Filter
+	// dropped counts the events that were skipped because the subscriber was not keeping up
+	dropped int
+}
+
+// subscriptionBuffer is the number of events a subscriber can fall behind before events are dropped
+const subscriptionBuffer = 64
+
+// NewBus creates a bus that remembers the last 'historySize' events for resuming streams
+func NewBus(historySize int) *Bus {
+	return &Bus{historySize: historySize, subscribers: make(map[*Subscription]bool)}
+}
+
+// CurrentReadingsSet publishes the readings to every matching subscriber
+func (bus *Bus) CurrentReadingsSet(currentConditions Interfaces.StationUploadTemplate) {
+	bus.lock.Lock()
+	defer bus.lock.Unlock()
+
+	bus.lastID++
+	event := Event{ID: bus.lastID, StationUploadTemplate: currentConditions}
+	bus.history = append(bus.history, event)
+	if len(bus.history) > bus.historySize {
+		bus.history = bus.history[len(bus.history)-bus.historySize:]
+	}
+
+	for sub := range bus.subscribers {
+		sub.send(event)
+	}
+}
+
+// LastEventID returns the ID of the newest event
+func (bus *Bus) LastEventID() uint64 {
+	bus.lock.Lock()
+	defer bus.lock.Unlock()
+	return bus.lastID
+}
+
+// Subscribe starts a subscription. If 'lastEventID' is not 0 the events after it that are still in the history are sent first.
+// The returned bool is false when events after 'lastEventID' have already left the history, so the client has missed some.
+func (bus *Bus) Subscribe(filter Filter, lastEventID uint64) (*Subscription, bool) {
+	bus.lock.Lock()
+	defer bus.lock.Unlock()
+
+	sub := &Subscription{Events: make(chan Event, subscriptionBuffer+bus.historySize), bus: bus, filter: filter}
+	complete := true
+	if lastEventID != 0 {
+		// an ID from the future means the server restarted and the IDs started over
+		if lastEventID > bus.lastID || (len(bus.history) > 0 && bus.history[0].ID > lastEventID+1) {
+			complete = false
+		}
+		for _, event := range bus.history {
+			if event.ID > lastEventID {
+				sub.send(event)
+			}
+		}
+	}
+
+	bus.subscribers[sub] = true
+	return sub, complete
+}
+
+// SetFilter changes the events the subscription receives from now on
+func (sub *Subscription) SetFilter(filter Filter) {
+	sub.bus.lock.Lock()
+	defer sub.bus.lock.Unlock()
+	sub.filter = filter
+}
+
+// Dropped returns the number of events that were skipped because the subscriber was not keeping up
+func (sub *Subscription) Dropped() int {
+	sub.bus.lock.Lock()
+	defer sub.bus.lock.Unlock()
+	return sub.dropped
+}
+
+// Close stops the subscription and closes its Events channel
+func (sub *Subscription) Close() {
+	sub.bus.lock.Lock()
+	defer sub.bus.lock.Unlock()
+
+	if sub.bus.subscribers[sub] {
+		delete(sub.bus.subscribers, sub)
+		close(sub.Events)
+	}
+}
+
+// send queues the event if it matches the filter, dropping it if the subscriber is too far behind. The bus lock must be held.
+func (sub *Subscription) send(event Event) {
+	filtered, ok := sub.filter.Apply(event.StationUploadTemplate)
+	if !ok {
+		return
+	}
+	event.StationUploadTemplate = filtered
+
+	select {
+	case sub.Events <- event:
+	default:
+		sub.dropped++
+	}
+}
+
+// Apply returns the readings that match the filter, false is returned if the station is not wanted or none of its sensors are
+func (filter Filter) Apply(currentConditions Interfaces.StationUploadTemplate) (Interfaces.StationUploadTemplate, bool) {
+	if len(filter.Stations) > 0 && !containsName(filter.Stations, currentConditions.StationName) {
+		return currentConditions, false
+	}
+	if len(filter.Sensors) == 0 {
+		return currentConditions, true
+	}
+
+	filtered := currentConditions
+	filtered.SensorReadings = make(map[string]Interfaces.SensorReading)
+	for sensorName, reading := range currentConditions.SensorReadings {
+		if containsName(filter.Sensors, sensorName) {
+			filtered.SensorReadings[sensorName] = reading
+		}
+	}
+	return filtered, len(filtered.SensorReadings) > 0
+}
+
+// ParseFilter reads a filter from comma separated lists of station and sensor names
+func ParseFilter(stations string, sensors string) Filter {
+	return Filter{Stations: splitNames(stations), Sensors: splitNames(sensors)}
+}
+
+func splitNames(names string) []string {
+	var list []string
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			list = append(list, name)
+		}
+	}
+	return list
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package Interfaces
+
+import "time"
+
+// Bucket widths that observations can be aggregated over
+const (
+	BucketHour  = "hour"
+	BucketDay   = "day"
+	BucketMonth = "month"
+	BucketYear  = "year"
+)
+
+// Functions that can be used to aggregate the observations in a bucket
+const (
+	AggregateMin   = "min"
+	AggregateMax   = "max"
+	AggregateAvg   = "avg"
+	AggregateSum   = "sum"
+	AggregateCount = "count"
+)
+
+var (
+	bucketWidths       = map[string]bool{BucketHour: true, BucketDay: true, BucketMonth: true, BucketYear: true}
+	aggregateFunctions = map[string]bool{AggregateMin: true, AggregateMax: true, AggregateAvg: true, AggregateSum: true, AggregateCount: true}
+)
+
+// AggregationParameters holds the paramaters for aggregating a data stream's observations into time buckets
+type AggregationParameters struct {
+	DataStreamID int
+	// BucketWidth is one of the Bucket constants
+	BucketWidth string
+	// Function is one of the Aggregate constants
+	Function  string
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+// AggregateBucket holds the aggregated value for a single time bucket
+type AggregateBucket struct {
+	// StartTime is the start of the bucket in the station's time zone
+	StartTime time.Time
+	// EndTime is the start of the next bucket
+	EndTime time.Time
+	Value   float64
+	// Count is the number of observations that went into the bucket
+	Count int
+	// Unit is the unit of measure of Value; it is only filled in when the buckets have been converted with the '?units=' parameter
+	Unit string `json:",omitempty"`
+}
+
+// Location returns the station's time zone, falling back to the server's local time zone if it is not set or not known
+func (stn *Station) Location() *time.Location {
+	loc, err := time.LoadLocation(stn.TimeZone)
+	if err != nil || stn.TimeZone == "" {
+		return time.Local
+	}
+	return loc
+}
+
+// BucketStart returns the start of the bucket that 'timeStamp' falls in, calculated in the time zone 'loc'
+func BucketStart(timeStamp time.Time, bucketWidth string, loc *time.Location) time.Time {
+	t := timeStamp.In(loc)
+	switch bucketWidth {
+	case BucketHour:
+		// step back to the start of the hour; building the time from its parts is ambiguous in the hour that repeats when the clocks go back
+		return t.Add(-time.Duration(t.Minute())*time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	case BucketDay:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	case BucketMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, loc)
+	}
+}
+
+// NextBucketStart returns the start of the bucket that follows the bucket starting at 'bucketStart'
+func NextBucketStart(bucketStart time.Time, bucketWidth string) time.Time {
+	switch bucketWidth {
+	case BucketHour:
+		return bucketStart.Add(time.Hour)
+	case BucketDay:
+		return bucketStart.AddDate(0, 0, 1)
+	case BucketMonth:
+		return bucketStart.AddDate(0, 1, 0)
+	default:
+		return bucketStart.AddDate(1, 0, 0)
+	}
+}
@@ -0,0 +1,37 @@
+package Interfaces
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NewObservationCursor creates the opaque cursor that continues an observation query after 'observation'
+func NewObservationCursor(observation Observation) string {
+	raw := strconv.FormatInt(observation.TimeStamp.UnixNano(), 10) + ":" + strconv.Itoa(observation.ObservationID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseObservationCursor returns the time stamp and ID of the observation the cursor was created from
+func ParseObservationCursor(cursor string) (time.Time, int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, ValidationError("cursor '%v' is not valid", cursor)
+	}
+
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 2 {
+		return time.Time{}, 0, ValidationError("cursor '%v' is not valid", cursor)
+	}
+
+	nanoSecs, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, 0, ValidationError("cursor '%v' is not valid", cursor)
+	}
+	observationID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return time.Time{}, 0, ValidationError("cursor '%v' is not valid", cursor)
+	}
+	return time.Unix(0, nanoSecs).UTC(), observationID, nil
+}
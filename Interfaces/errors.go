@@ -0,0 +1,59 @@
+package Interfaces
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Errors returned by the Storage implementations. Callers should compare against these with errors.Is since implementations wrap them with more detail.
+var (
+	// ErrNotFound is returned when the requested item does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when an operation would break the relationship between items, such as deleting a station that still has data streams
+	ErrConflict = errors.New("conflict")
+	// ErrValidation is returned when the item passed in is missing required values or the values are not allowed
+	ErrValidation = errors.New("validation failed")
+	// ErrBackend is returned when the underlying storage fails, such as a database query error
+	ErrBackend = errors.New("storage backend failure")
+	// ErrUnauthorized is returned when the credentials given are missing or do not match
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrForbidden is returned when the credentials are valid but do not allow the operation
+	ErrForbidden = errors.New("forbidden")
+)
+
+// HTTPStatusCode maps the Storage errors to the matching http status code
+func HTTPStatusCode(err error) int {
+	switch {
+	case errors.Is(err, ErrValidation):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrForbidden):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// NotFoundError wraps ErrNotFound with the kind of item and ID that could not be found
+func NotFoundError(itemType string, id interface{}) error {
+	return fmt.Errorf("%w: %v '%v'", ErrNotFound, itemType, id)
+}
+
+// ValidationError wraps ErrValidation with a description of what is wrong
+func ValidationError(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %v", ErrValidation, fmt.Sprintf(format, args...))
+}
+
+// BackendError wraps 'err' with ErrBackend. Errors that already carry one of the sentinel errors, and nil, are returned unchanged.
+func BackendError(err error) error {
+	if err == nil || errors.Is(err, ErrNotFound) || errors.Is(err, ErrConflict) || errors.Is(err, ErrValidation) || errors.Is(err, ErrBackend) || errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrForbidden) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrBackend, err)
+}
@@ -39,7 +39,12 @@ type Observation struct {
 	ObservationID int
 	DataStreamID  int
 	TimeStamp     time.Time
-	Value         string
+	// Value is the numeric reading; it is nil for sensors that do not report numbers
+	Value *float64
+	// RawValue holds the reading for sensors that do not report numbers, such as wind direction text or status flags
+	RawValue string `json:",omitempty"`
+	// Unit is the unit of measure of Value; it is only filled in when the observation has been converted with the '?units=' parameter
+	Unit string `json:",omitempty"`
 }
 
 type Station struct {
@@ -48,14 +53,95 @@ type Station struct {
 	Description string
 	Latitude    string
 	Longitude   string
-	Streams     []DataStream
+	// TimeZone is the IANA name of the station's time zone (e.g. "America/Chicago"); an empty value uses the server's local time zone
+	TimeZone string
+	// Elevation is the station's height above sea level in meters; it is needed to compute the sea level pressure
+	Elevation *float64 `json:",omitempty"`
+	// UploadPassword is only used to set the password stations must send when uploading through the Weather Underground protocol.
+	// It is stored hashed and is never sent back; leaving it empty keeps the current password.
+	UploadPassword string `json:",omitempty"`
+	// DeviceKey identifies the station's hardware for uploads that do not send a station name, such as an Ecowitt PASSKEY or an Ambient Weather MAC address
+	DeviceKey string `json:",omitempty"`
+	Streams   []DataStream
 }
 
 // StationUploadTemplate is a template for uploading weather station sensor readings to the api. It is also the format the api spits back current conditions in.
 type StationUploadTemplate struct {
 	StationName    string
 	TimeStamp      time.Time
-	SensorReadings map[string]string
+	SensorReadings map[string]SensorReading
+	// Replace makes the upload replace all of the station's current readings. By default the uploaded readings are merged
+	// into the current readings, so a station can upload each of its sensors separately.
+	Replace bool `json:",omitempty"`
+
+	// LastUpdated, Stale and SensorStatus are filled in when the current conditions are read back; they are ignored in uploads.
+	// LastUpdated is when any of the station's sensors was last updated, and Stale is true once all of them are older than the configured age.
+	LastUpdated  *time.Time              `json:",omitempty"`
+	Stale        bool                    `json:",omitempty"`
+	SensorStatus map[string]SensorStatus `json:",omitempty"`
+}
+
+// SensorStatus reports when a sensor's current reading was last updated and whether it is too old to be trusted
+type SensorStatus struct {
+	// TimeStamp is the time stamp the reading was uploaded with, LastUpdated is the time it was received
+	TimeStamp   time.Time
+	LastUpdated time.Time
+	Stale       bool
+}
+
+// CurrentReadingsListener is notified every time a station's current readings are set, after the derived readings have been added
+type CurrentReadingsListener interface {
+	CurrentReadingsSet(currentConditions StationUploadTemplate)
+}
+
+// LoggingConfig holds how a station's current readings are logged to the database. Stations without a saved configuration are logged at the Logger's interval.
+type LoggingConfig struct {
+	StationID   int
+	StationName string
+	Enabled     bool
+	// Interval is how often the readings are logged, in minutes; 0 uses the Logger's interval
+	Interval int
+	// IncludeSensors limits logging to the listed sensors when it is not empty; the sensors in ExcludeSensors are never logged
+	IncludeSensors []string
+	ExcludeSensors []string
+}
+
+// Scopes that can be granted to an APIToken
+const (
+	// ScopeRead allows reading the weather data and current conditions
+	ScopeRead = "read"
+	// ScopeUpload allows setting and logging current conditions; a token with a StationName can only upload for that station
+	ScopeUpload = "upload"
+	// ScopeAdmin allows everything, including changing stations and managing processes and tokens
+	ScopeAdmin = "admin"
+	// ScopePublic marks the routes that do not need a token
+	ScopePublic = "public"
+)
+
+// APIToken grants access to the HTTP APIs. Only a hash of the token's key is stored; the key is shown once, when the token is issued.
+type APIToken struct {
+	TokenID int
+	// Name describes who or what the token was issued to
+	Name   string
+	Scopes []string
+	// StationName limits an upload token to a single station
+	StationName string `json:",omitempty"`
+	Created     time.Time
+	LastUsed    *time.Time `json:",omitempty"`
+}
+
+// Allows returns true if the token has 'scope', or is an admin token. Upload tokens that belong to a station only allow uploads for
+// 'stationName'; pass an empty 'stationName' to check the scope alone.
+func (token *APIToken) Allows(scope string, stationName string) bool {
+	for _, tokenScope := range token.Scopes {
+		if tokenScope == ScopeAdmin {
+			return true
+		}
+		if tokenScope == scope {
+			return scope != ScopeUpload || token.StationName == "" || stationName == "" || token.StationName == stationName
+		}
+	}
+	return false
 }
 
 // Template for configuration settings
@@ -69,59 +155,129 @@ type APIRoute struct {
 	HandlerMethod func(http.ResponseWriter, *http.Request) `json:"-"` // we do not need any json exports to know what the handling method is
 	HTTPMethod    string
 	Description   string
+	// Scope is the APIToken scope needed to use the route
+	Scope string `json:",omitempty"`
 }
 
-//ObservationParameters holds the paramaters for getting historical graph data from the database
+//ObservationParameters holds the paramaters for getting historical graph data from the database.
+//Any filter left at its zero value is ignored.
 type ObservationParameters struct {
-	SensorID  int
-	StartTime time.Time
-	EndTime   time.Time
+	SensorID     int
+	StationID    int
+	DataStreamID int
+	StartTime    time.Time
+	EndTime      time.Time
+	// Limit is the maximum number of observations to return; 0 means no limit
+	Limit int
+	// Cursor continues a previous query from the last observation it returned, see NewObservationCursor
+	Cursor string
+	// Descending returns the newest observations first
+	Descending bool
+	// NumericOnly leaves out observations that do not have a numeric Value
+	NumericOnly bool
 }
+
+// Storage is implemented by every storage layer. Every method returns an error that wraps one of the sentinel errors
+// (ErrNotFound, ErrConflict, ErrValidation or ErrBackend) so callers can tell what went wrong with errors.Is.
 type Storage interface {
-	Initilize()
+	Initilize() error
+	// Close releases the storage; nothing else may be called once it has been closed
+	Close() error
 	// AddOrUpdateStation adds a new station to the database. If a station with the stn.StationID is already in the database this function will update it with the new values.
-	AddOrUpdateStation(stn *Station)
+	AddOrUpdateStation(stn *Station) error
 
 	//LogConditions pushes the current station to the database thus logging the conditions
 	LogConditions(currentConditions *StationUploadTemplate) error
 
-	AddOrUpdateUnitType(unit *UnitType)
+	AddOrUpdateUnitType(unit *UnitType) error
 
 	// AddOrUpdateSensor updates the current sensor or creates a new one if it does not exist. Returns the ID number fot the newly created sensor.
-	AddOrUpdateSensor(sensor *Sensor) int64
-	AddOrUpdateObservedProperty(observedProperty *ObservedProperty)
-	AddDataStream(dataStream *DataStream) int64
-	UpdateDataStream(dataStream *DataStream)
-	AddObservation(observation *Observation)
+	AddOrUpdateSensor(sensor *Sensor) (int64, error)
+	AddOrUpdateObservedProperty(observedProperty *ObservedProperty) error
+	AddDataStream(dataStream *DataStream) (int64, error)
+	UpdateDataStream(dataStream *DataStream) error
+	AddObservation(observation *Observation) error
 
 	// GetStation retrieves from the database a Station with ID number 'stationID'
-	GetStation(stationID string) *Station
+	GetStation(stationID string) (*Station, error)
 
 	// GetStation retrieves from the database a Station with name 'stationName'
-	GetStationByName(stationName string) *Station
+	GetStationByName(stationName string) (*Station, error)
 
 	// GetStations retrieves all of the stations from the database
-	GetStations() []Station
+	GetStations() ([]Station, error)
+
+	// GetStationByDeviceKey retrieves the station whose DeviceKey is 'deviceKey'
+	GetStationByDeviceKey(deviceKey string) (*Station, error)
+
+	// AuthenticateStation returns the station named 'stationName' if 'password' matches its upload password, otherwise ErrUnauthorized is returned
+	AuthenticateStation(stationName string, password string) (*Station, error)
 
 	// GetDataStream returns a datastream from the database based on the 'streamID'
-	GetDataStream(streamID string) *DataStream
+	GetDataStream(streamID string) (*DataStream, error)
 
 	// GetDataStream returns a datastream from the database based on the 'sensorName'
-	GetDataStreamBySensorName(sensorName string, stationIDNum int64) *DataStream
-	GetDataStreams() *[]DataStream
-	GetUnitType(unitTypeID string) *UnitType
-	GetUnitTypes() *[]UnitType
-	GetSensor(sensorID string) *Sensor
-	GetSensors() *[]Sensor
+	GetDataStreamBySensorName(sensorName string, stationIDNum int64) (*DataStream, error)
+	GetDataStreams() (*[]DataStream, error)
+
+	// EnsureDataStream returns the station's data stream for the sensor 'sensorName'. The data stream, sensor, observed property and unit type
+	// are created if they do not exist yet, and a data stream missing its observed property or unit type has them filled in.
+	EnsureDataStream(stationID int, sensorName string, sensorDescription string, propertyName string, unitOfMeasure string) (*DataStream, error)
+	GetUnitType(unitTypeID string) (*UnitType, error)
+	GetUnitTypes() (*[]UnitType, error)
+	GetSensor(sensorID string) (*Sensor, error)
+	GetSensors() (*[]Sensor, error)
 
 	// GetObservations returns the obseration with 'ObservationID'
-	GetObservation(observationID string) *Observation
-	GetObservations(parameters ObservationParameters) *[]Observation
-	GetObservedProperty(propertyID string) *ObservedProperty
-	GetObservedProperties() *[]ObservedProperty
+	GetObservation(observationID string) (*Observation, error)
+	GetObservations(parameters ObservationParameters) (*[]Observation, error)
+
+	// AggregateObservations groups a data stream's observations into time buckets, calculated in the station's time zone, and returns the aggregated value of each bucket
+	AggregateObservations(parameters AggregationParameters) (*[]AggregateBucket, error)
+
+	GetObservedProperty(propertyID string) (*ObservedProperty, error)
+	GetObservedProperties() (*[]ObservedProperty, error)
+
+	// DeleteStation removes a station from the database. If cascade is true the station's data streams and their observations are deleted with it,
+	// otherwise ErrConflict is returned when the station still has data streams.
+	DeleteStation(stationID string, cascade bool) error
+
+	// DeleteDataStream removes a data stream. If cascade is true the stream's observations are deleted with it, otherwise ErrConflict is returned when the stream has observations.
+	DeleteDataStream(streamID string, cascade bool) error
+
+	// DeleteUnitType removes a UnitType; ErrConflict is returned if a data stream still uses it
+	DeleteUnitType(unitTypeID string) error
+
+	// DeleteSensor removes a Sensor; ErrConflict is returned if a data stream still uses it
+	DeleteSensor(sensorID string) error
+
+	// DeleteObservedProperty removes an ObservedProperty; ErrConflict is returned if a data stream still uses it
+	DeleteObservedProperty(propertyID string) error
+
+	// DeleteObservation removes a single observation
+	DeleteObservation(observationID string) error
+
+	// GetCurrentSensorReadings returns the current readings for a station; ErrNotFound is returned if the station has not uploaded any
+	GetCurrentSensorReadings(StationName string) (StationUploadTemplate, error)
+	// GetAllCurrentSensorReadings returns the current readings of every station that has uploaded
+	GetAllCurrentSensorReadings() ([]StationUploadTemplate, error)
+
+	// GetLoggingConfigs returns the logging configuration of every station that has one saved
+	GetLoggingConfigs() ([]LoggingConfig, error)
+	// SetLoggingConfig saves a station's logging configuration
+	SetLoggingConfig(config *LoggingConfig) error
+	// DeleteLoggingConfig removes a station's logging configuration so the defaults are used again
+	DeleteLoggingConfig(stationID string) error
 
-	GetCurrentSensorReadings(StationName string) StationUploadTemplate
-	SetCurrentSensorReadings(currentSensorReadings StationUploadTemplate)
+	// IssueAPIToken stores a new token and returns its key. The key is not stored and can not be retrieved again.
+	IssueAPIToken(token *APIToken) (string, error)
+	// GetAPITokens returns every token that has been issued and not revoked
+	GetAPITokens() ([]APIToken, error)
+	// RevokeAPIToken deletes a token so its key is no longer accepted
+	RevokeAPIToken(tokenID string) error
+	// AuthenticateToken returns the token that 'key' belongs to, otherwise ErrUnauthorized is returned
+	AuthenticateToken(key string) (*APIToken, error)
+	SetCurrentSensorReadings(currentSensorReadings StationUploadTemplate) error
 }
 
 // new layer will have the following
@@ -0,0 +1,115 @@
+package Interfaces
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// SensorReading is a single sensor value. Numeric sensors set Value, sensors that report text (such as a wind direction of "NNW" or a status flag) set Raw instead.
+//
+// In JSON a reading can be sent as a number, as a string, or as an object with "Value" and/or "Raw" set. A string holding a number is read as a number,
+// any other string as a raw reading. Numbers that are not finite, such as "NaN" or "Inf", are rejected on every ingestion path.
+type SensorReading struct {
+	Value *float64 `json:",omitempty"`
+	Raw   string   `json:",omitempty"`
+	// Unit is the unit of measure symbol of Value. It is optional when uploading; the unit of the sensor's data stream is used when it is not set.
+	Unit string `json:",omitempty"`
+	// Derived is true for readings computed by Cyclone, such as dew point, rather than uploaded by the station
+	Derived bool `json:",omitempty"`
+}
+
+// NumericReading creates a reading holding 'value'
+func NumericReading(value float64) SensorReading {
+	return SensorReading{Value: &value}
+}
+
+// RawReading creates a reading for a sensor that does not report numbers
+func RawReading(raw string) SensorReading {
+	return SensorReading{Raw: raw}
+}
+
+// ParseSensorReading converts the text form of a reading. Numbers become numeric readings and any other text a raw reading;
+// an ErrValidation error is returned if 'text' is empty or is a number that is not finite.
+func ParseSensorReading(text string) (SensorReading, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return SensorReading{}, ValidationError("the reading has no value")
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if errors.Is(err, strconv.ErrSyntax) {
+		return RawReading(text), nil
+	}
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return SensorReading{}, ValidationError("'%v' is not a finite number", text)
+	}
+	return NumericReading(value), nil
+}
+
+// IsNumeric returns true if the reading holds a number
+func (reading SensorReading) IsNumeric() bool {
+	return reading.Value != nil
+}
+
+// String returns the reading as text
+func (reading SensorReading) String() string {
+	if reading.Value != nil {
+		return strconv.FormatFloat(*reading.Value, 'f', -1, 64)
+	}
+	return reading.Raw
+}
+
+// Validate checks that the reading holds a value
+func (reading SensorReading) Validate() error {
+	if reading.Value == nil && reading.Raw == "" {
+		return ValidationError("the reading has no value")
+	}
+	if reading.Value != nil && (math.IsNaN(*reading.Value) || math.IsInf(*reading.Value, 0)) {
+		return ValidationError("the reading is not a finite number")
+	}
+	return nil
+}
+
+// MarshalJSON writes numeric readings without a unit as plain numbers, anything else is written as an object
+func (reading SensorReading) MarshalJSON() ([]byte, error) {
+	if reading.Value != nil && reading.Raw == "" && reading.Unit == "" && !reading.Derived {
+		return json.Marshal(*reading.Value)
+	}
+	type plainReading SensorReading
+	return json.Marshal(plainReading(reading))
+}
+
+// UnmarshalJSON reads a reading from a number, a string or an object
+func (reading *SensorReading) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+
+	switch {
+	case len(data) > 0 && data[0] == '"':
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+		parsed, err := ParseSensorReading(text)
+		if err != nil {
+			return err
+		}
+		*reading = parsed
+	case len(data) > 0 && data[0] == '{':
+		type plainReading SensorReading
+		var plain plainReading
+		if err := json.Unmarshal(data, &plain); err != nil {
+			return ValidationError("'%v' is not a valid sensor reading", string(data))
+		}
+		*reading = SensorReading(plain)
+	default:
+		var value float64
+		if err := json.Unmarshal(data, &value); err != nil {
+			return ValidationError("'%v' is not a valid sensor reading", string(data))
+		}
+		*reading = NumericReading(value)
+	}
+	return reading.Validate()
+}
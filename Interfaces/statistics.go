@@ -0,0 +1,22 @@
+package Interfaces
+
+// Statistics that can be logged for a sensor over the logging interval. They are set per ObservedProperty in the Logger settings.
+const (
+	StatisticAvg = AggregateAvg
+	StatisticMin = AggregateMin
+	StatisticMax = AggregateMax
+	StatisticSum = AggregateSum
+	// StatisticLast logs the last reading of the interval; it suits counters that the station totals itself, such as daily rain
+	StatisticLast = "last"
+	// StatisticVectorAvg averages directions in degrees as unit vectors, so 350° and 10° average to 0° rather than 180°
+	StatisticVectorAvg = "vectoravg"
+)
+
+// IsStatistic returns true if 'statistic' is one of the Statistic constants
+func IsStatistic(statistic string) bool {
+	switch statistic {
+	case StatisticAvg, StatisticMin, StatisticMax, StatisticSum, StatisticLast, StatisticVectorAvg:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package Interfaces
+
+import (
+	"fmt"
+	"time"
+)
+
+// Validate checks that the station has the values required to store it
+func (stn *Station) Validate() error {
+	if stn.Name == "" {
+		return ValidationError("a station must have a Name")
+	}
+	if _, err := time.LoadLocation(stn.TimeZone); err != nil {
+		return ValidationError("'%v' is not a known time zone", stn.TimeZone)
+	}
+	// bcrypt, which hashes the password, ignores anything after the first 72 bytes
+	if len(stn.UploadPassword) > 72 {
+		return ValidationError("the UploadPassword can not be longer than 72 bytes")
+	}
+	return nil
+}
+
+// Validate checks that the logging configuration belongs to a station and has a usable interval
+func (config *LoggingConfig) Validate() error {
+	if config.StationID <= 0 {
+		return ValidationError("a logging configuration must belong to a station; StationID %v is not valid", config.StationID)
+	}
+	if config.Interval < 0 {
+		return ValidationError("the logging Interval can not be negative")
+	}
+	return nil
+}
+
+// Validate checks that the token has a name and only known scopes
+func (token *APIToken) Validate() error {
+	if token.Name == "" {
+		return ValidationError("a token must have a Name")
+	}
+	if len(token.Scopes) == 0 {
+		return ValidationError("a token must have at least one scope")
+	}
+	upload := false
+	for _, scope := range token.Scopes {
+		switch scope {
+		case ScopeRead, ScopeAdmin:
+		case ScopeUpload:
+			upload = true
+		default:
+			return ValidationError("'%v' is not a scope; use %v, %v or %v", scope, ScopeRead, ScopeUpload, ScopeAdmin)
+		}
+	}
+	if token.StationName != "" && (!upload || token.Allows(ScopeAdmin, "")) {
+		return ValidationError("only upload tokens without the %v scope can belong to a station", ScopeAdmin)
+	}
+	return nil
+}
+
+// Validate checks that the unit type has the values required to store it
+func (unit *UnitType) Validate() error {
+	if unit.Name == "" {
+		return ValidationError("a unit type must have a Name")
+	}
+	return nil
+}
+
+// Validate checks that the sensor has the values required to store it
+func (sensor *Sensor) Validate() error {
+	if sensor.Name == "" {
+		return ValidationError("a sensor must have a Name")
+	}
+	return nil
+}
+
+// Validate checks that the observed property has the values required to store it
+func (property *ObservedProperty) Validate() error {
+	if property.Name == "" {
+		return ValidationError("an observed property must have a Name")
+	}
+	return nil
+}
+
+// Validate checks that the data stream has the values required to store it
+func (dataStream *DataStream) Validate() error {
+	if dataStream.StationID <= 0 {
+		return ValidationError("a data stream must belong to a station; StationID %v is not valid", dataStream.StationID)
+	}
+	return nil
+}
+
+// Validate checks that the observation has the values required to store it
+func (observation *Observation) Validate() error {
+	if observation.DataStreamID <= 0 {
+		return ValidationError("an observation must belong to a data stream; DataStreamID %v is not valid", observation.DataStreamID)
+	}
+	if observation.TimeStamp.IsZero() {
+		return ValidationError("an observation must have a TimeStamp")
+	}
+	if observation.Value == nil && observation.RawValue == "" {
+		return ValidationError("an observation must have a Value or a RawValue")
+	}
+	return nil
+}
+
+// Validate checks that the uploaded readings can be matched to a station
+func (template *StationUploadTemplate) Validate() error {
+	if template.StationName == "" {
+		return ValidationError("the upload must have a StationName")
+	}
+	for sensorName, reading := range template.SensorReadings {
+		if err := reading.Validate(); err != nil {
+			return fmt.Errorf("sensor '%v': %w", sensorName, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks that the parameters describe a query that can be run
+func (parameters *ObservationParameters) Validate() error {
+	if parameters.Limit < 0 {
+		return ValidationError("limit must not be negative")
+	}
+	if !parameters.StartTime.IsZero() && !parameters.EndTime.IsZero() && parameters.EndTime.Before(parameters.StartTime) {
+		return ValidationError("the end time must not be before the start time")
+	}
+	if parameters.Cursor != "" {
+		if _, _, err := ParseObservationCursor(parameters.Cursor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks that the parameters describe an aggregation that can be run
+func (parameters *AggregationParameters) Validate() error {
+	if parameters.DataStreamID <= 0 {
+		return ValidationError("DataStreamID %v is not valid", parameters.DataStreamID)
+	}
+	if _, ok := bucketWidths[parameters.BucketWidth]; !ok {
+		return ValidationError("bucket '%v' is not supported; use hour, day, month or year", parameters.BucketWidth)
+	}
+	if _, ok := aggregateFunctions[parameters.Function]; !ok {
+		return ValidationError("function '%v' is not supported; use min, max, avg, sum or count", parameters.Function)
+	}
+	if !parameters.StartTime.IsZero() && !parameters.EndTime.IsZero() && parameters.EndTime.Before(parameters.StartTime) {
+		return ValidationError("the end time must not be before the start time")
+	}
+	return nil
+}
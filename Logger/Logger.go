@@ -1,171 +1,268 @@
 package Logger
 
 import (
+	"context"
 	"fmt"
-	"math"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/Josiah-B/Cyclone/Interfaces"
 )
 
 type Logger struct {
-	//Logging frequency (in minutes)
+	//Default logging frequency (in minutes), used by stations that do not have their own interval
 	Interval int
 
-	//the time at which we need to log conditions again (gets set to the (current time + logging interval) every time conditions are logged)
-	nextLogTime time.Time
+	//LogDerivedValues logs the readings computed by Cyclone (dew point, wind chill...) as their own data streams along with the uploaded readings
+	LogDerivedValues bool
 
-	//hold a listing of weather stations and the last time each one was logged
-	loggingInfo LoggingInfo
+	//Statistics sets the statistic logged for each ObservedProperty (see the Interfaces.Statistic constants); properties that are not listed use DefaultStatistics
+	Statistics map[string]string
 
-	//need the ability to add or remove stations from the list of stations, based on the stations that are currently uploading.
-	data Interfaces.Storage
-}
+	//LogMinMax logs the lowest and highest reading of the interval, as the sensor name followed by "Min" and "Max", for every sensor that is averaged
+	LogMinMax bool
 
-//LogginMetaInfo contains the logging settings for the stations
-type LoggingMetaInfo struct {
-	stationName    string
-	stationID      int
-	lastLogTime    time.Time //the time at which we last logged the sensor data
-	loggingEnabled bool
-}
+	//the last time each station was logged, by station name
+	lastLogTimes map[string]time.Time
+	//the readings uploaded since each station was last logged, by station name then sensor name
+	accumulators map[string]map[string]*sensorAccumulator
+	lock         sync.Mutex
 
-type LoggingInfo struct {
-	info map[string]LoggingMetaInfo
+	//the storage holds the current conditions that are logged and each station's logging settings
+	data Interfaces.Storage
 }
 
-//InitilizeLogger runs the setup and starts the needed timers
-func (logger *Logger) Initilize(storage Interfaces.Storage) {
+//InitilizeLogger runs the setup and starts the needed timers; the timers stop when 'ctx' is cancelled.
+//The returned channel is closed once the timers have stopped, after any logging pass that was running has finished.
+func (logger *Logger) Initilize(ctx context.Context, storage Interfaces.Storage) <-chan struct{} {
 	fmt.Println("Logger initilize: storage: ", storage)
 	logger.data = storage
 
-	logger.loggingInfo.info = make(map[string]LoggingMetaInfo)
+	logger.lastLogTimes = make(map[string]time.Time)
+	logger.accumulators = make(map[string]map[string]*sensorAccumulator)
 
-	go logger.startTimers()
-}
-
-func (logger *Logger) startTimers() {
-	// check periodically to see if any new weather stations have been added to the program
-	ticker := time.NewTicker(15 * time.Second)
-	quit := make(chan struct{})
+	done := make(chan struct{})
 	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				logger.addUploadingStationsToListForLogging()
-			case <-quit:
-				ticker.Stop()
-				return
-			}
-		}
+		defer close(done)
+		logger.startTimers(ctx)
 	}()
+	return done
+}
 
-	//START TIMER THAT WILL HANDLE LOGGING
-	//get the amount of time we need to wait till the starting interval
-	secsTilInterval := logger.getSecondsUntillInterval()
-	fmt.Println("Logger: Seconds till next interval: ", secsTilInterval)
+//startTimers checks every minute, on the minute, for stations that are due to be logged
+func (logger *Logger) startTimers(ctx context.Context) {
+	now := time.Now()
+	timer := time.NewTimer(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+	select {
+	case <-timer.C:
+		logger.LogStations()
+	case <-ctx.Done():
+		timer.Stop()
+		return
+	}
 
-	hourTimerInterval := time.Second * time.Duration(secsTilInterval)
-	fmt.Println("Logger: time to next interval ", hourTimerInterval)
-	// wait until the hour based interval
-	timer := time.NewTimer(hourTimerInterval)
-	<-timer.C
-	logger.LogStations()
+	loggingTicker := time.NewTicker(time.Minute)
+	defer loggingTicker.Stop()
+	for {
+		select {
+		case <-loggingTicker.C:
+			logger.LogStations()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
 
-	tempInterval := (time.Minute * time.Duration(logger.Interval))
-	fmt.Println("Logger: Logging interval in millisecs: ", tempInterval)
+//Flush logs the readings every enabled station has uploaded since it was last logged, whether or not its interval has passed.
+//It is used to log the partial interval when the program shuts down.
+func (logger *Logger) Flush() {
+	configs, err := logger.GetLoggingSettings()
+	if err != nil {
+		fmt.Println("Logger: failed to get the logging settings: ", err)
+		return
+	}
 
-	loggingTicker := time.NewTicker(tempInterval)
-	loggingQuit := make(chan struct{})
-	go func() {
-		for {
-			select {
-			case <-loggingTicker.C:
-				logger.LogStations()
-			case <-loggingQuit:
-				ticker.Stop()
-				return
-			}
+	now := time.Now()
+	for _, config := range configs {
+		stn := logger.takeIntervalReadings(config.StationName, now.UTC())
+		if config.Enabled {
+			logger.logIntervalReadings(stn, config)
 		}
-	}()
+	}
 }
 
-//getSecondsUntilInterval returns the number of seconds until the next interval; intervals are based on the hour mark
-func (logger *Logger) getSecondsUntillInterval() int {
-	//interval in seconds = 60 * interval
-	intervalInSecs := float64(60 * logger.Interval)
+//defaultLoggingConfig is used for stations that do not have a saved logging configuration; they are logged at the Logger's interval
+func defaultLoggingConfig(stn Interfaces.Station) Interfaces.LoggingConfig {
+	return Interfaces.LoggingConfig{StationID: stn.StationID, StationName: stn.Name, Enabled: true}
+}
 
-	//get the current time
-	now := time.Now()
+//GetLoggingSettings returns the logging settings for all the weather stations, including those using the defaults
+func (logger *Logger) GetLoggingSettings() ([]Interfaces.LoggingConfig, error) {
+	stns, err := logger.data.GetStations()
+	if err != nil {
+		return nil, err
+	}
+	saved, err := logger.data.GetLoggingConfigs()
+	if err != nil {
+		return nil, err
+	}
 
-	//get the number of seconds that have elapsed in this hour
-	nSecs := float64((now.Minute() * 60) + now.Second())
-	//number of seconds to the next quarter-hour mark
-	delta := math.Ceil(nSecs/intervalInSecs)*intervalInSecs - nSecs
-	return int(delta)
+	savedByID := make(map[int]Interfaces.LoggingConfig, len(saved))
+	for _, config := range saved {
+		savedByID[config.StationID] = config
+	}
+
+	configs := make([]Interfaces.LoggingConfig, 0, len(stns))
+	for _, stn := range stns {
+		if config, ok := savedByID[stn.StationID]; ok {
+			configs = append(configs, config)
+		} else {
+			configs = append(configs, defaultLoggingConfig(stn))
+		}
+	}
+	return configs, nil
 }
 
-//GetLoggingSettings returns the logging settings for all the weather stations
-func (logger *Logger) GetLoggingSettings() LoggingInfo {
-	return logger.loggingInfo
+//GetStationLoggingSettings returns the logging settings for the specified station
+func (logger *Logger) GetStationLoggingSettings(stnName string) (Interfaces.LoggingConfig, error) {
+	configs, err := logger.GetLoggingSettings()
+	if err != nil {
+		return Interfaces.LoggingConfig{}, err
+	}
+	for _, config := range configs {
+		if config.StationName == stnName {
+			return config, nil
+		}
+	}
+	return Interfaces.LoggingConfig{}, Interfaces.NotFoundError("station", stnName)
 }
 
-//EnableLogging enables logging for the specified station
-func (logger *Logger) SetLoggingEnabledStatus(stnName string, enabled bool) {
-	oldStn := logger.loggingInfo.info[stnName]
+//SetLoggingSettings saves the logging settings for the station named in the config
+func (logger *Logger) SetLoggingSettings(config *Interfaces.LoggingConfig) error {
+	stn, err := logger.data.GetStationByName(config.StationName)
+	if err != nil {
+		return err
+	}
+	config.StationID = stn.StationID
+	return logger.data.SetLoggingConfig(config)
+}
 
-	logger.loggingInfo.info[stnName] = LoggingMetaInfo{
-		stationName:    oldStn.stationName,
-		loggingEnabled: enabled,
-		stationID:      oldStn.stationID,
-		lastLogTime:    oldStn.lastLogTime}
+//ResetLoggingSettings removes the saved logging settings for the specified station so it uses the defaults again
+func (logger *Logger) ResetLoggingSettings(stnName string) error {
+	stn, err := logger.data.GetStationByName(stnName)
+	if err != nil {
+		return err
+	}
+	return logger.data.DeleteLoggingConfig(strconv.Itoa(stn.StationID))
 }
 
-//adds stations to the list that we keep track of the logging status
-func (logger *Logger) addUploadingStationsToListForLogging() {
-	fmt.Println("Logger: checking for new weather stations ", time.Now())
+//EnableLogging enables logging for the specified station
+func (logger *Logger) SetLoggingEnabledStatus(stnName string, enabled bool) error {
+	config, err := logger.GetStationLoggingSettings(stnName)
+	if err != nil {
+		return err
+	}
+	config.Enabled = enabled
+	return logger.SetLoggingSettings(&config)
+}
 
-	var stns = logger.data.GetStations()
-	fmt.Println(stns)
-	fmt.Println(logger.loggingInfo.info)
-	for index := range stns {
-		//see if the station is already in our current list
+//isDue returns true if the station's logging interval has passed since it was last logged. Intervals are based on the hour mark.
+//A station that has not been seen before is logged at its next interval.
+func (logger *Logger) isDue(config Interfaces.LoggingConfig, now time.Time) bool {
+	interval := config.Interval
+	if interval <= 0 {
+		interval = logger.Interval
+	}
 
-		if _, ok := logger.loggingInfo.info[stns[index].Name]; ok {
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+	lastLogTime, ok := logger.lastLogTimes[config.StationName]
+	if !ok {
+		logger.lastLogTimes[config.StationName] = now
+		return false
+	}
+	return lastLogTime.Before(now.Truncate(time.Duration(interval) * time.Minute))
+}
 
-		} else {
-			fmt.Println(ok)
-			station := LoggingMetaInfo{
-				stationName:    stns[index].Name,
-				loggingEnabled: false,
-				stationID:      stns[index].StationID,
-				lastLogTime:    time.Now()}
+//LogStations logs the readings uploaded during the interval by every enabled station whose logging interval has passed.
+//Each sensor is logged as a single statistic of its readings, chosen by its ObservedProperty (see Statistics).
+func (logger *Logger) LogStations() {
+	now := time.Now()
+	configs, err := logger.GetLoggingSettings()
+	if err != nil {
+		fmt.Println("Logger: failed to get the logging settings: ", err)
+		return
+	}
 
-			fmt.Println("Logger: created new station", station)
-			logger.loggingInfo.info[station.stationName] = station
+	for _, config := range configs {
+		if !logger.isDue(config, now) {
+			continue
+		}
+		key := config.StationName
 
+		logger.lock.Lock()
+		logger.lastLogTimes[key] = now
+		logger.lock.Unlock()
+
+		// the interval is over even for stations that are not logged, so their readings do not carry over once logging is enabled
+		stn := logger.takeIntervalReadings(key, now.UTC())
+		if config.Enabled {
+			logger.logIntervalReadings(stn, config)
 		}
 	}
-	fmt.Println("Logger: New station meta info ", logger.loggingInfo.info)
+}
 
-	/*
-		for stnIndex := range logger.data.GetStations() {
+//logIntervalReadings logs the station's interval readings that the logging settings include
+func (logger *Logger) logIntervalReadings(stn Interfaces.StationUploadTemplate, config Interfaces.LoggingConfig) {
+	fmt.Println("Logger: Attempting to log station: ", stn.StationName)
+	if len(stn.SensorReadings) == 0 {
+		fmt.Println("Logger: no readings were uploaded during the interval, not logging station: ", stn.StationName)
+		return
+	}
+	if !logger.LogDerivedValues {
+		stn = withoutDerivedReadings(stn)
+	}
+	stn = withLoggedSensors(stn, config)
+	if len(stn.SensorReadings) == 0 {
+		return
+	}
+
+	fmt.Println("Logger: Logging conditions")
+	if err := logger.data.LogConditions(&stn); err != nil {
+		fmt.Println("Logger: failed to log station: ", stn.StationName, err)
+	}
+}
 
+//withoutDerivedReadings returns a copy of the station's readings with the readings computed by Cyclone removed
+func withoutDerivedReadings(stn Interfaces.StationUploadTemplate) Interfaces.StationUploadTemplate {
+	readings := make(map[string]Interfaces.SensorReading, len(stn.SensorReadings))
+	for sensorName, reading := range stn.SensorReadings {
+		if !reading.Derived {
+			readings[sensorName] = reading
 		}
-	*/
+	}
+	stn.SensorReadings = readings
+	return stn
 }
 
-func (logger *Logger) LogStations() {
-	fmt.Println("Logger: Logging station data", time.Now())
-	for key := range logger.loggingInfo.info {
-		fmt.Println("Logger: Attempting to log station: ", key)
-		// if the station came from the database then we do not want to log it
-		//if val.stationID == -1 {
-		fmt.Println("Logger: getting current sensor readings")
-		stn := logger.data.GetCurrentSensorReadings(key)
-		fmt.Println("Logger: Logging conditions")
-		logger.data.LogConditions(&stn)
-		//}
+//withLoggedSensors returns a copy of the station's readings with only the sensors the logging settings include
+func withLoggedSensors(stn Interfaces.StationUploadTemplate, config Interfaces.LoggingConfig) Interfaces.StationUploadTemplate {
+	readings := make(map[string]Interfaces.SensorReading, len(stn.SensorReadings))
+	for sensorName, reading := range stn.SensorReadings {
+		if (len(config.IncludeSensors) == 0 || containsSensor(config.IncludeSensors, sensorName)) && !containsSensor(config.ExcludeSensors, sensorName) {
+			readings[sensorName] = reading
+		}
+	}
+	stn.SensorReadings = readings
+	return stn
+}
 
+func containsSensor(sensorNames []string, sensorName string) bool {
+	for _, name := range sensorNames {
+		if name == sensorName {
+			return true
+		}
 	}
+	return false
 }
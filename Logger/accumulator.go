@@ -0,0 +1,205 @@
+package Logger
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Josiah-B/Cyclone/Interfaces"
+)
+
+// DefaultStatistics is used for ObservedProperties that are not in Logger.Statistics; properties in neither are averaged
+var DefaultStatistics = map[string]string{
+	"windgust":             Interfaces.StatisticMax,
+	"maxdailygust":         Interfaces.StatisticMax,
+	"winddirection":        Interfaces.StatisticVectorAvg,
+	"winddirectionavg2m":   Interfaces.StatisticVectorAvg,
+	"windgustdirection":    Interfaces.StatisticVectorAvg,
+	"windgustdirection10m": Interfaces.StatisticVectorAvg,
+	"rain":                 Interfaces.StatisticSum,
+	"hourlyrain":           Interfaces.StatisticLast,
+	"dailyrain":            Interfaces.StatisticLast,
+	"eventrain":            Interfaces.StatisticLast,
+	"weeklyrain":           Interfaces.StatisticLast,
+	"monthlyrain":          Interfaces.StatisticLast,
+	"yearlyrain":           Interfaces.StatisticLast,
+	"totalrain":            Interfaces.StatisticLast,
+	"lightningstrikes":     Interfaces.StatisticLast,
+}
+
+// sensorAccumulator collects a sensor's readings over the logging interval
+type sensorAccumulator struct {
+	samples int
+	count   int
+	sum     float64
+	min     float64
+	max     float64
+	sumSin  float64
+	sumCos  float64
+	last    Interfaces.SensorReading
+	// lastValue is the value of the last numeric reading; 'last' can be a Raw reading that has no value
+	lastValue float64
+	// lastUpdated is the update time of the last reading added; it is kept between intervals so no reading is counted twice
+	lastUpdated time.Time
+}
+
+// add includes the reading in the interval unless it has already been added
+func (acc *sensorAccumulator) add(reading Interfaces.SensorReading, updated time.Time) {
+	if !updated.After(acc.lastUpdated) {
+		return
+	}
+	acc.lastUpdated = updated
+	acc.samples++
+	acc.last = reading
+	if reading.Value == nil {
+		return
+	}
+
+	value := *reading.Value
+	acc.lastValue = value
+	if acc.count == 0 || value < acc.min {
+		acc.min = value
+	}
+	if acc.count == 0 || value > acc.max {
+		acc.max = value
+	}
+	acc.count++
+	acc.sum += value
+	radians := value * math.Pi / 180
+	acc.sumSin += math.Sin(radians)
+	acc.sumCos += math.Cos(radians)
+}
+
+// reset starts a new interval
+func (acc *sensorAccumulator) reset() {
+	*acc = sensorAccumulator{lastUpdated: acc.lastUpdated}
+}
+
+// value returns the statistic of the interval's readings
+func (acc *sensorAccumulator) value(statistic string) float64 {
+	switch statistic {
+	case Interfaces.StatisticMin:
+		return acc.min
+	case Interfaces.StatisticMax:
+		return acc.max
+	case Interfaces.StatisticSum:
+		return acc.sum
+	case Interfaces.StatisticLast:
+		return acc.lastValue
+	case Interfaces.StatisticVectorAvg:
+		// opposite directions cancel out and have no average, use the last one
+		if math.Abs(acc.sumSin) < 1e-9 && math.Abs(acc.sumCos) < 1e-9 {
+			return acc.lastValue
+		}
+		// round off the floating point error so north does not come out as 359.99999999999997
+		degrees := math.Round(math.Atan2(acc.sumSin, acc.sumCos)*180/math.Pi*1e6) / 1e6
+		if degrees < 0 {
+			degrees += 360
+		}
+		return math.Mod(degrees, 360)
+	default:
+		return acc.sum / float64(acc.count)
+	}
+}
+
+// CurrentReadingsSet adds every sensor that was updated to the station's readings for the current interval
+func (logger *Logger) CurrentReadingsSet(currentConditions Interfaces.StationUploadTemplate) {
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+
+	sensors, ok := logger.accumulators[currentConditions.StationName]
+	if !ok {
+		sensors = make(map[string]*sensorAccumulator)
+		logger.accumulators[currentConditions.StationName] = sensors
+	}
+
+	now := time.Now()
+	for sensorName, reading := range currentConditions.SensorReadings {
+		updated := now
+		if status, ok := currentConditions.SensorStatus[sensorName]; ok {
+			updated = status.LastUpdated
+		}
+
+		acc, ok := sensors[sensorName]
+		if !ok {
+			acc = &sensorAccumulator{}
+			sensors[sensorName] = acc
+		}
+		acc.add(reading, updated)
+	}
+}
+
+// takeIntervalReadings returns the statistics of the readings the station uploaded during the interval and starts a new interval
+func (logger *Logger) takeIntervalReadings(stationName string, timeStamp time.Time) Interfaces.StationUploadTemplate {
+	// copy the accumulators so the database is not queried while holding the lock
+	logger.lock.Lock()
+	accumulators := make(map[string]sensorAccumulator)
+	for sensorName, acc := range logger.accumulators[stationName] {
+		if acc.samples > 0 {
+			accumulators[sensorName] = *acc
+		}
+		acc.reset()
+	}
+	logger.lock.Unlock()
+
+	stn := Interfaces.StationUploadTemplate{
+		StationName:    stationName,
+		TimeStamp:      timeStamp,
+		SensorReadings: make(map[string]Interfaces.SensorReading, len(accumulators))}
+	if len(accumulators) == 0 {
+		return stn
+	}
+
+	station, _ := logger.data.GetStationByName(stationName)
+	for sensorName, acc := range accumulators {
+		reading := acc.last
+		if acc.count == 0 {
+			// sensors that do not report numbers log their last reading
+			stn.SensorReadings[sensorName] = reading
+			continue
+		}
+
+		statistic := logger.statisticFor(logger.propertyName(station, sensorName))
+		value := acc.value(statistic)
+		reading.Value = &value
+		stn.SensorReadings[sensorName] = reading
+
+		if logger.LogMinMax && statistic == Interfaces.StatisticAvg {
+			min, max := acc.min, acc.max
+			stn.SensorReadings[sensorName+"Min"] = Interfaces.SensorReading{Value: &min, Unit: reading.Unit, Derived: reading.Derived}
+			stn.SensorReadings[sensorName+"Max"] = Interfaces.SensorReading{Value: &max, Unit: reading.Unit, Derived: reading.Derived}
+		}
+	}
+	return stn
+}
+
+// propertyName returns the name of the ObservedProperty of the sensor's data stream, or the sensor name if it does not have one
+func (logger *Logger) propertyName(station *Interfaces.Station, sensorName string) string {
+	if station == nil {
+		return sensorName
+	}
+	dataStream, err := logger.data.GetDataStreamBySensorName(sensorName, int64(station.StationID))
+	if err != nil {
+		return sensorName
+	}
+	property, err := logger.data.GetObservedProperty(strconv.Itoa(dataStream.ObservedPropertyID))
+	if err != nil {
+		return sensorName
+	}
+	return property.Name
+}
+
+// statisticFor returns the statistic to log for the ObservedProperty, ignoring case, spaces and underscores
+func (logger *Logger) statisticFor(property string) string {
+	property = strings.ToLower(strings.NewReplacer(" ", "", "_", "").Replace(property))
+	for name, statistic := range logger.Statistics {
+		if strings.ToLower(strings.NewReplacer(" ", "", "_", "").Replace(name)) == property {
+			return statistic
+		}
+	}
+	if statistic, ok := DefaultStatistics[property]; ok {
+		return statistic
+	}
+	return Interfaces.StatisticAvg
+}
@@ -0,0 +1,398 @@
+/*
+	MQTTBridge subscribes to MQTT topics and turns the messages published by stations (rtl_433, ESPHome, Tasmota...)
+	into current sensor readings, the same as an upload to the setCurrentConditions route.
+	It can also publish every station's current readings back to the broker, along with Home Assistant discovery config messages.
+*/
+package MQTTBridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Josiah-B/Cyclone/Interfaces"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Bridge holds the connection to the broker and the state of each subscription
+type Bridge struct {
+	config Config
+	data   Interfaces.Storage
+	client mqtt.Client
+
+	lock          sync.Mutex
+	status        Status
+	reconnecting  bool
+	stop          chan struct{}
+	subscriptions []subscriptionState
+	// discovered holds the topics of the discovery config messages published since the bridge last connected
+	discovered map[string]bool
+	// published holds the reading last published to each state topic, so readings that have not changed are not published again
+	published map[string]publishedReading
+}
+
+// publishedReading is a reading's value and the time it was last updated, as it was published
+type publishedReading struct {
+	lastUpdated time.Time
+	value       string
+}
+
+// Status reports the state of the bridge's connection and subscriptions
+type Status struct {
+	Enabled    bool
+	Publishing bool
+	Broker     string
+	Connected  bool
+	// LastConnected is the time the bridge last connected to the broker
+	LastConnected time.Time
+	LastError     string `json:",omitempty"`
+	// ReconnectAttempts counts the failed attempts since the connection was lost; NextReconnect is when the next attempt is made
+	ReconnectAttempts int
+	NextReconnect     *time.Time `json:",omitempty"`
+	Subscriptions     []SubscriptionStatus
+}
+
+// SubscriptionStatus reports the state of a single subscription
+type SubscriptionStatus struct {
+	Topic       string
+	Filter      string
+	Subscribed  bool
+	Messages    int
+	LastMessage time.Time
+	LastError   string `json:",omitempty"`
+}
+
+type subscriptionState struct {
+	Subscription
+	status SubscriptionStatus
+}
+
+// NewBridge creates a bridge that stores the readings it receives in 'storage'. Start must be called to connect to the broker.
+func NewBridge(config Config, storage Interfaces.Storage) (*Bridge, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	bridge := &Bridge{config: config, data: storage, stop: make(chan struct{}), discovered: make(map[string]bool), published: make(map[string]publishedReading)}
+	bridge.status.Enabled = true
+	bridge.status.Publishing = config.Publish != nil
+	bridge.status.Broker = config.Broker
+	for _, sub := range config.Subscriptions {
+		bridge.subscriptions = append(bridge.subscriptions, subscriptionState{
+			Subscription: sub,
+			status:       SubscriptionStatus{Topic: sub.Topic, Filter: sub.Filter()}})
+	}
+
+	options := mqtt.NewClientOptions().
+		AddBroker(config.Broker).
+		SetClientID(config.ClientID).
+		SetUsername(config.Username).
+		SetPassword(config.Password).
+		SetAutoReconnect(false). // reconnects are handled by the bridge so they can be reported in the status
+		SetOnConnectHandler(bridge.onConnect).
+		SetConnectionLostHandler(bridge.onConnectionLost)
+	if config.Publish != nil {
+		options.SetWill(config.Publish.availabilityTopic(), "offline", config.Publish.QoS, true)
+	}
+	bridge.client = mqtt.NewClient(options)
+
+	return bridge, nil
+}
+
+// Start connects to the broker in the background, retrying until it succeeds or Stop is called
+func (bridge *Bridge) Start() {
+	go bridge.connect()
+}
+
+// Stop disconnects from the broker and cancels any pending reconnect
+func (bridge *Bridge) Stop() {
+	bridge.lock.Lock()
+	select {
+	case <-bridge.stop:
+	default:
+		close(bridge.stop)
+	}
+	bridge.lock.Unlock()
+
+	if bridge.config.Publish != nil && bridge.client.IsConnected() {
+		bridge.client.Publish(bridge.config.Publish.availabilityTopic(), bridge.config.Publish.QoS, true, "offline").Wait()
+	}
+	bridge.client.Disconnect(250)
+}
+
+// Status returns the state of the bridge; a nil bridge reports that it is not enabled
+func (bridge *Bridge) Status() Status {
+	if bridge == nil {
+		return Status{}
+	}
+
+	bridge.lock.Lock()
+	defer bridge.lock.Unlock()
+
+	status := bridge.status
+	status.Subscriptions = make([]SubscriptionStatus, len(bridge.subscriptions))
+	for i, sub := range bridge.subscriptions {
+		status.Subscriptions[i] = sub.status
+	}
+	return status
+}
+
+// connect tries to connect to the broker, doubling the delay between attempts each time one fails
+func (bridge *Bridge) connect() {
+	bridge.lock.Lock()
+	if bridge.reconnecting {
+		bridge.lock.Unlock()
+		return
+	}
+	bridge.reconnecting = true
+	bridge.lock.Unlock()
+
+	defer func() {
+		bridge.lock.Lock()
+		bridge.reconnecting = false
+		bridge.status.NextReconnect = nil
+		bridge.lock.Unlock()
+	}()
+
+	delay, maxDelay := bridge.config.reconnectDelays()
+	for {
+		select {
+		case <-bridge.stop:
+			return
+		default:
+		}
+
+		token := bridge.client.Connect()
+		token.Wait()
+		err := token.Error()
+		if err == nil {
+			return
+		}
+
+		next := time.Now().Add(delay)
+		bridge.lock.Lock()
+		bridge.status.LastError = err.Error()
+		bridge.status.ReconnectAttempts++
+		bridge.status.NextReconnect = &next
+		bridge.lock.Unlock()
+		fmt.Println("MQTT bridge failed to connect to", bridge.config.Broker, ":", err, "- retrying in", delay)
+
+		select {
+		case <-bridge.stop:
+			return
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+}
+
+// onConnect subscribes to every topic; it runs after each successful connect so subscriptions are restored after a reconnect
+func (bridge *Bridge) onConnect(client mqtt.Client) {
+	bridge.lock.Lock()
+	bridge.status.Connected = true
+	bridge.status.LastConnected = time.Now()
+	bridge.status.ReconnectAttempts = 0
+	bridge.discovered = make(map[string]bool)
+	bridge.lock.Unlock()
+	fmt.Println("MQTT bridge connected to", bridge.config.Broker)
+
+	if bridge.config.Publish != nil {
+		client.Publish(bridge.config.Publish.availabilityTopic(), bridge.config.Publish.QoS, true, "online")
+	}
+
+	for i := range bridge.subscriptions {
+		index := i
+		sub := bridge.subscriptions[i].Subscription
+		token := client.Subscribe(sub.Filter(), sub.QoS, func(client mqtt.Client, msg mqtt.Message) {
+			bridge.onMessage(index, msg)
+		})
+		token.Wait()
+
+		bridge.lock.Lock()
+		bridge.subscriptions[index].status.Subscribed = token.Error() == nil
+		if token.Error() != nil {
+			bridge.subscriptions[index].status.LastError = token.Error().Error()
+			fmt.Println("MQTT bridge failed to subscribe to", sub.Filter(), ":", token.Error())
+		}
+		bridge.lock.Unlock()
+	}
+}
+
+// onConnectionLost marks the subscriptions as inactive and starts reconnecting
+func (bridge *Bridge) onConnectionLost(client mqtt.Client, err error) {
+	bridge.lock.Lock()
+	bridge.status.Connected = false
+	bridge.status.LastError = err.Error()
+	for i := range bridge.subscriptions {
+		bridge.subscriptions[i].status.Subscribed = false
+	}
+	bridge.lock.Unlock()
+	fmt.Println("MQTT bridge lost the connection to", bridge.config.Broker, ":", err)
+
+	go bridge.connect()
+}
+
+// onMessage stores the readings of a message received from the broker
+func (bridge *Bridge) onMessage(index int, msg mqtt.Message) {
+	bridge.receive(index, msg.Topic(), msg.Payload())
+}
+
+// Ingest stores the payload of a message published to 'topic' using the first subscription whose topic matches.
+// It is used for messages received from the broker, and can be called directly to feed messages in without one.
+func (bridge *Bridge) Ingest(topic string, payload []byte) error {
+	for i := range bridge.subscriptions {
+		if topicMatches(bridge.subscriptions[i].Filter(), topic) {
+			return bridge.receive(i, topic, payload)
+		}
+	}
+	return Interfaces.ValidationError("no subscription matches the topic '%v'", topic)
+}
+
+// receive stores the readings of a message and records the result against the subscription at 'index'
+func (bridge *Bridge) receive(index int, topic string, payload []byte) error {
+	err := bridge.ingest(&bridge.subscriptions[index].Subscription, topic, payload)
+
+	bridge.lock.Lock()
+	defer bridge.lock.Unlock()
+	status := &bridge.subscriptions[index].status
+	status.Messages++
+	status.LastMessage = time.Now()
+	if err != nil {
+		status.LastError = err.Error()
+		fmt.Println("MQTT bridge could not store the message from", topic, ":", err)
+	}
+	return err
+}
+
+// ingest converts the payload to readings and merges them into the station's current readings
+func (bridge *Bridge) ingest(sub *Subscription, topic string, payload []byte) error {
+	stationName, sensorName := sub.names(topic)
+	if stationName == "" {
+		return Interfaces.ValidationError("no station name could be found for the topic '%v'", topic)
+	}
+
+	readings, err := parsePayload(sub, sensorName, payload)
+	if err != nil {
+		return err
+	}
+	if len(readings) == 0 {
+		return nil
+	}
+
+	// sensors are often published to their own topics; the readings are merged into the ones the station has already sent
+	upload := Interfaces.StationUploadTemplate{StationName: stationName, TimeStamp: time.Now().UTC(), SensorReadings: readings}
+	return bridge.data.SetCurrentSensorReadings(upload)
+}
+
+// parsePayload converts a scalar or JSON payload into readings keyed by sensor name
+func parsePayload(sub *Subscription, sensorName string, payload []byte) (map[string]Interfaces.SensorReading, error) {
+	readings := make(map[string]Interfaces.SensorReading)
+	payload = bytes.TrimSpace(payload)
+
+	var fields map[string]interface{}
+	if len(payload) > 0 && payload[0] == '{' {
+		decoder := json.NewDecoder(bytes.NewReader(payload))
+		decoder.UseNumber()
+		if err := decoder.Decode(&fields); err != nil {
+			return nil, Interfaces.ValidationError("the payload is not valid JSON: %v", err)
+		}
+	} else {
+		if sensorName == "" {
+			return nil, Interfaces.ValidationError("a scalar payload needs a SensorName or a %v placeholder in the topic", sensorPlaceholder)
+		}
+		reading, err := scalarReading(string(bytes.Trim(payload, `"`)), sub.Unit)
+		if err != nil {
+			return nil, err
+		}
+		readings[sensorName] = reading
+		return readings, nil
+	}
+
+	flattened := make(map[string]interface{})
+	flattenFields("", fields, flattened)
+
+	if len(sub.Fields) > 0 {
+		for field, name := range sub.Fields {
+			if value, ok := flattened[field]; ok {
+				reading, err := scalarReading(fmt.Sprint(value), sub.Unit)
+				if err != nil {
+					return nil, fmt.Errorf("%v: %w", field, err)
+				}
+				readings[name] = reading
+			}
+		}
+		return readings, nil
+	}
+
+	keys := make([]string, 0, len(flattened))
+	for key := range flattened {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		number, ok := flattened[key].(json.Number)
+		if !ok {
+			continue
+		}
+		reading, err := Interfaces.ParseSensorReading(number.String())
+		if err != nil || !reading.IsNumeric() {
+			continue
+		}
+		reading.Unit = sub.Unit
+		name := key
+		if sensorName != "" {
+			name = sensorName + "." + key
+		}
+		readings[name] = reading
+	}
+	return readings, nil
+}
+
+// scalarReading converts text to a numeric reading, or to a raw text reading if it is not a number
+func scalarReading(text string, unit string) (Interfaces.SensorReading, error) {
+	reading, err := Interfaces.ParseSensorReading(text)
+	if err != nil {
+		return reading, err
+	}
+	if reading.IsNumeric() {
+		reading.Unit = unit
+	}
+	return reading, nil
+}
+
+// flattenFields copies the values of nested objects into 'out', joining the keys with '.'
+func flattenFields(prefix string, fields map[string]interface{}, out map[string]interface{}) {
+	for key, value := range fields {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			flattenFields(key, nested, out)
+		} else {
+			out[key] = value
+		}
+	}
+}
+
+// topicMatches reports whether 'topic' matches the MQTT topic filter 'filter'
+func topicMatches(filter string, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) || (level != "+" && level != topicLevels[i]) {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
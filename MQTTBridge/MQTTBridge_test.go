@@ -0,0 +1,148 @@
+package MQTTBridge
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Josiah-B/Cyclone/Interfaces"
+)
+
+// readingStorage records the uploads stored by the bridge; calling any other storage method panics
+type readingStorage struct {
+	Interfaces.Storage
+	uploads []Interfaces.StationUploadTemplate
+}
+
+func (storage *readingStorage) SetCurrentSensorReadings(currentSensorReadings Interfaces.StationUploadTemplate) error {
+	storage.uploads = append(storage.uploads, currentSensorReadings)
+	return nil
+}
+
+func TestTopicMatches(t *testing.T) {
+	tests := []struct {
+		filter string
+		topic  string
+		want   bool
+	}{
+		{"weather/temp", "weather/temp", true},
+		{"weather/temp", "weather/humidity", false},
+		{"weather/+/state", "weather/temp/state", true},
+		{"weather/+/state", "weather/temp/other", false},
+		{"weather/+", "weather/temp/state", false},
+		{"weather/#", "weather/temp/state", true},
+		{"weather/#", "weather", true}, // '#' also matches the parent level
+		{"#", "anything/at/all", true},
+		{"weather/temp/state", "weather/temp", false},
+	}
+	for _, test := range tests {
+		if got := topicMatches(test.filter, test.topic); got != test.want {
+			t.Errorf("topicMatches(%v, %v) = %v, want %v", test.filter, test.topic, got, test.want)
+		}
+	}
+}
+
+func TestParsePayload(t *testing.T) {
+	tests := []struct {
+		name       string
+		sub        Subscription
+		sensorName string
+		payload    string
+		want       map[string]string
+	}{
+		{"number", Subscription{Unit: "C"}, "Temperature", "21.5", map[string]string{"Temperature": "21.5 C"}},
+		{"quoted number", Subscription{}, "Temperature", ` "21.5" `, map[string]string{"Temperature": "21.5"}},
+		{"text", Subscription{Unit: "deg"}, "WindDirection", "NNW", map[string]string{"WindDirection": "NNW"}},
+		{"json", Subscription{}, "", `{"temperature_C": 20.1, "humidity": 55, "model": "Acurite-Tower", "battery": {"level": 90}}`,
+			map[string]string{"temperature_C": "20.1", "humidity": "55", "battery.level": "90"}},
+		{"json with a sensor name", Subscription{}, "Outside", `{"temp": 20.1}`, map[string]string{"Outside.temp": "20.1"}},
+		{"json fields", Subscription{Fields: map[string]string{"temperature_C": "Temperature", "model": "Model", "missing": "Missing"}}, "",
+			`{"temperature_C": 20.1, "humidity": 55, "model": "Acurite-Tower"}`, map[string]string{"Temperature": "20.1", "Model": "Acurite-Tower"}},
+	}
+	for _, test := range tests {
+		readings, err := parsePayload(&test.sub, test.sensorName, []byte(test.payload))
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		if len(readings) != len(test.want) {
+			t.Errorf("%v: got %v, want %v", test.name, readings, test.want)
+		}
+		for sensorName, want := range test.want {
+			reading, ok := readings[sensorName]
+			got := reading.String()
+			if reading.Unit != "" {
+				got += " " + reading.Unit
+			}
+			if !ok || got != want {
+				t.Errorf("%v: got %v = '%v', want '%v'", test.name, sensorName, got, want)
+			}
+		}
+	}
+}
+
+func TestParsePayloadInvalid(t *testing.T) {
+	tests := []struct {
+		name       string
+		sensorName string
+		payload    string
+	}{
+		{"bad json", "", `{"temp": `},
+		{"scalar without a sensor", "", "21.5"},
+		{"empty", "Temperature", ""},
+		{"not finite", "Temperature", "NaN"},
+	}
+	for _, test := range tests {
+		if _, err := parsePayload(&Subscription{}, test.sensorName, []byte(test.payload)); !errors.Is(err, Interfaces.ErrValidation) {
+			t.Errorf("%v: got error %v, want %v", test.name, err, Interfaces.ErrValidation)
+		}
+	}
+}
+
+func TestIngest(t *testing.T) {
+	storage := &readingStorage{}
+	bridge, err := NewBridge(Config{
+		Broker: "tcp://localhost:1883",
+		Subscriptions: []Subscription{
+			{Topic: "esphome/{station}/sensor/{sensor}/state", Unit: "C"},
+			{Topic: "rtl_433/events", StationName: "Backyard", Fields: map[string]string{"temperature_C": "Temperature"}}}}, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = bridge.Ingest("esphome/Garden/sensor/Temperature/state", []byte("18.25")); err != nil {
+		t.Fatal(err)
+	}
+	if err = bridge.Ingest("rtl_433/events", []byte(`{"temperature_C": 20.1}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err = bridge.Ingest("esphome/Garden/sensor/Temperature/state", []byte("NaN")); !errors.Is(err, Interfaces.ErrValidation) {
+		t.Errorf("got error %v for a NaN reading, want %v", err, Interfaces.ErrValidation)
+	}
+	if err = bridge.Ingest("zigbee2mqtt/sensor", []byte("1")); !errors.Is(err, Interfaces.ErrValidation) {
+		t.Errorf("got error %v for a topic without a subscription, want %v", err, Interfaces.ErrValidation)
+	}
+
+	if len(storage.uploads) != 2 {
+		t.Fatalf("got %v uploads, want 2", len(storage.uploads))
+	}
+	garden := storage.uploads[0]
+	if reading := garden.SensorReadings["Temperature"]; garden.StationName != "Garden" || reading.String() != "18.25" || reading.Unit != "C" {
+		t.Errorf("got %v %+v, want Garden Temperature = 18.25 C", garden.StationName, garden.SensorReadings)
+	}
+	backyard := storage.uploads[1]
+	if reading := backyard.SensorReadings["Temperature"]; backyard.StationName != "Backyard" || reading.String() != "20.1" {
+		t.Errorf("got %v %+v, want Backyard Temperature = 20.1", backyard.StationName, backyard.SensorReadings)
+	}
+
+	status := bridge.Status()
+	if len(status.Subscriptions) != 2 {
+		t.Fatalf("got %v subscription statuses, want 2", len(status.Subscriptions))
+	}
+	esphome, rtl433 := status.Subscriptions[0], status.Subscriptions[1]
+	if esphome.Messages != 2 || esphome.LastError == "" || esphome.Filter != "esphome/+/sensor/+/state" {
+		t.Errorf("got esphome status %+v, want 2 messages and the last error", esphome)
+	}
+	if rtl433.Messages != 1 || rtl433.LastError != "" || rtl433.LastMessage.IsZero() {
+		t.Errorf("got rtl_433 status %+v, want 1 message without an error", rtl433)
+	}
+}
@@ -0,0 +1,150 @@
+package MQTTBridge
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Josiah-B/Cyclone/Interfaces"
+)
+
+// placeholders that can be used as a whole level of a subscription's topic
+const (
+	stationPlaceholder = "{station}"
+	sensorPlaceholder  = "{sensor}"
+)
+
+// Config holds the broker connection settings and the topics the bridge subscribes to
+type Config struct {
+	// Broker is the URL of the MQTT broker, e.g. "tcp://localhost:1883"
+	Broker   string
+	ClientID string
+	Username string
+	Password string
+	// ReconnectDelay is the delay before the first reconnect attempt, in seconds. It doubles after every failed attempt up to MaxReconnectDelay.
+	ReconnectDelay    int
+	MaxReconnectDelay int
+	Subscriptions     []Subscription
+	// Publish sends every station's current readings to the broker; nil disables publishing
+	Publish *PublishConfig `json:",omitempty"`
+}
+
+// Subscription maps an MQTT topic onto a station and sensor.
+//
+// Topic is an MQTT topic filter where a whole level may be "{station}" or "{sensor}" to take the station or sensor name from the
+// topic of each message, e.g. "esphome/{station}/sensor/{sensor}/state". Otherwise StationName and SensorName give fixed names.
+//
+// Scalar payloads are stored as a single reading for the sensor. JSON object payloads store every numeric field as its own reading
+// (nested objects are joined with '.'), prefixed with the sensor name when there is one. Fields limits an object payload to the
+// listed fields and renames them: the key is the field and the value is the sensor name to store it under.
+type Subscription struct {
+	Topic       string
+	StationName string `json:",omitempty"`
+	SensorName  string `json:",omitempty"`
+	// Unit is the unit of measure symbol of the readings, if the payload does not say
+	Unit   string            `json:",omitempty"`
+	Fields map[string]string `json:",omitempty"`
+	QoS    byte
+}
+
+// LoadConfig reads the bridge configuration from a json file
+func LoadConfig(path string) (Config, error) {
+	var config Config
+	configFile, err := os.Open(path)
+	if err != nil {
+		return config, err
+	}
+	defer configFile.Close()
+
+	err = json.NewDecoder(configFile).Decode(&config)
+	return config, err
+}
+
+// Validate checks that the configuration can be used to start a bridge
+func (config *Config) Validate() error {
+	if config.Broker == "" {
+		return Interfaces.ValidationError("the MQTT bridge needs a Broker")
+	}
+	for _, sub := range config.Subscriptions {
+		if err := sub.Validate(); err != nil {
+			return err
+		}
+		// a subscription that receives our own readings would store and publish them again forever
+		if config.Publish != nil && topicMatches(sub.Filter(), config.Publish.stateTopic("station", "sensor")) {
+			return Interfaces.ValidationError("'%v' would receive the readings published under '%v'", sub.Topic, config.Publish.topicPrefix())
+		}
+	}
+	return nil
+}
+
+// Validate checks that the subscription has a topic and a way to find the station name
+func (sub *Subscription) Validate() error {
+	if sub.Topic == "" {
+		return Interfaces.ValidationError("an MQTT subscription must have a Topic")
+	}
+	if sub.QoS > 2 {
+		return Interfaces.ValidationError("'%v' has a QoS of %v; it must be 0, 1 or 2", sub.Topic, sub.QoS)
+	}
+
+	levels := strings.Split(sub.Topic, "/")
+	for i, level := range levels {
+		if level == "#" && i != len(levels)-1 {
+			return Interfaces.ValidationError("'%v': '#' can only be used as the last level of a topic", sub.Topic)
+		}
+		if level != stationPlaceholder && level != sensorPlaceholder && strings.ContainsAny(level, "{}") {
+			return Interfaces.ValidationError("'%v': '%v' is not a known placeholder; use %v or %v", sub.Topic, level, stationPlaceholder, sensorPlaceholder)
+		}
+	}
+	if sub.StationName == "" && !strings.Contains(sub.Topic, stationPlaceholder) {
+		return Interfaces.ValidationError("'%v' needs a StationName or a %v placeholder in the topic", sub.Topic, stationPlaceholder)
+	}
+	return nil
+}
+
+// Filter returns the topic filter to subscribe to, with the placeholders replaced by single level wildcards
+func (sub *Subscription) Filter() string {
+	levels := strings.Split(sub.Topic, "/")
+	for i, level := range levels {
+		if level == stationPlaceholder || level == sensorPlaceholder {
+			levels[i] = "+"
+		}
+	}
+	return strings.Join(levels, "/")
+}
+
+// names returns the station and sensor names for a message published to 'topic'
+func (sub *Subscription) names(topic string) (stationName string, sensorName string) {
+	stationName = sub.StationName
+	sensorName = sub.SensorName
+
+	topicLevels := strings.Split(topic, "/")
+	for i, level := range strings.Split(sub.Topic, "/") {
+		if i >= len(topicLevels) {
+			break
+		}
+		switch level {
+		case stationPlaceholder:
+			stationName = topicLevels[i]
+		case sensorPlaceholder:
+			sensorName = topicLevels[i]
+		}
+	}
+	return stationName, sensorName
+}
+
+// reconnectDelays returns the first and largest delay between reconnect attempts
+func (config *Config) reconnectDelays() (time.Duration, time.Duration) {
+	first := time.Duration(config.ReconnectDelay) * time.Second
+	if first <= 0 {
+		first = time.Second
+	}
+	max := time.Duration(config.MaxReconnectDelay) * time.Second
+	if max <= 0 {
+		max = 2 * time.Minute
+	}
+	if max < first {
+		max = first
+	}
+	return first, max
+}
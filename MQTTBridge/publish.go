@@ -0,0 +1,301 @@
+package MQTTBridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Josiah-B/Cyclone/Interfaces"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// PublishConfig holds the settings for publishing current conditions to the broker
+type PublishConfig struct {
+	// TopicPrefix is the first level of every published topic; readings are published to "<TopicPrefix>/<station>/<sensor>/state"
+	TopicPrefix string
+	QoS         byte
+	Retain      bool
+	// Discovery publishes Home Assistant MQTT discovery config messages for every data stream, under DiscoveryPrefix ("homeassistant" if empty)
+	Discovery       bool
+	DiscoveryPrefix string
+}
+
+// discoveryTimeout is how long to wait in the background for a discovery config message to be sent before trying again with the next readings
+const discoveryTimeout = 5 * time.Second
+
+// haDeviceClasses maps ObservedProperty names, lower case, onto Home Assistant sensor device classes
+var haDeviceClasses = map[string]string{
+	"temperature":       "temperature",
+	"indoortemperature": "temperature",
+	"soiltemperature":   "temperature",
+	"dewpoint":          "temperature",
+	"heatindex":         "temperature",
+	"windchill":         "temperature",
+	"feelslike":         "temperature",
+	"humidity":          "humidity",
+	"indoorhumidity":    "humidity",
+	"soilmoisture":      "moisture",
+	"pressure":          "atmospheric_pressure",
+	"barometer":         "atmospheric_pressure",
+	"sealevelpressure":  "atmospheric_pressure",
+	"windspeed":         "wind_speed",
+	"windgust":          "wind_speed",
+	"maxdailygust":      "wind_speed",
+	"rainrate":          "precipitation_intensity",
+	"hourlyrain":        "precipitation",
+	"dailyrain":         "precipitation",
+	"eventrain":         "precipitation",
+	"weeklyrain":        "precipitation",
+	"monthlyrain":       "precipitation",
+	"yearlyrain":        "precipitation",
+	"totalrain":         "precipitation",
+	"solarradiation":    "irradiance",
+	"pm2.5":             "pm25",
+	"pm10":              "pm10",
+	"co2":               "carbon_dioxide",
+	"lightningdistance": "distance",
+}
+
+// haUnits maps unit symbols that Home Assistant writes differently
+var haUnits = map[string]string{
+	"C":     "°C",
+	"F":     "°F",
+	"deg":   "°",
+	"W/m2":  "W/m²",
+	"ug/m3": "µg/m³",
+	"g/m3":  "g/m³",
+}
+
+// haDiscoveryConfig is the payload of a Home Assistant MQTT discovery config message
+type haDiscoveryConfig struct {
+	Name              string   `json:"name"`
+	UniqueID          string   `json:"unique_id"`
+	StateTopic        string   `json:"state_topic"`
+	AvailabilityTopic string   `json:"availability_topic"`
+	UnitOfMeasurement string   `json:"unit_of_measurement,omitempty"`
+	DeviceClass       string   `json:"device_class,omitempty"`
+	StateClass        string   `json:"state_class,omitempty"`
+	Device            haDevice `json:"device"`
+}
+
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model,omitempty"`
+}
+
+// CurrentReadingsSet publishes the station's readings that were updated since they were last published, and the discovery config of each
+// of those sensors that has not been announced since the bridge connected. Stale readings are not published.
+// It is called from the bridge's own message handler, so it never waits for a message to be sent.
+func (bridge *Bridge) CurrentReadingsSet(currentConditions Interfaces.StationUploadTemplate) {
+	publish := bridge.config.Publish
+	if publish == nil || !bridge.client.IsConnected() {
+		return
+	}
+
+	var updated, undiscovered []string
+	bridge.lock.Lock()
+	for sensorName := range currentConditions.SensorReadings {
+		if status, ok := currentConditions.SensorStatus[sensorName]; ok {
+			topic := publish.stateTopic(currentConditions.StationName, sensorName)
+			last := publishedReading{lastUpdated: status.LastUpdated, value: currentConditions.SensorReadings[sensorName].String()}
+			if status.Stale || last == bridge.published[topic] {
+				continue
+			}
+			bridge.published[topic] = last
+		}
+		updated = append(updated, sensorName)
+		if publish.Discovery && !bridge.discovered[publish.discoveryTopic(currentConditions.StationName, sensorName)] {
+			undiscovered = append(undiscovered, sensorName)
+		}
+	}
+	bridge.lock.Unlock()
+
+	if len(undiscovered) > 0 {
+		if err := bridge.publishDiscovery(currentConditions, undiscovered); err != nil {
+			fmt.Println("MQTT bridge could not publish the discovery config for", currentConditions.StationName, ":", err)
+		}
+	}
+
+	for _, sensorName := range updated {
+		reading := currentConditions.SensorReadings[sensorName]
+		bridge.client.Publish(publish.stateTopic(currentConditions.StationName, sensorName), publish.QoS, publish.Retain, reading.String())
+	}
+}
+
+// publishDiscovery publishes a Home Assistant discovery config message for each of the named sensors of the station.
+// A sensor is marked as discovered while its message is sent; the mark is removed if sending fails, so it is retried with the next readings.
+func (bridge *Bridge) publishDiscovery(currentConditions Interfaces.StationUploadTemplate, sensorNames []string) error {
+	stn, err := bridge.data.GetStationByName(currentConditions.StationName)
+	if err != nil {
+		return err
+	}
+	streams, err := bridge.stationStreams(stn.StationID)
+	if err != nil {
+		return err
+	}
+
+	device := haDevice{
+		Identifiers:  []string{"cyclone_" + strconv.Itoa(stn.StationID)},
+		Name:         stn.Name,
+		Manufacturer: "Cyclone",
+		Model:        stn.Description}
+
+	for _, sensorName := range sensorNames {
+		config := bridge.discoveryConfig(stn.Name, sensorName, device)
+		if dataStream, ok := streams[sensorName]; ok && !currentConditions.SensorReadings[sensorName].Derived {
+			config.UniqueID = fmt.Sprintf("cyclone_%v_%v", stn.StationID, dataStream.StreamID)
+
+			propertyName := sensorName
+			if property, err := bridge.data.GetObservedProperty(strconv.Itoa(dataStream.ObservedPropertyID)); err == nil {
+				propertyName = property.Name
+			}
+			var unitOfMeasure string
+			if unit, err := bridge.data.GetUnitType(strconv.Itoa(dataStream.UnitTypeID)); err == nil {
+				unitOfMeasure = unit.UnitOfMeasure
+			}
+			setDeviceClass(&config, propertyName, unitOfMeasure)
+		} else {
+			// derived readings, and readings uploaded without a data stream, are described from the reading itself
+			reading := currentConditions.SensorReadings[sensorName]
+			config.UniqueID = fmt.Sprintf("cyclone_%v_%v", stn.StationID, discoveryID(sensorName))
+			setDeviceClass(&config, sensorName, reading.Unit)
+		}
+
+		if err = bridge.publishDiscoveryConfig(bridge.config.Publish.discoveryTopic(stn.Name, sensorName), config); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stationStreams returns the station's data streams by sensor name
+func (bridge *Bridge) stationStreams(stationID int) (map[string]Interfaces.DataStream, error) {
+	streams, err := bridge.data.GetDataStreams()
+	if err != nil {
+		return nil, err
+	}
+
+	stationStreams := make(map[string]Interfaces.DataStream)
+	for _, dataStream := range *streams {
+		if dataStream.StationID != stationID {
+			continue
+		}
+		sensor, err := bridge.data.GetSensor(strconv.Itoa(dataStream.SensorID))
+		if err != nil {
+			return nil, err
+		}
+		stationStreams[sensor.Name] = dataStream
+	}
+	return stationStreams, nil
+}
+
+// discoveryConfig fills in the parts of a discovery config that are the same for every sensor
+func (bridge *Bridge) discoveryConfig(stationName string, sensorName string, device haDevice) haDiscoveryConfig {
+	return haDiscoveryConfig{
+		Name:              sensorName,
+		StateTopic:        bridge.config.Publish.stateTopic(stationName, sensorName),
+		AvailabilityTopic: bridge.config.Publish.availabilityTopic(),
+		Device:            device}
+}
+
+// publishDiscoveryConfig sends a retained discovery config message so Home Assistant finds it after restarting.
+// The topic is marked as discovered straight away and the message is waited for in the background.
+func (bridge *Bridge) publishDiscoveryConfig(topic string, config haDiscoveryConfig) error {
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	bridge.lock.Lock()
+	bridge.discovered[topic] = true
+	bridge.lock.Unlock()
+
+	token := bridge.client.Publish(topic, bridge.config.Publish.QoS, true, payload)
+	go bridge.awaitDiscovery(topic, token)
+	return nil
+}
+
+// awaitDiscovery waits for a discovery config message to be sent, and removes the topic's discovered mark if it was not
+func (bridge *Bridge) awaitDiscovery(topic string, token mqtt.Token) {
+	var err error
+	if !token.WaitTimeout(discoveryTimeout) {
+		err = fmt.Errorf("timed out publishing to '%v'", topic)
+	} else {
+		err = token.Error()
+	}
+	if err == nil {
+		return
+	}
+
+	bridge.lock.Lock()
+	delete(bridge.discovered, topic)
+	bridge.lock.Unlock()
+	fmt.Println("MQTT bridge could not publish the discovery config", topic, ":", err)
+}
+
+// setDeviceClass sets the device class, state class and unit of the config from the sensor's ObservedProperty and unit of measure
+func setDeviceClass(config *haDiscoveryConfig, propertyName string, unitOfMeasure string) {
+	config.UnitOfMeasurement = unitOfMeasure
+	if symbol, ok := haUnits[unitOfMeasure]; ok {
+		config.UnitOfMeasurement = symbol
+	}
+
+	config.DeviceClass = haDeviceClasses[strings.ToLower(propertyName)]
+	switch {
+	case config.DeviceClass == "precipitation":
+		config.StateClass = "total_increasing"
+	case config.UnitOfMeasurement != "":
+		config.StateClass = "measurement"
+	}
+}
+
+// stateTopic returns the topic a sensor's readings are published to
+func (publish *PublishConfig) stateTopic(stationName string, sensorName string) string {
+	return publish.topicPrefix() + "/" + topicLevel(stationName) + "/" + topicLevel(sensorName) + "/state"
+}
+
+// availabilityTopic returns the topic that holds "online" while the bridge is connected and "offline" otherwise
+func (publish *PublishConfig) availabilityTopic() string {
+	return publish.topicPrefix() + "/status"
+}
+
+// discoveryTopic returns the topic of a sensor's discovery config message
+func (publish *PublishConfig) discoveryTopic(stationName string, sensorName string) string {
+	return fmt.Sprintf("%v/sensor/cyclone_%v/%v/config", publish.discoveryPrefix(), discoveryID(stationName), discoveryID(sensorName))
+}
+
+func (publish *PublishConfig) topicPrefix() string {
+	if publish.TopicPrefix == "" {
+		return "cyclone"
+	}
+	return strings.TrimSuffix(publish.TopicPrefix, "/")
+}
+
+func (publish *PublishConfig) discoveryPrefix() string {
+	if publish.DiscoveryPrefix == "" {
+		return "homeassistant"
+	}
+	return strings.TrimSuffix(publish.DiscoveryPrefix, "/")
+}
+
+// topicLevel replaces the characters that can not be used inside a single topic level
+func topicLevel(name string) string {
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(name)
+}
+
+// discoveryID converts a name to the characters Home Assistant allows in node and object IDs
+func discoveryID(name string) string {
+	var id strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' || r == '-' {
+			id.WriteRune(r)
+		} else {
+			id.WriteRune('_')
+		}
+	}
+	return id.String()
+}
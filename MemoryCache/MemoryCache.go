@@ -5,8 +5,11 @@ package MemoryCache
 
 import (
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/Josiah-B/Cyclone/CurrentDeviceData"
+	"github.com/Josiah-B/Cyclone/Derived"
 	"github.com/Josiah-B/Cyclone/Interfaces"
 	"github.com/Josiah-B/Cyclone/SQLiteDatabase"
 )
@@ -17,32 +20,110 @@ type Cache struct {
 	//This is our memory cache for the current sensor readings
 	currentData  CurrentDeviceData.Data
 	DataBasePath string
+	//Derivers computes the derived readings (dew point, wind chill...) that are added to every upload; nil disables them
+	Derivers *Derived.Registry
+	//Listeners are notified after a station's current readings are set
+	Listeners []Interfaces.CurrentReadingsListener
+	//StaleAfter is how long a sensor can go without an update before its current reading is marked stale; 0 never marks readings stale
+	StaleAfter time.Duration
 }
 
-func (cache *Cache) Initilize() {
+func (cache *Cache) Initilize() error {
 	//cache.database = SQLiteDatabase.DataBase{}
 
+	//setup memory cache for the current weather conditions
+	cache.currentData = CurrentDeviceData.Data{StaleAfter: cache.StaleAfter}
+
 	cache.database.Configuration = SQLiteDatabase.SqliteSettings{Path: cache.DataBasePath}
-	cache.database.Initilize()
-	cache.database.Open()
+	if err := cache.database.Initilize(); err != nil {
+		return err
+	}
+	return cache.database.Open()
+}
 
-	//setup memory cache for the current weather conditions
-	cache.currentData = CurrentDeviceData.Data{}
+//Close closes the database; the current sensor readings held in memory are lost
+func (cache *Cache) Close() error {
+	return cache.database.Close()
 }
 
 //GetCurrentSensorReadings returns the current sensor readings for the specified weather station
-func (cache *Cache) GetCurrentSensorReadings(StationName string) Interfaces.StationUploadTemplate {
-	return cache.currentData.GetCurrentSensorReadings(StationName)
+func (cache *Cache) GetCurrentSensorReadings(StationName string) (Interfaces.StationUploadTemplate, error) {
+	readings, ok := cache.currentData.GetCurrentSensorReadings(StationName)
+	if !ok {
+		return readings, Interfaces.NotFoundError("current conditions for station", StationName)
+	}
+	return readings, nil
+}
+
+//GetAllCurrentSensorReadings returns the current sensor readings of every station that has uploaded
+func (cache *Cache) GetAllCurrentSensorReadings() ([]Interfaces.StationUploadTemplate, error) {
+	return cache.currentData.GetAllCurrentSensorReadings(), nil
 }
 
-//SetCurrentSensorReadings stores the current sensor readings in memory
-func (cache *Cache) SetCurrentSensorReadings(currentConditions Interfaces.StationUploadTemplate) {
-	cache.currentData.SetCurrentSensorReadings(&currentConditions)
+//SetCurrentSensorReadings merges the uploaded sensor readings into the station's current readings held in memory, or replaces them if the upload has Replace set.
+//The derived readings are then computed from the merged readings; if another upload is merged meanwhile only its derived readings are kept.
+func (cache *Cache) SetCurrentSensorReadings(currentConditions Interfaces.StationUploadTemplate) error {
+	if err := currentConditions.Validate(); err != nil {
+		return err
+	}
+	merged, sequence := cache.currentData.SetCurrentSensorReadings(&currentConditions)
+
+	// compute the derived readings from the uploaded readings only, so derived readings that can no longer be computed are removed
+	derived, sources := cache.deriveReadings(merged)
+	if stn, ok := cache.currentData.SetDerivedReadings(currentConditions.StationName, sequence, derived, sources); ok {
+		merged = stn
+	}
+
+	for _, listener := range cache.Listeners {
+		listener.CurrentReadingsSet(merged)
+	}
+	return nil
+}
+
+// deriveReadings runs the derivers on the station's uploaded readings that are not stale, and returns the derived readings along with the sensors
+// each one was computed from. Readings uploaded by the station are never replaced by derived ones.
+func (cache *Cache) deriveReadings(currentConditions Interfaces.StationUploadTemplate) (map[string]Interfaces.SensorReading, map[string][]string) {
+	derived := make(map[string]Interfaces.SensorReading)
+	sources := make(map[string][]string)
+	if cache.Derivers == nil {
+		return derived, sources
+	}
+
+	stn, _ := cache.database.GetStationByName(currentConditions.StationName)
+
+	var inputs []Derived.Input
+	for sensorName, reading := range currentConditions.SensorReadings {
+		if reading.Value == nil || reading.Derived || currentConditions.SensorStatus[sensorName].Stale {
+			continue
+		}
+		input := Derived.Input{SensorName: sensorName, Property: sensorName, Value: *reading.Value, Unit: reading.Unit}
+
+		// use the ObservedProperty and UnitType of the sensor's data stream when the station has one, otherwise the sensor name is used as the property
+		if stn != nil {
+			if dataStream, err := cache.database.GetDataStreamBySensorName(sensorName, int64(stn.StationID)); err == nil {
+				if property, err := cache.database.GetObservedProperty(strconv.Itoa(dataStream.ObservedPropertyID)); err == nil {
+					input.Property = property.Name
+				}
+				if unitType, err := cache.database.GetUnitType(strconv.Itoa(dataStream.UnitTypeID)); err == nil && input.Unit == "" {
+					input.Unit = unitType.UnitOfMeasure
+				}
+			}
+		}
+		inputs = append(inputs, input)
+	}
+
+	for name, derivation := range cache.Derivers.Derive(inputs, stn) {
+		if existing, uploaded := currentConditions.SensorReadings[name]; !uploaded || existing.Derived {
+			derived[name] = derivation.Reading
+			sources[name] = derivation.Sources
+		}
+	}
+	return derived, sources
 }
 
 // AddOrUpdateStation adds a new station to the database. If a station with the stn.StationID is already in the database this function will update it with the new values.
-func (cache *Cache) AddOrUpdateStation(stn *Interfaces.Station) {
-	cache.database.AddOrUpdateStation(stn)
+func (cache *Cache) AddOrUpdateStation(stn *Interfaces.Station) error {
+	return cache.database.AddOrUpdateStation(stn)
 }
 
 //LogConditions pushes the current station to the database thus logging the conditions
@@ -51,49 +132,50 @@ func (cache *Cache) LogConditions(currentConditions *Interfaces.StationUploadTem
 	return cache.database.LogConditions(currentConditions)
 }
 
-func (cache *Cache) AddOrUpdateUnitType(unit *Interfaces.UnitType) {
-	cache.database.AddOrUpdateUnitType(unit)
+func (cache *Cache) AddOrUpdateUnitType(unit *Interfaces.UnitType) error {
+	return cache.database.AddOrUpdateUnitType(unit)
 }
 
 // AddOrUpdateSensor updates the current sensor or creates a new one if it does not exist. Returns the ID number fot the newly created sensor.
-func (cache *Cache) AddOrUpdateSensor(sensor *Interfaces.Sensor) int64 {
+func (cache *Cache) AddOrUpdateSensor(sensor *Interfaces.Sensor) (int64, error) {
 	return cache.database.AddOrUpdateSensor(sensor)
 
 }
 
-func (cache *Cache) AddOrUpdateObservedProperty(observedProperty *Interfaces.ObservedProperty) {
-	cache.database.AddOrUpdateObservedProperty(observedProperty)
+func (cache *Cache) AddOrUpdateObservedProperty(observedProperty *Interfaces.ObservedProperty) error {
+	return cache.database.AddOrUpdateObservedProperty(observedProperty)
 }
 
-func (cache *Cache) AddDataStream(dataStream *Interfaces.DataStream) int64 {
+func (cache *Cache) AddDataStream(dataStream *Interfaces.DataStream) (int64, error) {
 	return cache.database.AddDataStream(dataStream)
 }
 
-func (cache *Cache) UpdateDataStream(dataStream *Interfaces.DataStream) {
-	cache.database.UpdateDataStream(dataStream)
+func (cache *Cache) UpdateDataStream(dataStream *Interfaces.DataStream) error {
+	return cache.database.UpdateDataStream(dataStream)
 }
 
-func (cache *Cache) AddObservation(observation *Interfaces.Observation) {
-	cache.database.AddObservation(observation)
-
+func (cache *Cache) AddObservation(observation *Interfaces.Observation) error {
+	return cache.database.AddObservation(observation)
 }
 
 // GetStation retrieves from the database a Station with ID number 'stationID'
-func (cache *Cache) GetStation(stationID string) *Interfaces.Station {
+func (cache *Cache) GetStation(stationID string) (*Interfaces.Station, error) {
 	return cache.database.GetStation(stationID)
 }
 
 // GetStation retrieves from the database a Station with name 'stationName'
-func (cache *Cache) GetStationByName(stationName string) *Interfaces.Station {
-	temp, _ := cache.database.GetStationByName(stationName)
-	return temp
+func (cache *Cache) GetStationByName(stationName string) (*Interfaces.Station, error) {
+	return cache.database.GetStationByName(stationName)
 }
 
 // GetStations retrieves all of the stations from the database
-func (cache *Cache) GetStations() []Interfaces.Station {
-	var stns = cache.database.GetStations()
+func (cache *Cache) GetStations() ([]Interfaces.Station, error) {
+	stns, err := cache.database.GetStations()
+	if err != nil {
+		return nil, err
+	}
 
-	for _, stnVal := range cache.currentData.SensorReadings {
+	for _, stnVal := range cache.currentData.GetAllCurrentSensorReadings() {
 
 		//see if the station is already in our current list
 		stnInList := false
@@ -116,53 +198,139 @@ func (cache *Cache) GetStations() []Interfaces.Station {
 			stns = append(stns, tempStn)
 		}
 	}
-	return stns
+	return stns, nil
+}
+
+// GetStationByDeviceKey retrieves the station whose DeviceKey is 'deviceKey'
+func (cache *Cache) GetStationByDeviceKey(deviceKey string) (*Interfaces.Station, error) {
+	return cache.database.GetStationByDeviceKey(deviceKey)
+}
+
+// AuthenticateStation returns the station named 'stationName' if 'password' matches its upload password
+func (cache *Cache) AuthenticateStation(stationName string, password string) (*Interfaces.Station, error) {
+	return cache.database.AuthenticateStation(stationName, password)
 }
 
 // GetDataStream returns a datastream from the database based on the 'streamID'
-func (cache *Cache) GetDataStream(streamID string) *Interfaces.DataStream {
+func (cache *Cache) GetDataStream(streamID string) (*Interfaces.DataStream, error) {
 	return cache.database.GetDataStream(streamID)
 }
 
 // GetDataStream returns a datastream from the database based on the 'sensorName'
-func (cache *Cache) GetDataStreamBySensorName(sensorName string, stationIDNum int64) *Interfaces.DataStream {
+func (cache *Cache) GetDataStreamBySensorName(sensorName string, stationIDNum int64) (*Interfaces.DataStream, error) {
 	return cache.database.GetDataStreamBySensorName(sensorName, stationIDNum)
 }
 
-func (cache *Cache) GetDataStreams() *[]Interfaces.DataStream {
+// EnsureDataStream returns the station's data stream for the sensor 'sensorName', creating it and its metadata if needed
+func (cache *Cache) EnsureDataStream(stationID int, sensorName string, sensorDescription string, propertyName string, unitOfMeasure string) (*Interfaces.DataStream, error) {
+	return cache.database.EnsureDataStream(stationID, sensorName, sensorDescription, propertyName, unitOfMeasure)
+}
+
+func (cache *Cache) GetDataStreams() (*[]Interfaces.DataStream, error) {
 	return cache.database.GetDataStreams()
 }
 
-func (cache *Cache) GetUnitType(unitTypeID string) *Interfaces.UnitType {
+func (cache *Cache) GetUnitType(unitTypeID string) (*Interfaces.UnitType, error) {
 	return cache.database.GetUnitType(unitTypeID)
 
 }
 
-func (cache *Cache) GetUnitTypes() *[]Interfaces.UnitType {
+func (cache *Cache) GetUnitTypes() (*[]Interfaces.UnitType, error) {
 	return cache.database.GetUnitTypes()
 }
 
-func (cache *Cache) GetSensor(sensorID string) *Interfaces.Sensor {
+func (cache *Cache) GetSensor(sensorID string) (*Interfaces.Sensor, error) {
 	return cache.database.GetSensor(sensorID)
 }
 
-func (cache *Cache) GetSensors() *[]Interfaces.Sensor {
+func (cache *Cache) GetSensors() (*[]Interfaces.Sensor, error) {
 	return cache.database.GetSensors()
 }
 
 // GetObservations returns the obseration with 'ObservationID'
-func (cache *Cache) GetObservation(observationID string) *Interfaces.Observation {
+func (cache *Cache) GetObservation(observationID string) (*Interfaces.Observation, error) {
 	return cache.database.GetObservation(observationID)
 }
 
-func (cache *Cache) GetObservations(parameters Interfaces.ObservationParameters) *[]Interfaces.Observation {
+func (cache *Cache) GetObservations(parameters Interfaces.ObservationParameters) (*[]Interfaces.Observation, error) {
 	return cache.database.GetObservations(parameters)
 }
 
-func (cache *Cache) GetObservedProperty(propertyID string) *Interfaces.ObservedProperty {
+// AggregateObservations groups a data stream's observations into time buckets and returns the aggregated value of each bucket
+func (cache *Cache) AggregateObservations(parameters Interfaces.AggregationParameters) (*[]Interfaces.AggregateBucket, error) {
+	return cache.database.AggregateObservations(parameters)
+}
+
+func (cache *Cache) GetObservedProperty(propertyID string) (*Interfaces.ObservedProperty, error) {
 	return cache.database.GetObservedProperty(propertyID)
 }
 
-func (cache *Cache) GetObservedProperties() *[]Interfaces.ObservedProperty {
+func (cache *Cache) GetObservedProperties() (*[]Interfaces.ObservedProperty, error) {
 	return cache.database.GetObservedProperties()
 }
+
+// DeleteStation removes a station from the database along with its current sensor readings
+func (cache *Cache) DeleteStation(stationID string, cascade bool) error {
+	stn, _ := cache.database.GetStation(stationID)
+
+	err := cache.database.DeleteStation(stationID, cascade)
+	if err == nil && stn != nil {
+		cache.currentData.DeleteCurrentSensorReadings(stn.Name)
+	}
+	return err
+}
+
+func (cache *Cache) DeleteDataStream(streamID string, cascade bool) error {
+	return cache.database.DeleteDataStream(streamID, cascade)
+}
+
+func (cache *Cache) DeleteUnitType(unitTypeID string) error {
+	return cache.database.DeleteUnitType(unitTypeID)
+}
+
+func (cache *Cache) DeleteSensor(sensorID string) error {
+	return cache.database.DeleteSensor(sensorID)
+}
+
+func (cache *Cache) DeleteObservedProperty(propertyID string) error {
+	return cache.database.DeleteObservedProperty(propertyID)
+}
+
+func (cache *Cache) DeleteObservation(observationID string) error {
+	return cache.database.DeleteObservation(observationID)
+}
+
+// GetLoggingConfigs returns the logging configuration of every station that has one saved
+func (cache *Cache) GetLoggingConfigs() ([]Interfaces.LoggingConfig, error) {
+	return cache.database.GetLoggingConfigs()
+}
+
+// SetLoggingConfig saves a station's logging configuration
+func (cache *Cache) SetLoggingConfig(config *Interfaces.LoggingConfig) error {
+	return cache.database.SetLoggingConfig(config)
+}
+
+// DeleteLoggingConfig removes a station's logging configuration so the defaults are used again
+func (cache *Cache) DeleteLoggingConfig(stationID string) error {
+	return cache.database.DeleteLoggingConfig(stationID)
+}
+
+// IssueAPIToken stores a new token and returns its key
+func (cache *Cache) IssueAPIToken(token *Interfaces.APIToken) (string, error) {
+	return cache.database.IssueAPIToken(token)
+}
+
+// GetAPITokens returns every token that has been issued and not revoked
+func (cache *Cache) GetAPITokens() ([]Interfaces.APIToken, error) {
+	return cache.database.GetAPITokens()
+}
+
+// RevokeAPIToken deletes a token so its key is no longer accepted
+func (cache *Cache) RevokeAPIToken(tokenID string) error {
+	return cache.database.RevokeAPIToken(tokenID)
+}
+
+// AuthenticateToken returns the token that 'key' belongs to
+func (cache *Cache) AuthenticateToken(key string) (*Interfaces.APIToken, error) {
+	return cache.database.AuthenticateToken(key)
+}
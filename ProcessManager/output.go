@@ -0,0 +1,267 @@
+package ProcessManager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Josiah-B/Cyclone/Interfaces"
+)
+
+// The output streams of a process
+const (
+	Stdout = "stdout"
+	Stderr = "stderr"
+)
+
+// OutputLine is a single line written by a process
+type OutputLine struct {
+	// ID increases by one with every line the process writes; clients send the last ID they received to resume a tail
+	ID     uint64
+	Time   time.Time
+	Stream string
+	Text   string
+}
+
+// outputLog keeps the most recent lines a process has written, writes them to its log files and passes them on to the tails.
+// It lasts for the life of the process entry, so the output from before a crash is still there after the restart.
+type outputLog struct {
+	lock   sync.Mutex
+	lines  []OutputLine
+	size   int
+	lastID uint64
+	// files holds the log file of each stream; it is empty when logging to files is disabled
+	files map[string]*rotatingFile
+	tails map[*OutputTail]bool
+	// closed is set once the process is stopped; lines it writes while exiting are still kept, but not written to the files
+	closed bool
+}
+
+// OutputTail receives the lines a process writes on Lines until it is closed
+type OutputTail struct {
+	Lines chan OutputLine
+	log   *outputLog
+	// dropped counts the lines that were skipped because the tail was not keeping up
+	dropped int
+}
+
+// tailBuffer is the number of lines a tail can fall behind before lines are dropped
+const tailBuffer = 256
+
+// newOutputLog creates the output log of the named process. The log files are only created when the config has a LogFolder.
+func (prcMgr *ProcessMgr) newOutputLog(name string) *outputLog {
+	output := &outputLog{
+		size:  prcMgr.configuration.OutputLines,
+		files: make(map[string]*rotatingFile),
+		tails: make(map[*OutputTail]bool)}
+
+	if folder := prcMgr.configuration.LogFolder; folder != "" {
+		for _, stream := range []string{Stdout, Stderr} {
+			output.files[stream] = &rotatingFile{
+				path:    filepath.Join(folder, name+"."+stream+".log"),
+				maxSize: int64(prcMgr.configuration.MaxLogFileSize) * 1024,
+				backups: prcMgr.configuration.LogFileBackups}
+		}
+	}
+	return output
+}
+
+// write adds a line from the process's 'stream'
+func (output *outputLog) write(stream string, text string) {
+	output.lock.Lock()
+	defer output.lock.Unlock()
+
+	output.lastID++
+	line := OutputLine{ID: output.lastID, Time: time.Now(), Stream: stream, Text: text}
+	output.lines = append(output.lines, line)
+	if len(output.lines) > output.size {
+		output.lines = output.lines[len(output.lines)-output.size:]
+	}
+
+	if file := output.files[stream]; file != nil && !output.closed {
+		if err := file.writeLine(line.Time.Format(time.RFC3339) + " " + text + "\n"); err != nil {
+			fmt.Println("Unable to write to the process log file: ", err)
+		}
+	}
+	for tail := range output.tails {
+		tail.send(line)
+	}
+}
+
+// last returns up to 'count' of the most recent lines, oldest first. Only lines from 'stream' are returned unless it is empty.
+func (output *outputLog) last(count int, stream string) []OutputLine {
+	output.lock.Lock()
+	defer output.lock.Unlock()
+
+	lines := []OutputLine{}
+	for i := len(output.lines) - 1; i >= 0 && len(lines) < count; i-- {
+		if stream == "" || output.lines[i].Stream == stream {
+			lines = append(lines, output.lines[i])
+		}
+	}
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return lines
+}
+
+// tail starts a tail of the output. If 'lastID' is not 0 the lines after it that are still kept are sent first, otherwise the last 'backlog' lines are.
+func (output *outputLog) tail(backlog int, lastID uint64) *OutputTail {
+	output.lock.Lock()
+	defer output.lock.Unlock()
+
+	tail := &OutputTail{Lines: make(chan OutputLine, tailBuffer+len(output.lines)), log: output}
+	for i, line := range output.lines {
+		if (lastID != 0 && line.ID > lastID) || (lastID == 0 && i >= len(output.lines)-backlog) {
+			tail.send(line)
+		}
+	}
+	output.tails[tail] = true
+	return tail
+}
+
+// close closes the log files and ends every tail
+func (output *outputLog) close() {
+	output.lock.Lock()
+	defer output.lock.Unlock()
+
+	output.closed = true
+	for _, file := range output.files {
+		file.close()
+	}
+	for tail := range output.tails {
+		delete(output.tails, tail)
+		close(tail.Lines)
+	}
+}
+
+// Dropped returns the number of lines that were skipped because the tail was not keeping up
+func (tail *OutputTail) Dropped() int {
+	tail.log.lock.Lock()
+	defer tail.log.lock.Unlock()
+	return tail.dropped
+}
+
+// Close stops the tail and closes its Lines channel
+func (tail *OutputTail) Close() {
+	tail.log.lock.Lock()
+	defer tail.log.lock.Unlock()
+
+	if tail.log.tails[tail] {
+		delete(tail.log.tails, tail)
+		close(tail.Lines)
+	}
+}
+
+// send queues the line, dropping it if the tail is too far behind. The output log's lock must be held.
+func (tail *OutputTail) send(line OutputLine) {
+	select {
+	case tail.Lines <- line:
+	default:
+		tail.dropped++
+	}
+}
+
+// Output returns up to 'count' of the most recent lines the process wrote, oldest first. 'stream' limits the lines to Stdout or Stderr when it is not empty.
+func (prcMgr *ProcessMgr) Output(name string, count int, stream string) ([]OutputLine, error) {
+	output, err := prcMgr.outputLog(name, stream)
+	if err != nil {
+		return nil, err
+	}
+	return output.last(count, stream), nil
+}
+
+// TailOutput starts a tail of the lines the process writes. If 'lastID' is not 0 the kept lines after it are sent first, otherwise the last 'backlog' lines are.
+func (prcMgr *ProcessMgr) TailOutput(name string, backlog int, lastID uint64) (*OutputTail, error) {
+	output, err := prcMgr.outputLog(name, "")
+	if err != nil {
+		return nil, err
+	}
+	return output.tail(backlog, lastID), nil
+}
+
+// outputLog returns the output log of the process, checking that 'stream' is one of the process's streams
+func (prcMgr *ProcessMgr) outputLog(name string, stream string) (*outputLog, error) {
+	if stream != "" && stream != Stdout && stream != Stderr {
+		return nil, Interfaces.ValidationError("'stream' must be '%v' or '%v', got '%v'", Stdout, Stderr, stream)
+	}
+
+	proc, err := prcMgr.process(name)
+	if err != nil {
+		return nil, err
+	}
+	return proc.output, nil
+}
+
+// rotatingFile is a log file that is renamed to '<path>.1' once it reaches maxSize, keeping up to 'backups' old files
+type rotatingFile struct {
+	path    string
+	maxSize int64
+	backups int
+	file    *os.File
+	size    int64
+}
+
+// writeLine appends the line to the file, rotating the file first if the line would take it past its maximum size
+func (f *rotatingFile) writeLine(line string) error {
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return err
+		}
+	}
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(line)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+
+	written, err := f.file.WriteString(line)
+	f.size += int64(written)
+	return err
+}
+
+func (f *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// rotate shifts the old files up by one, dropping the oldest, and starts a new file
+func (f *rotatingFile) rotate() error {
+	f.close()
+	for i := f.backups - 1; i >= 1; i-- {
+		os.Rename(f.path+"."+strconv.Itoa(i), f.path+"."+strconv.Itoa(i+1))
+	}
+	var err error
+	if f.backups > 0 {
+		err = os.Rename(f.path, f.path+".1")
+	} else {
+		err = os.Remove(f.path)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return f.open()
+}
+
+func (f *rotatingFile) close() {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+}
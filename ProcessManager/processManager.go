@@ -1,43 +1,153 @@
 package ProcessManager
 
 import (
-	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/Josiah-B/Cyclone/Interfaces"
 )
 
 //ProcessMgr allows management of external processes as used by the extensions
 type ProcessMgr struct {
-	processes      map[int]*process
+	// lock guards the processes map
+	lock           sync.Mutex
+	processes      map[string]*process
 	configFilePath string
 	configuration  Config
+	// stop is closed by Shutdown so the processes are no longer restarted
+	stop chan struct{}
+	// storage receives the readings the processes send
+	storage Interfaces.Storage
+	// configLock is held while the station config files are read or changed through the API
+	configLock sync.Mutex
 }
 
-var newProcID = 0
+// The status of a process
+const (
+	// StatusLaunching is a process that has not been started yet
+	StatusLaunching = "Launching"
+	// StatusStarting is a process that has started but has not sent any output yet
+	StatusStarting = "Starting"
+	// StatusRunning is a process that is sending heartbeats
+	StatusRunning = "Running"
+	// StatusBackoff is a process that exited and is waiting to be restarted
+	StatusBackoff = "Backoff"
+	// StatusStopped is a process that was stopped, or is disabled, and will not be restarted
+	StatusStopped = "Stopped"
+	// StatusFailed is a process that crashed too often within the restart window; it is not restarted until it is started again
+	StatusFailed = "Failed"
+)
+
+// ProcessDefinition describes a process for CreateProc
+type ProcessDefinition struct {
+	// Name identifies the process; it may only contain letters, digits, '.', '_' and '-'
+	Name string
+	// Path is the executable to run. Relative paths are inside the StationExecFolder, and when the config has a StationExecFolder the executable has to be in it.
+	Path string
+	Args []string `json:",omitempty"`
+	// Env holds 'KEY=value' pairs added to the environment the process inherits
+	Env []string `json:",omitempty"`
+	// Disabled creates the process without starting it
+	Disabled bool `json:",omitempty"`
+}
+
+var validProcessName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
 
 type process struct {
+	// control is held while the process is started or stopped, so only one of them happens at a time
+	control sync.Mutex
+	// lock guards every field below, which are updated by the goroutine supervising the process
+	lock          sync.Mutex
+	name          string
 	pathToExec    string
+	args          []string
+	env           []string
+	enabled       bool
 	command       *exec.Cmd
 	Status        string
 	errors        error
-	Stdout        io.ReadCloser
 	LastHeartbeat time.Time
+	StartedAt     time.Time
+	// restarts are the times the process was restarted after crashing; only the ones within the restart window are kept
+	restarts     []time.Time
+	restartCount int
+	nextRestart  time.Time
+	// history holds the most recent exits, oldest first
+	history []ExitRecord
+	// stopRequested is set when the process is stopped on purpose, so its exit is not treated as a crash; 'quit' is closed at the same time
+	stopRequested bool
+	quit          chan struct{}
+	// done is closed once the goroutine supervising the process has returned; nil if the process was never started
+	done chan struct{}
+	// exited is closed once the current command has exited; nil while the process is not running
+	exited chan struct{}
+	// output keeps what the process writes to stdout and stderr
+	output *outputLog
+	// usesProtocol is set once the running command sends a message, after which only heartbeat, readings and status messages are heartbeats
+	usesProtocol  bool
+	readingsCount int
+	lastReadings  time.Time
+	lastStatus    *ProcessMessage
+	lastError     *ProcessMessage
 }
 
 type Config struct {
 	StationConfigFolder string
 	StationExecFolder   string
+	// StationSchemaFolder holds a '<ExecName>.schema.json' for each driver, used to check the station configs saved through the API.
+	// Only ExecName and Disabled are checked when it is empty.
+	StationSchemaFolder string
+
+	// RestartDelay is the delay before restarting a process that exited, in seconds. It doubles after every crash up to MaxRestartDelay
+	// and is reset once the process has run for a whole RestartWindow. Each delay is randomised between half and all of its value.
+	RestartDelay    int
+	MaxRestartDelay int
+	// MaxRestarts is the number of restarts allowed within RestartWindow (seconds) before the process is marked as Failed; 0 allows any number
+	MaxRestarts   int
+	RestartWindow int
+	// HeartbeatTimeout restarts a process that has not sent any output for this many seconds; 0 never restarts a silent process
+	HeartbeatTimeout int
+	// StopTimeout is how many seconds a process is given to exit when it is stopped or restarted before it is killed
+	StopTimeout int
+
+	// OutputLines is the number of lines of each process's output that are kept in memory
+	OutputLines int
+	// LogFolder is where each process's stdout and stderr are written, as '<process name>.stdout.log' and '.stderr.log';
+	// the output is only kept in memory when it is empty. Files are rotated once they reach MaxLogFileSize KB, keeping LogFileBackups old files.
+	LogFolder      string
+	MaxLogFileSize int
+	LogFileBackups int
+}
+
+// defaultConfig holds the values used for the settings missing from the config file
+var defaultConfig = Config{
+	RestartDelay:     1,
+	MaxRestartDelay:  300,
+	MaxRestarts:      5,
+	RestartWindow:    600,
+	HeartbeatTimeout: 180,
+	StopTimeout:      10,
+	OutputLines:      1000,
+	MaxLogFileSize:   1024,
+	LogFileBackups:   3,
 }
 
 //stationConfig is a structure that we can load the station config into just long enough to find the executable name for the station type
 type stationConfig struct {
 	ExecName string
+	// Disabled stations are listed by the process manager but not started
+	Disabled bool
 }
 
 func (prcMgr *ProcessMgr) loadConfigurationFile(file string, config interface{}) error {
@@ -52,6 +162,7 @@ func (prcMgr *ProcessMgr) loadConfigurationFile(file string, config interface{})
 	return err
 }
 
+// LoadStatationConfigs creates a process for each station config file, named after the file without its extension
 func (prcMgr *ProcessMgr) LoadStatationConfigs() {
 	// walk all files in directory
 	files, err := ioutil.ReadDir(prcMgr.configuration.StationConfigFolder)
@@ -61,140 +172,465 @@ func (prcMgr *ProcessMgr) LoadStatationConfigs() {
 
 	// each file is a config file
 	for _, f := range files {
+		if !isStationConfigFile(f) {
+			continue
+		}
 
 		baseName := f.Name()
 		var cExec stationConfig
-		var fullConfigFilePath = prcMgr.configuration.StationConfigFolder + "/" + baseName
+		var fullConfigFilePath = filepath.Join(prcMgr.configuration.StationConfigFolder, baseName)
 		prcMgr.loadConfigurationFile(fullConfigFilePath, &cExec)
 		fmt.Println(fullConfigFilePath, ":", cExec.ExecName)
-		var fullExecString = prcMgr.configuration.StationExecFolder + "/" + cExec.ExecName
-		fmt.Println("Full executable string : ", fullExecString)
-		prcMgr.CreateProc(fullExecString, "-config="+fullConfigFilePath)
+
+		_, err := prcMgr.CreateProc(stationDefinition(stationConfigName(baseName), fullConfigFilePath, cExec))
+		if err != nil {
+			fmt.Println("Unable to create the process for ", fullConfigFilePath, ": ", err)
+		}
 	}
 }
 
-//NewProcessMgr creates a new Proccess Manager
-func NewProcessMgr(configFilePath string) *ProcessMgr {
+//NewProcessMgr creates a new Proccess Manager; the readings the processes send are set in 'storage'
+func NewProcessMgr(configFilePath string, storage Interfaces.Storage) *ProcessMgr {
 	var prcMgr ProcessMgr
+	prcMgr.storage = storage
 
-	prcMgr.processes = make(map[int]*process)
+	prcMgr.processes = make(map[string]*process)
+	prcMgr.stop = make(chan struct{})
 	//load the configuration file
+	prcMgr.configuration = defaultConfig
 	err := prcMgr.loadConfigurationFile(configFilePath, &prcMgr.configuration)
 	fmt.Println(prcMgr.configuration)
 	prcMgr.LoadStatationConfigs()
 	if err != nil {
 		fmt.Println(err)
 	}
-	//start monitoring the processes
-	go prcMgr.monitorProcesses()
 	return &prcMgr
 }
 
-//monitorProcesses periodically checks the processes, restarts any that are hung or crashed
-func (prcMgr *ProcessMgr) monitorProcesses() {
-	for true {
-		fmt.Println("Checking processes...")
-		for procID, value := range prcMgr.processes {
-			durationSinceHeartbeat := time.Now().Sub(value.LastHeartbeat)
-			if value.Status == "Launching" {
-				prcMgr.StartProc(procID)
-				go value.listen()
-				// restart the process if it has crashed or it has not reported a heartbeat in awhile (e.g. the process is hung)
-			} else if (durationSinceHeartbeat.Minutes() > 3) || value.Status == "Stopped" {
-				prcMgr.recreateProc(procID)          // recreate the proccess
-				prcMgr.StartProc(procID)             // start the new process
-				go prcMgr.processes[procID].listen() // finally, start listening for input from the new process
-			}
-		}
-		time.Sleep(time.Second * 60) // wait a little before checking the processes again
+// Shutdown stops restarting the processes and asks each of them to exit. Processes still running after 'gracePeriod' are killed.
+func (prcMgr *ProcessMgr) Shutdown(gracePeriod time.Duration) {
+	prcMgr.lock.Lock()
+	select {
+	case <-prcMgr.stop:
+		prcMgr.lock.Unlock()
+		return // already shut down
+	default:
+		close(prcMgr.stop)
 	}
+	processes := make([]*process, 0, len(prcMgr.processes))
+	for _, value := range prcMgr.processes {
+		processes = append(processes, value)
+	}
+	prcMgr.lock.Unlock()
+
+	var wait sync.WaitGroup
+	for _, value := range processes {
+		wait.Add(1)
+		go func(prc *process) {
+			defer wait.Done()
+			prc.control.Lock()
+			defer prc.control.Unlock()
+			prc.terminate(gracePeriod)
+			prc.output.close()
+		}(value)
+	}
+	wait.Wait()
 }
 
-//listen listens to the process and updates the lastHeartbeat variable whenever something is recieved from the process.
-func (prc *process) listen() {
-	scanner := bufio.NewScanner(prc.Stdout)
-	prc.Status = "Starting"
-	for scanner.Scan() {
-		if scanner.Err() != nil {
-			fmt.Println(scanner.Err())
+// stopTimeout returns how long a process is given to exit when it is stopped
+func (prcMgr *ProcessMgr) stopTimeout() time.Duration {
+	return time.Duration(prcMgr.configuration.StopTimeout) * time.Second
+}
+
+// terminate asks the process to exit, killing it if it has not exited after 'gracePeriod', then waits for its supervisor to return.
+// The process will not be restarted. prc.control must be held.
+func (prc *process) terminate(gracePeriod time.Duration) {
+	prc.lock.Lock()
+	if !prc.stopRequested && prc.quit != nil {
+		close(prc.quit)
+	}
+	prc.stopRequested = true
+	exited := prc.exited
+	command := prc.command
+	done := prc.done
+	prc.lock.Unlock()
+
+	if exited != nil {
+		// interrupts are not supported on every platform, the process is killed straight away when they are not
+		if err := command.Process.Signal(os.Interrupt); err != nil {
+			command.Process.Kill()
 		}
 
-		prc.Status = "Running"         //The process is running since we are getting output from it
-		prc.LastHeartbeat = time.Now() // anything we get from the process we will say is a valid hearbeat
+		select {
+		case <-exited:
+			log.Println("Process exited: ", prc.name)
+		case <-time.After(gracePeriod):
+			log.Println("Process did not exit in time, killing it: ", prc.name)
+			command.Process.Kill()
+			<-exited
+		}
+	}
+
+	if done != nil {
+		<-done
 	}
-	prc.Status = "Stopped"
+	prc.setStatus(StatusStopped, false)
 }
 
-func (prcMgr *ProcessMgr) recreateProc(procID int) {
-	prcMgr.processes[procID].command.Process.Kill() // make sure the proccess is not running
+// supervising returns true while a goroutine is supervising the process
+func (prc *process) supervising() bool {
+	prc.lock.Lock()
+	defer prc.lock.Unlock()
+	if prc.done == nil {
+		return false
+	}
+	select {
+	case <-prc.done:
+		return false
+	default:
+		return true
+	}
+}
 
-	path := prcMgr.processes[procID].pathToExec
+// start begins supervising the process, clearing its restart history so it gets the full number of restarts again. prc.control must be held.
+func (prcMgr *ProcessMgr) start(prc *process) error {
+	if prcMgr.stopping() {
+		return fmt.Errorf("%w: the process manager is shutting down", Interfaces.ErrConflict)
+	}
 
-	var prog = process{
-		pathToExec: path,
-		command:    exec.Command(path),
-		Status:     "Launching",
+	prc.lock.Lock()
+	defer prc.lock.Unlock()
+	prc.Status = StatusLaunching
+	prc.stopRequested = false
+	prc.restarts = nil
+	prc.quit = make(chan struct{})
+	prc.done = make(chan struct{})
+	go prcMgr.supervise(prc, prc.quit, prc.done)
+	return nil
+}
+
+//setStatus updates the status of the process, and the time of its last heartbeat if 'heartbeat' is true
+func (prc *process) setStatus(status string, heartbeat bool) {
+	prc.lock.Lock()
+	defer prc.lock.Unlock()
+	prc.Status = status
+	if heartbeat {
+		prc.LastHeartbeat = time.Now()
 	}
+}
 
-	prcMgr.processes[procID] = &prog
+//state returns the status of the process and the time of its last heartbeat
+func (prc *process) state() (string, time.Time) {
+	prc.lock.Lock()
+	defer prc.lock.Unlock()
+	return prc.Status, prc.LastHeartbeat
 }
 
-func (prcMgr *ProcessMgr) CreateProc(path string, args ...string) {
-	// create and start the new process
+// CreateProc adds a process and starts it unless it is disabled. Interfaces.ErrConflict is returned if there is already a process with the same name.
+func (prcMgr *ProcessMgr) CreateProc(definition ProcessDefinition) (ProcessStatus, error) {
+	path, err := prcMgr.checkDefinition(definition)
+	if err != nil {
+		return ProcessStatus{}, err
+	}
+
+	prcMgr.lock.Lock()
+	defer prcMgr.lock.Unlock()
+	if _, ok := prcMgr.processes[definition.Name]; ok {
+		return ProcessStatus{}, fmt.Errorf("%w: there is already a process named '%v'", Interfaces.ErrConflict, definition.Name)
+	}
+
 	var prog = process{
+		name:       definition.Name,
 		pathToExec: path,
-		command:    exec.Command(path, args...),
-		Status:     "Launching",
+		args:       definition.Args,
+		env:        definition.Env,
+		enabled:    !definition.Disabled,
+		Status:     StatusStopped,
+		output:     prcMgr.newOutputLog(definition.Name),
+	}
+	prog.control.Lock()
+	defer prog.control.Unlock()
+
+	// add it to the list, then start it
+	prcMgr.processes[definition.Name] = &prog
+	if prog.enabled {
+		if err = prcMgr.start(&prog); err != nil {
+			return prog.status(), err
+		}
+	}
+	return prog.status(), nil
+}
+
+// checkDefinition validates the definition and returns the path of its executable
+func (prcMgr *ProcessMgr) checkDefinition(definition ProcessDefinition) (string, error) {
+	if !validProcessName.MatchString(definition.Name) {
+		return "", Interfaces.ValidationError("the process name '%v' may only contain letters, digits, '.', '_' and '-'", definition.Name)
+	}
+	if definition.Path == "" {
+		return "", Interfaces.ValidationError("the process '%v' needs the Path of the executable to run", definition.Name)
+	}
+	for _, variable := range definition.Env {
+		if !strings.Contains(variable, "=") || strings.HasPrefix(variable, "=") {
+			return "", Interfaces.ValidationError("environment variables must be 'KEY=value', got '%v'", variable)
+		}
+	}
+
+	folder := prcMgr.configuration.StationExecFolder
+	if folder == "" {
+		return definition.Path, nil
+	}
+	path := definition.Path
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(folder, path)
+	}
+	relative, err := filepath.Rel(folder, path)
+	if err != nil || relative == "." || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return "", Interfaces.ValidationError("the executable '%v' is not in the station executable folder", definition.Path)
+	}
+	return path, nil
+}
+
+// redefine replaces the definition of a process and restarts it with the new one, or creates the process if there is none
+func (prcMgr *ProcessMgr) redefine(definition ProcessDefinition) error {
+	path, err := prcMgr.checkDefinition(definition)
+	if err != nil {
+		return err
+	}
+	proc, err := prcMgr.process(definition.Name)
+	if errors.Is(err, Interfaces.ErrNotFound) {
+		_, err = prcMgr.CreateProc(definition)
+		return err
 	}
+	if err != nil {
+		return err
+	}
+	proc.control.Lock()
+	defer proc.control.Unlock()
 
-	// if the process started then add it to the list
-	prcMgr.processes[newProcID] = &prog
-	newProcID++
+	log.Println("Restarting process with its new definition : ", definition.Name)
+	proc.terminate(prcMgr.stopTimeout())
+	proc.lock.Lock()
+	proc.pathToExec = path
+	proc.args = definition.Args
+	proc.env = definition.Env
+	proc.enabled = !definition.Disabled
+	proc.lock.Unlock()
+	if definition.Disabled {
+		return nil
+	}
+	return prcMgr.start(proc)
 }
 
-// Start launches a new process
-func (prcMgr *ProcessMgr) StartProc(procID int) {
-	proc := prcMgr.processes[procID]
-	// open the output pipe
-	proc.Stdout, proc.errors = proc.command.StdoutPipe()
-	if proc.errors != nil {
-		proc.Status = "Unknown"
-		fmt.Println(proc.errors)
+// process returns the named process
+func (prcMgr *ProcessMgr) process(name string) (*process, error) {
+	prcMgr.lock.Lock()
+	defer prcMgr.lock.Unlock()
+	proc, ok := prcMgr.processes[name]
+	if !ok {
+		return nil, Interfaces.NotFoundError("process", name)
+	}
+	return proc, nil
+}
+
+// StartProc starts a process that was stopped or has failed. Nothing is done if it is already running; disabled processes can not be started.
+func (prcMgr *ProcessMgr) StartProc(name string) (ProcessStatus, error) {
+	proc, err := prcMgr.process(name)
+	if err != nil {
+		return ProcessStatus{}, err
+	}
+	proc.control.Lock()
+	defer proc.control.Unlock()
+
+	if !proc.isEnabled() {
+		return proc.status(), fmt.Errorf("%w: the process '%v' is disabled", Interfaces.ErrConflict, name)
 	}
+	if !proc.supervising() {
+		err = prcMgr.start(proc)
+	}
+	return proc.status(), err
+}
 
-	//start the process
-	proc.errors = proc.command.Start()
-	if proc.errors != nil {
-		log.Println("Failed to start process: ", proc.errors)
-		return
+// Stop ends the process; it is kept so it can be started again
+func (prcMgr *ProcessMgr) Stop(name string) (ProcessStatus, error) {
+	proc, err := prcMgr.process(name)
+	if err != nil {
+		return ProcessStatus{}, err
 	}
+	proc.control.Lock()
+	defer proc.control.Unlock()
+
+	log.Println("Stopping process : ", name)
+	proc.terminate(prcMgr.stopTimeout())
+	return proc.status(), nil
 }
 
-// Stop ends the specified process
-func (prcMgr *ProcessMgr) Stop(ID int) {
-	log.Println("Killing process : ", ID)
-	prcMgr.processes[ID].errors = prcMgr.processes[ID].command.Process.Kill()
-	if prcMgr.processes[ID].errors != nil {
-		log.Println("Failed to kill process: ", ID, " ; ", prcMgr.processes[ID].errors)
-	} else {
-		prcMgr.processes[ID].Status = "Stopped"
-		delete(prcMgr.processes, ID) //remove the process from our list of proccess that should be running
+//Restart stops then starts a specific process with the same arguments
+func (prcMgr *ProcessMgr) Restart(name string) (ProcessStatus, error) {
+	proc, err := prcMgr.process(name)
+	if err != nil {
+		return ProcessStatus{}, err
 	}
+	proc.control.Lock()
+	defer proc.control.Unlock()
 
+	if !proc.isEnabled() {
+		return proc.status(), fmt.Errorf("%w: the process '%v' is disabled", Interfaces.ErrConflict, name)
+	}
+	log.Println("Restarting process : ", name)
+	proc.terminate(prcMgr.stopTimeout())
+	err = prcMgr.start(proc)
+	return proc.status(), err
 }
 
-//Restart stops then starts a specific process
-func (prcMgr *ProcessMgr) Restart() {
-	//prcMgr.Stop()
-	//prcMgr.Start()
+// Enable allows the process to run and starts it
+func (prcMgr *ProcessMgr) Enable(name string) (ProcessStatus, error) {
+	proc, err := prcMgr.process(name)
+	if err != nil {
+		return ProcessStatus{}, err
+	}
+	proc.control.Lock()
+	defer proc.control.Unlock()
+
+	proc.lock.Lock()
+	proc.enabled = true
+	proc.lock.Unlock()
+	if !proc.supervising() {
+		err = prcMgr.start(proc)
+	}
+	return proc.status(), err
 }
 
-//ListProcesses lists all the processes
-func (prcMgr *ProcessMgr) ListProcesses() []byte {
-	for PID, value := range prcMgr.processes {
-		fmt.Println(PID, "Status: ", value.Status)
+// Disable stops the process and keeps it from being started until it is enabled again
+func (prcMgr *ProcessMgr) Disable(name string) (ProcessStatus, error) {
+	proc, err := prcMgr.process(name)
+	if err != nil {
+		return ProcessStatus{}, err
 	}
-	payload, _ := json.MarshalIndent(prcMgr.processes, "", "\t")
+	proc.control.Lock()
+	defer proc.control.Unlock()
+
+	proc.lock.Lock()
+	proc.enabled = false
+	proc.lock.Unlock()
+	log.Println("Disabling process : ", name)
+	proc.terminate(prcMgr.stopTimeout())
+	return proc.status(), nil
+}
 
-	return payload
+// Remove stops the process and forgets it, returning the process's status once it has stopped
+func (prcMgr *ProcessMgr) Remove(name string) (ProcessStatus, error) {
+	proc, err := prcMgr.process(name)
+	if err != nil {
+		return ProcessStatus{}, err
+	}
+	proc.control.Lock()
+	defer proc.control.Unlock()
+
+	log.Println("Removing process : ", name)
+	proc.terminate(prcMgr.stopTimeout())
+	proc.output.close()
+
+	prcMgr.lock.Lock()
+	defer prcMgr.lock.Unlock()
+	if prcMgr.processes[name] == proc {
+		delete(prcMgr.processes, name) //remove the process from our list of proccesses
+	}
+	return proc.status(), nil
+}
+
+// isEnabled returns false if the process has been disabled
+func (prc *process) isEnabled() bool {
+	prc.lock.Lock()
+	defer prc.lock.Unlock()
+	return prc.enabled
+}
+
+// ProcessStatus is the state of a process as reported by ListProcesses and Process
+type ProcessStatus struct {
+	Name      string
+	Path      string
+	Args      []string `json:",omitempty"`
+	Env       []string `json:",omitempty"`
+	Enabled   bool
+	Status    string
+	PID       int        `json:",omitempty"`
+	StartedAt *time.Time `json:",omitempty"`
+	// Uptime is how long the process has been running since it was last started, e.g. "1h2m3s"
+	Uptime        string `json:",omitempty"`
+	LastHeartbeat time.Time
+	// Restarts is the number of times the process has been restarted after crashing; RecentRestarts only counts those within the restart window
+	Restarts       int
+	RecentRestarts int
+	NextRestart    *time.Time  `json:",omitempty"`
+	LastExit       *ExitRecord `json:",omitempty"`
+	History        []ExitRecord
+	// UsesProtocol is true once the process has sent a message; Readings counts the readings messages that were stored
+	UsesProtocol bool
+	Readings     int
+	LastReadings *time.Time      `json:",omitempty"`
+	LastStatus   *ProcessMessage `json:",omitempty"`
+	LastError    *ProcessMessage `json:",omitempty"`
+}
+
+// status copies the state of the process
+func (prc *process) status() ProcessStatus {
+	prc.lock.Lock()
+	defer prc.lock.Unlock()
+
+	status := ProcessStatus{
+		Name:           prc.name,
+		Path:           prc.pathToExec,
+		Args:           prc.args,
+		Env:            prc.env,
+		Enabled:        prc.enabled,
+		Status:         prc.Status,
+		LastHeartbeat:  prc.LastHeartbeat,
+		Restarts:       prc.restartCount,
+		RecentRestarts: len(prc.restarts),
+		History:        append([]ExitRecord{}, prc.history...),
+		UsesProtocol:   prc.usesProtocol,
+		Readings:       prc.readingsCount,
+		LastStatus:     prc.lastStatus,
+		LastError:      prc.lastError}
+	if !prc.lastReadings.IsZero() {
+		lastReadings := prc.lastReadings
+		status.LastReadings = &lastReadings
+	}
+	if prc.exited != nil && prc.command.Process != nil {
+		startedAt := prc.StartedAt
+		status.PID = prc.command.Process.Pid
+		status.StartedAt = &startedAt
+		status.Uptime = time.Since(startedAt).Round(time.Second).String()
+	}
+	if prc.Status == StatusBackoff {
+		nextRestart := prc.nextRestart
+		status.NextRestart = &nextRestart
+	}
+	if len(status.History) > 0 {
+		status.LastExit = &status.History[len(status.History)-1]
+	}
+	return status
+}
+
+// Process returns the state of the named process
+func (prcMgr *ProcessMgr) Process(name string) (ProcessStatus, error) {
+	proc, err := prcMgr.process(name)
+	if err != nil {
+		return ProcessStatus{}, err
+	}
+	return proc.status(), nil
+}
+
+//ListProcesses lists all the processes, ordered by name
+func (prcMgr *ProcessMgr) ListProcesses() []ProcessStatus {
+	prcMgr.lock.Lock()
+	defer prcMgr.lock.Unlock()
+
+	// copy the status of each process so they are not read while their supervisors update them
+	statuses := make([]ProcessStatus, 0, len(prcMgr.processes))
+	for _, value := range prcMgr.processes {
+		statuses = append(statuses, value.status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
 }
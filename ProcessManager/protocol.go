@@ -0,0 +1,136 @@
+package ProcessManager
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Josiah-B/Cyclone/Interfaces"
+)
+
+// The types of message a process can write to stdout, one JSON object per line, e.g. {"Type":"heartbeat"}
+const (
+	// MessageHeartbeat tells the process manager the process is working
+	MessageHeartbeat = "heartbeat"
+	// MessageReadings sets the current readings of a station: {"Type":"readings","Readings":{"StationName":"...","SensorReadings":{...}}}
+	MessageReadings = "readings"
+	// MessageLog adds a line to the process's output: {"Type":"log","Level":"info","Message":"..."}
+	MessageLog = "log"
+	// MessageStatus reports what the process is doing, e.g. {"Type":"status","Status":"Connected to the station"}
+	MessageStatus = "status"
+	// MessageError reports a problem the process has: {"Type":"error","Message":"..."}
+	MessageError = "error"
+)
+
+// Message is a single line of the protocol processes use to talk to the process manager.
+//
+// Heartbeat, readings and status messages count as heartbeats; log and error messages do not, so a process that keeps logging while
+// it is stuck is still restarted. Until a process sends its first message any line it writes counts as a heartbeat, so processes that
+// do not use the protocol keep working.
+type Message struct {
+	Type string
+	// Readings holds the station's current readings for readings messages; the time stamp is set to now when it is missing
+	Readings *Interfaces.StationUploadTemplate `json:",omitempty"`
+	Level    string                            `json:",omitempty"`
+	Message  string                            `json:",omitempty"`
+	Status   string                            `json:",omitempty"`
+}
+
+// ProcessMessage is the last status or error message a process sent
+type ProcessMessage struct {
+	Time    time.Time
+	Message string
+}
+
+// parseMessage returns the protocol message on the line; false is returned if the line is not a message
+func parseMessage(line string) (Message, bool) {
+	var message Message
+	if !strings.HasPrefix(strings.TrimSpace(line), "{") {
+		return message, false
+	}
+	if err := json.Unmarshal([]byte(line), &message); err != nil || message.Type == "" {
+		return message, false
+	}
+	return message, true
+}
+
+// handleLine processes a line the process wrote to stdout, returning the text to keep in its output log
+func (prcMgr *ProcessMgr) handleLine(prc *process, line string) string {
+	message, ok := parseMessage(line)
+	if !ok {
+		prc.plainHeartbeat()
+		return line
+	}
+
+	now := time.Now()
+	prc.lock.Lock()
+	prc.usesProtocol = true
+	switch message.Type {
+	case MessageHeartbeat, MessageReadings, MessageStatus:
+		prc.Status = StatusRunning
+		prc.LastHeartbeat = now
+	}
+	prc.lock.Unlock()
+
+	switch message.Type {
+	case MessageHeartbeat:
+	case MessageReadings:
+		err := prcMgr.storeReadings(message.Readings)
+		prc.lock.Lock()
+		if err == nil {
+			prc.readingsCount++
+			prc.lastReadings = now
+		} else {
+			prc.lastError = &ProcessMessage{Time: now, Message: "readings were not stored: " + err.Error()}
+		}
+		prc.lock.Unlock()
+		if err != nil {
+			log.Println("Process ", prc.name, " sent readings that were not stored: ", err)
+		}
+	case MessageLog:
+		if message.Level != "" {
+			return strings.ToUpper(message.Level) + ": " + message.Message
+		}
+		return message.Message
+	case MessageStatus:
+		prc.lock.Lock()
+		prc.lastStatus = &ProcessMessage{Time: now, Message: message.Status}
+		prc.lock.Unlock()
+	case MessageError:
+		log.Println("Process ", prc.name, " reported an error: ", message.Message)
+		prc.lock.Lock()
+		prc.lastError = &ProcessMessage{Time: now, Message: message.Message}
+		prc.lock.Unlock()
+	default:
+		prc.lock.Lock()
+		prc.lastError = &ProcessMessage{Time: now, Message: fmt.Sprintf("unknown message type '%v'", message.Type)}
+		prc.lock.Unlock()
+	}
+	return line
+}
+
+// plainHeartbeat counts a line that is not a message as a heartbeat, unless the process uses the protocol
+func (prc *process) plainHeartbeat() {
+	prc.lock.Lock()
+	defer prc.lock.Unlock()
+	if !prc.usesProtocol {
+		prc.Status = StatusRunning
+		prc.LastHeartbeat = time.Now()
+	}
+}
+
+// storeReadings sets the current readings sent by a process
+func (prcMgr *ProcessMgr) storeReadings(readings *Interfaces.StationUploadTemplate) error {
+	if readings == nil {
+		return Interfaces.ValidationError("a readings message must have Readings")
+	}
+	if prcMgr.storage == nil {
+		return fmt.Errorf("%w: there is no storage to send the readings to", Interfaces.ErrBackend)
+	}
+	if readings.TimeStamp.IsZero() {
+		readings.TimeStamp = time.Now().UTC()
+	}
+	return prcMgr.storage.SetCurrentSensorReadings(*readings)
+}
@@ -0,0 +1,99 @@
+package ProcessManager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Josiah-B/Cyclone/Interfaces"
+)
+
+// readingsStorage records the readings sent by the processes; calling any other storage method panics
+type readingsStorage struct {
+	Interfaces.Storage
+	uploads []Interfaces.StationUploadTemplate
+}
+
+func (storage *readingsStorage) SetCurrentSensorReadings(currentSensorReadings Interfaces.StationUploadTemplate) error {
+	storage.uploads = append(storage.uploads, currentSensorReadings)
+	return nil
+}
+
+func TestHandleLine(t *testing.T) {
+	tests := []struct {
+		name string
+		// usesProtocol is set when the process has already sent a message
+		usesProtocol bool
+		line         string
+		// message is true if the line is a protocol message
+		message    bool
+		heartbeat  bool
+		output     string
+		stored     int
+		lastStatus string
+		lastError  bool
+	}{
+		{name: "plain line", line: "connected", heartbeat: true, output: "connected"},
+		{name: "plain line after a message", usesProtocol: true, line: "connected", output: "connected"},
+		{name: "not a message", usesProtocol: true, line: "{not json", output: "{not json"},
+		{name: "heartbeat", message: true, line: `{"Type":"heartbeat"}`, heartbeat: true, output: `{"Type":"heartbeat"}`},
+		{name: "readings", message: true, line: `{"Type":"readings","Readings":{"StationName":"Backyard","SensorReadings":{"Temperature":20.5}}}`,
+			heartbeat: true, stored: 1},
+		{name: "readings without readings", message: true, line: `{"Type":"readings"}`, heartbeat: true, lastError: true},
+		{name: "status", message: true, line: `{"Type":"status","Status":"Connected to the station"}`, heartbeat: true, lastStatus: "Connected to the station"},
+		{name: "log", message: true, line: `{"Type":"log","Level":"warn","Message":"signal is weak"}`, output: "WARN: signal is weak"},
+		{name: "log without a level", message: true, line: `{"Type":"log","Message":"signal is weak"}`, output: "signal is weak"},
+		{name: "error", message: true, line: `{"Type":"error","Message":"the station is not answering"}`, lastError: true},
+		{name: "unknown type", message: true, line: `{"Type":"restart"}`, lastError: true},
+	}
+	for _, test := range tests {
+		storage := &readingsStorage{}
+		prcMgr := newTestManager(Config{})
+		prcMgr.storage = storage
+		prc := &process{name: "station", Status: StatusStarting, usesProtocol: test.usesProtocol}
+
+		output := prcMgr.handleLine(prc, test.line)
+		status := prc.status()
+
+		if heartbeat := !status.LastHeartbeat.IsZero(); heartbeat != test.heartbeat {
+			t.Errorf("%v: got heartbeat %v, want %v", test.name, heartbeat, test.heartbeat)
+		}
+		if test.heartbeat && status.Status != StatusRunning {
+			t.Errorf("%v: got status %v, want %v", test.name, status.Status, StatusRunning)
+		}
+		if test.output != "" && output != test.output {
+			t.Errorf("%v: got output '%v', want '%v'", test.name, output, test.output)
+		}
+		if wantProtocol := test.usesProtocol || test.message; status.UsesProtocol != wantProtocol {
+			t.Errorf("%v: got UsesProtocol %v, want %v", test.name, status.UsesProtocol, wantProtocol)
+		}
+		if len(storage.uploads) != test.stored || status.Readings != test.stored {
+			t.Errorf("%v: got %v readings stored (%v counted), want %v", test.name, len(storage.uploads), status.Readings, test.stored)
+		}
+		if gotStatus := status.LastStatus; (gotStatus == nil && test.lastStatus != "") || (gotStatus != nil && gotStatus.Message != test.lastStatus) {
+			t.Errorf("%v: got LastStatus %+v, want '%v'", test.name, gotStatus, test.lastStatus)
+		}
+		if (status.LastError != nil) != test.lastError {
+			t.Errorf("%v: got LastError %+v", test.name, status.LastError)
+		}
+	}
+}
+
+func TestReadingsMessageTimeStamp(t *testing.T) {
+	storage := &readingsStorage{}
+	prcMgr := newTestManager(Config{})
+	prcMgr.storage = storage
+	prc := &process{name: "station"}
+
+	prcMgr.handleLine(prc, `{"Type":"readings","Readings":{"StationName":"Backyard","SensorReadings":{"Temperature":20.5}}}`)
+	prcMgr.handleLine(prc, `{"Type":"readings","Readings":{"StationName":"Backyard","TimeStamp":"2024-05-01T12:00:00Z","SensorReadings":{"Temperature":21}}}`)
+
+	if len(storage.uploads) != 2 {
+		t.Fatalf("got %v uploads, want 2", len(storage.uploads))
+	}
+	if time.Since(storage.uploads[0].TimeStamp) > time.Minute {
+		t.Errorf("got TimeStamp %v for readings without one, want the current time", storage.uploads[0].TimeStamp)
+	}
+	if want := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC); !storage.uploads[1].TimeStamp.Equal(want) {
+		t.Errorf("got TimeStamp %v, want %v", storage.uploads[1].TimeStamp, want)
+	}
+}
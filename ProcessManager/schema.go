@@ -0,0 +1,177 @@
+package ProcessManager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Schema is the part of JSON Schema used to check station config files. Each driver can have one, named '<ExecName>.schema.json',
+// in the StationSchemaFolder; it describes the whole file, including ExecName. Keywords that are not listed here are ignored.
+type Schema struct {
+	// Type is "object", "array", "string", "number", "integer" or "boolean"; any type is allowed when it is empty
+	Type                 string             `json:"type"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+	Enum                 []interface{}      `json:"enum"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Pattern              string             `json:"pattern"`
+}
+
+// maxSchemaProblems is the number of problems listed in a validation error
+const maxSchemaProblems = 10
+
+// loadSchema reads a schema file
+func loadSchema(path string) (*Schema, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var schema Schema
+	if err = json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("the schema '%v' is not valid: %v", path, err)
+	}
+	return &schema, nil
+}
+
+// Check returns a description of each way the decoded JSON 'value' does not match the schema
+func (schema *Schema) Check(value interface{}) []string {
+	var problems []string
+	schema.check(value, "", &problems)
+	return problems
+}
+
+func (schema *Schema) check(value interface{}, path string, problems *[]string) {
+	if len(*problems) >= maxSchemaProblems {
+		return
+	}
+	name := path
+	if name == "" {
+		name = "the config"
+	}
+	fail := func(format string, args ...interface{}) {
+		*problems = append(*problems, name+" "+fmt.Sprintf(format, args...))
+	}
+
+	if schema.Type != "" && !hasType(value, schema.Type) {
+		fail("must be of type %v", schema.Type)
+		return
+	}
+	if len(schema.Enum) > 0 && !inEnum(value, schema.Enum) {
+		fail("must be one of %v", enumList(schema.Enum))
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for _, required := range schema.Required {
+			if _, ok := value[required]; !ok {
+				fail("needs '%v'", required)
+			}
+		}
+		// the properties are checked in order so the problems are always listed the same way
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			property, ok := schema.Properties[key]
+			if ok {
+				property.check(value[key], joinPath(path, key), problems)
+			} else if schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+				fail("can not have '%v'", key)
+			}
+		}
+	case []interface{}:
+		if schema.Items != nil {
+			for i, item := range value {
+				schema.Items.check(item, fmt.Sprintf("%v[%v]", path, i), problems)
+			}
+		}
+	case string:
+		length := len([]rune(value))
+		if schema.MinLength != nil && length < *schema.MinLength {
+			fail("must be at least %v characters long", *schema.MinLength)
+		}
+		if schema.MaxLength != nil && length > *schema.MaxLength {
+			fail("must be at most %v characters long", *schema.MaxLength)
+		}
+		if schema.Pattern != "" {
+			pattern, err := regexp.Compile(schema.Pattern)
+			if err != nil {
+				fail("can not be checked, the schema's pattern '%v' is not valid", schema.Pattern)
+			} else if !pattern.MatchString(value) {
+				fail("must match '%v'", schema.Pattern)
+			}
+		}
+	case float64:
+		if schema.Minimum != nil && value < *schema.Minimum {
+			fail("must be at least %v", *schema.Minimum)
+		}
+		if schema.Maximum != nil && value > *schema.Maximum {
+			fail("must be at most %v", *schema.Maximum)
+		}
+	}
+}
+
+// hasType returns true if the decoded JSON value is of the JSON Schema type
+func hasType(value interface{}, schemaType string) bool {
+	switch schemaType {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == math.Trunc(number)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return false
+}
+
+func inEnum(value interface{}, enum []interface{}) bool {
+	for _, allowed := range enum {
+		if reflect.DeepEqual(value, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+func enumList(enum []interface{}) string {
+	values := make([]string, len(enum))
+	for i, value := range enum {
+		data, _ := json.Marshal(value)
+		values[i] = string(data)
+	}
+	return strings.Join(values, ", ")
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,281 @@
+package ProcessManager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Josiah-B/Cyclone/Interfaces"
+)
+
+// StationConfigFile is a station config file in the StationConfigFolder
+type StationConfigFile struct {
+	// Name is the file name without its extension, which is also the name of the station's process
+	Name     string
+	ExecName string
+	Disabled bool `json:",omitempty"`
+	Modified time.Time
+	// Config is the whole file; it is left out of lists
+	Config json.RawMessage `json:",omitempty"`
+}
+
+// stationConfigPath returns the path of the named station config file; the name of a new file is '<name>.json'.
+// false is returned if there is no file with that name.
+func (prcMgr *ProcessMgr) stationConfigPath(name string) (string, bool, error) {
+	files, err := ioutil.ReadDir(prcMgr.configuration.StationConfigFolder)
+	if err != nil {
+		return "", false, Interfaces.BackendError(err)
+	}
+	for _, f := range files {
+		if isStationConfigFile(f) && stationConfigName(f.Name()) == name {
+			return filepath.Join(prcMgr.configuration.StationConfigFolder, f.Name()), true, nil
+		}
+	}
+	return filepath.Join(prcMgr.configuration.StationConfigFolder, name+".json"), false, nil
+}
+
+// isStationConfigFile returns false for folders and hidden files, such as the temporary files used while saving a config
+func isStationConfigFile(f os.FileInfo) bool {
+	return !f.IsDir() && !strings.HasPrefix(f.Name(), ".")
+}
+
+// stationConfigName returns the name of the station config file, which is its file name without the extension
+func stationConfigName(fileName string) string {
+	return strings.TrimSuffix(fileName, filepath.Ext(fileName))
+}
+
+// stationDefinition returns the definition of the process that runs the station config file at 'path'
+func stationDefinition(name string, path string, config stationConfig) ProcessDefinition {
+	return ProcessDefinition{
+		Name:     name,
+		Path:     config.ExecName,
+		Args:     []string{"-config=" + path},
+		Disabled: config.Disabled}
+}
+
+// readStationConfigFile reads a station config file; the whole file is only kept if 'full' is true
+func readStationConfigFile(path string, full bool) (StationConfigFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return StationConfigFile{}, Interfaces.BackendError(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return StationConfigFile{}, Interfaces.BackendError(err)
+	}
+
+	file := StationConfigFile{Name: stationConfigName(filepath.Base(path)), Modified: info.ModTime()}
+	var config stationConfig
+	if json.Unmarshal(data, &config) == nil {
+		file.ExecName = config.ExecName
+		file.Disabled = config.Disabled
+	}
+	if full {
+		file.Config = json.RawMessage(data)
+		if !json.Valid(data) {
+			// the file was not saved through the API, return it as a string so the response is still valid JSON
+			file.Config, _ = json.Marshal(string(data))
+		}
+	}
+	return file, nil
+}
+
+// StationConfigs lists the station config files, ordered by name
+func (prcMgr *ProcessMgr) StationConfigs() ([]StationConfigFile, error) {
+	prcMgr.configLock.Lock()
+	defer prcMgr.configLock.Unlock()
+
+	files, err := ioutil.ReadDir(prcMgr.configuration.StationConfigFolder)
+	if err != nil {
+		return nil, Interfaces.BackendError(err)
+	}
+	configs := []StationConfigFile{}
+	for _, f := range files {
+		if !isStationConfigFile(f) {
+			continue
+		}
+		file, err := readStationConfigFile(filepath.Join(prcMgr.configuration.StationConfigFolder, f.Name()), false)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, file)
+	}
+	sort.Slice(configs, func(i, j int) bool { return configs[i].Name < configs[j].Name })
+	return configs, nil
+}
+
+// StationConfig returns the named station config file
+func (prcMgr *ProcessMgr) StationConfig(name string) (StationConfigFile, error) {
+	prcMgr.configLock.Lock()
+	defer prcMgr.configLock.Unlock()
+
+	path, ok, err := prcMgr.stationConfigPath(name)
+	if err != nil {
+		return StationConfigFile{}, err
+	}
+	if !ok {
+		return StationConfigFile{}, Interfaces.NotFoundError("station config", name)
+	}
+	return readStationConfigFile(path, true)
+}
+
+// CreateStationConfig saves a new station config file as '<name>.json' and starts its process.
+// Interfaces.ErrConflict is returned if the file, or a process with the same name, already exists.
+func (prcMgr *ProcessMgr) CreateStationConfig(name string, data []byte) (StationConfigFile, error) {
+	prcMgr.configLock.Lock()
+	defer prcMgr.configLock.Unlock()
+
+	path, ok, err := prcMgr.stationConfigPath(name)
+	if err != nil {
+		return StationConfigFile{}, err
+	}
+	if ok {
+		return StationConfigFile{}, fmt.Errorf("%w: there is already a station config named '%v'", Interfaces.ErrConflict, name)
+	}
+	if _, err = prcMgr.process(name); err == nil {
+		return StationConfigFile{}, fmt.Errorf("%w: there is already a process named '%v'", Interfaces.ErrConflict, name)
+	}
+
+	definition, data, err := prcMgr.checkStationConfig(name, path, data)
+	if err != nil {
+		return StationConfigFile{}, err
+	}
+	if err = writeFileAtomically(path, data); err != nil {
+		return StationConfigFile{}, Interfaces.BackendError(err)
+	}
+	if _, err = prcMgr.CreateProc(definition); err != nil {
+		// the config is removed so creating it again is not refused as a conflict
+		if removeErr := os.Remove(path); removeErr != nil {
+			log.Println("Failed to remove the station config ", path, ": ", removeErr)
+		}
+		return StationConfigFile{}, err
+	}
+	return readStationConfigFile(path, true)
+}
+
+// UpdateStationConfig replaces a station config file and restarts its process so it uses the new config
+func (prcMgr *ProcessMgr) UpdateStationConfig(name string, data []byte) (StationConfigFile, error) {
+	prcMgr.configLock.Lock()
+	defer prcMgr.configLock.Unlock()
+
+	path, ok, err := prcMgr.stationConfigPath(name)
+	if err != nil {
+		return StationConfigFile{}, err
+	}
+	if !ok {
+		return StationConfigFile{}, Interfaces.NotFoundError("station config", name)
+	}
+
+	definition, data, err := prcMgr.checkStationConfig(name, path, data)
+	if err != nil {
+		return StationConfigFile{}, err
+	}
+	if err = writeFileAtomically(path, data); err != nil {
+		return StationConfigFile{}, Interfaces.BackendError(err)
+	}
+	if err = prcMgr.redefine(definition); err != nil {
+		return StationConfigFile{}, err
+	}
+	return readStationConfigFile(path, true)
+}
+
+// DeleteStationConfig stops the station's process and deletes its config file, returning the file as it was before it was deleted
+func (prcMgr *ProcessMgr) DeleteStationConfig(name string) (StationConfigFile, error) {
+	prcMgr.configLock.Lock()
+	defer prcMgr.configLock.Unlock()
+
+	path, ok, err := prcMgr.stationConfigPath(name)
+	if err != nil {
+		return StationConfigFile{}, err
+	}
+	if !ok {
+		return StationConfigFile{}, Interfaces.NotFoundError("station config", name)
+	}
+	file, err := readStationConfigFile(path, true)
+	if err != nil {
+		return StationConfigFile{}, err
+	}
+
+	if _, err = prcMgr.Remove(name); err != nil && !errors.Is(err, Interfaces.ErrNotFound) {
+		return StationConfigFile{}, err
+	}
+	if err = os.Remove(path); err != nil {
+		return StationConfigFile{}, Interfaces.BackendError(err)
+	}
+	return file, nil
+}
+
+// checkStationConfig validates a station config against its driver's schema and returns the definition of its process,
+// along with the config indented the way it is saved
+func (prcMgr *ProcessMgr) checkStationConfig(name string, path string, data []byte) (ProcessDefinition, []byte, error) {
+	if !validProcessName.MatchString(name) {
+		return ProcessDefinition{}, nil, Interfaces.ValidationError("the station config name '%v' may only contain letters, digits, '.', '_' and '-'", name)
+	}
+
+	var document interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return ProcessDefinition{}, nil, Interfaces.ValidationError("the station config is not valid JSON: %v", err)
+	}
+	var config stationConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return ProcessDefinition{}, nil, Interfaces.ValidationError("the station config must be an object with a string ExecName and a boolean Disabled: %v", err)
+	}
+	if config.ExecName == "" {
+		return ProcessDefinition{}, nil, Interfaces.ValidationError("the station config needs the ExecName of its driver")
+	}
+
+	definition := stationDefinition(name, path, config)
+	if _, err := prcMgr.checkDefinition(definition); err != nil {
+		return ProcessDefinition{}, nil, err
+	}
+
+	if folder := prcMgr.configuration.StationSchemaFolder; folder != "" {
+		schemaPath := filepath.Join(folder, filepath.Base(config.ExecName)+".schema.json")
+		schema, err := loadSchema(schemaPath)
+		if os.IsNotExist(err) {
+			return ProcessDefinition{}, nil, Interfaces.ValidationError("there is no schema for the driver '%v'", config.ExecName)
+		}
+		if err != nil {
+			return ProcessDefinition{}, nil, Interfaces.BackendError(err)
+		}
+		if problems := schema.Check(document); len(problems) > 0 {
+			return ProcessDefinition{}, nil, Interfaces.ValidationError("the station config does not match the schema of '%v': %v", config.ExecName, strings.Join(problems, "; "))
+		}
+	}
+
+	var indented bytes.Buffer
+	json.Indent(&indented, data, "", "\t")
+	indented.WriteString("\n")
+	return definition, indented.Bytes(), nil
+}
+
+// writeFileAtomically writes the file to a temporary file in the same folder, then renames it over 'path',
+// so the file is never left half written
+func writeFileAtomically(path string, data []byte) error {
+	temp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = temp.Write(data)
+	if err == nil {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+	}
+	return err
+}
@@ -0,0 +1,46 @@
+package ProcessManager
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Josiah-B/Cyclone/Interfaces"
+)
+
+func TestCreateStationConfig(t *testing.T) {
+	folder := t.TempDir()
+	prcMgr := newTestManager(Config{StationConfigFolder: folder, OutputLines: 10})
+	defer prcMgr.Shutdown(time.Second)
+
+	if _, err := prcMgr.CreateStationConfig("backyard", []byte(`{"ExecName":"davis","Disabled":true}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(folder, "backyard.json")); err != nil {
+		t.Errorf("the config file was not written: %v", err)
+	}
+	status, err := prcMgr.Process("backyard")
+	if err != nil || status.Enabled {
+		t.Errorf("got process %+v (%v), want a disabled process", status, err)
+	}
+
+	if _, err = prcMgr.CreateStationConfig("backyard", []byte(`{"ExecName":"davis"}`)); !errors.Is(err, Interfaces.ErrConflict) {
+		t.Errorf("got error %v creating the config again, want %v", err, Interfaces.ErrConflict)
+	}
+}
+
+func TestCreateStationConfigRemovesFileWhenProcessFails(t *testing.T) {
+	folder := t.TempDir()
+	prcMgr := newTestManager(Config{StationConfigFolder: folder, OutputLines: 10})
+	// processes can not be started once the manager is shutting down
+	prcMgr.Shutdown(time.Second)
+
+	if _, err := prcMgr.CreateStationConfig("backyard", []byte(`{"ExecName":"davis"}`)); !errors.Is(err, Interfaces.ErrConflict) {
+		t.Fatalf("got error %v, want %v", err, Interfaces.ErrConflict)
+	}
+	if _, err := os.Stat(filepath.Join(folder, "backyard.json")); !os.IsNotExist(err) {
+		t.Errorf("the config file was left behind: %v", err)
+	}
+}
@@ -0,0 +1,319 @@
+package ProcessManager
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// maxHistory is the number of exits remembered for each process
+const maxHistory = 10
+
+// outputDrainTime is how long the output of a process that has exited is still read
+const outputDrainTime = time.Second
+
+// ExitRecord describes one exit of a process
+type ExitRecord struct {
+	StartedAt time.Time
+	ExitedAt  time.Time
+	// ExitCode is -1 when the process was ended by a signal or could not be started
+	ExitCode int
+	Signal   string `json:",omitempty"`
+	// Reason says why the process was ended when it did not exit on its own, or why it could not be started
+	Reason string `json:",omitempty"`
+	// RestartAt is when the process was scheduled to be restarted; it is not set when the process was not restarted
+	RestartAt *time.Time `json:",omitempty"`
+}
+
+// supervise runs the process, restarting it each time it exits until it is stopped or crashes too often within the restart window
+func (prcMgr *ProcessMgr) supervise(prc *process, quit <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	window := time.Duration(prcMgr.configuration.RestartWindow) * time.Second
+	attempt := 0
+	for {
+		record := prcMgr.run(prc)
+		log.Println("Process exited: ", prc.name, " code: ", record.ExitCode, " ", record.Signal, record.Reason)
+
+		prc.lock.Lock()
+		if prc.stopRequested || prcMgr.stopping() {
+			prc.Status = StatusStopped
+			prc.addHistory(record)
+			prc.lock.Unlock()
+			return
+		}
+
+		now := time.Now()
+		attempt = restartAttempt(attempt, record, window)
+		prc.restarts = restartsSince(prc.restarts, now.Add(-window))
+		if prcMgr.configuration.MaxRestarts > 0 && len(prc.restarts) >= prcMgr.configuration.MaxRestarts {
+			prc.Status = StatusFailed
+			prc.addHistory(record)
+			prc.lock.Unlock()
+			log.Println("Process restarted ", len(prc.restarts), " times within ", window, ", it will not be restarted again: ", prc.name)
+			return
+		}
+
+		delay := prcMgr.restartDelay(attempt)
+		attempt++
+		restartAt := now.Add(delay)
+		record.RestartAt = &restartAt
+		prc.nextRestart = restartAt
+		prc.Status = StatusBackoff
+		prc.addHistory(record)
+		prc.lock.Unlock()
+
+		select {
+		case <-time.After(delay):
+		case <-quit:
+			prc.setStatus(StatusStopped, false)
+			return
+		case <-prcMgr.stop:
+			prc.setStatus(StatusStopped, false)
+			return
+		}
+
+		prc.lock.Lock()
+		if prc.stopRequested {
+			prc.Status = StatusStopped
+			prc.lock.Unlock()
+			return
+		}
+		prc.restarts = append(prc.restarts, time.Now())
+		prc.restartCount++
+		prc.lock.Unlock()
+	}
+}
+
+// run starts the process and waits for it to exit. Processes that stop sending heartbeats are killed.
+func (prcMgr *ProcessMgr) run(prc *process) ExitRecord {
+	command := exec.Command(prc.pathToExec, prc.args...)
+	if len(prc.env) > 0 {
+		command.Env = append(os.Environ(), prc.env...)
+	}
+	stdout, stderr, err := startCommand(command)
+	startedAt := time.Now()
+	if err != nil {
+		log.Println("Failed to start process: ", prc.name, " ; ", err)
+		prc.lock.Lock()
+		prc.errors = err
+		prc.lock.Unlock()
+		return ExitRecord{StartedAt: startedAt, ExitedAt: startedAt, ExitCode: -1, Reason: "failed to start: " + err.Error()}
+	}
+
+	exited := make(chan struct{})
+	prc.lock.Lock()
+	prc.command = command
+	prc.exited = exited
+	prc.errors = nil
+	// the protocol state belongs to the previous command, which may have run a different driver
+	prc.usesProtocol = false
+	prc.lastStatus = nil
+	prc.lastError = nil
+	prc.StartedAt = startedAt
+	prc.LastHeartbeat = startedAt
+	prc.Status = StatusStarting
+	// the process may have been stopped while it was starting
+	if prc.stopRequested || prcMgr.stopping() {
+		command.Process.Kill()
+	}
+	prc.lock.Unlock()
+
+	reason := make(chan string, 1)
+	go prcMgr.watchdog(prc, command, exited, reason)
+
+	var listening sync.WaitGroup
+	listening.Add(2)
+	go func() {
+		defer listening.Done()
+		prcMgr.listen(prc, stdout, Stdout)
+	}()
+	go func() {
+		defer listening.Done()
+		prcMgr.listen(prc, stderr, Stderr)
+	}()
+	err = command.Wait()
+
+	// the rest of the output is read for up to outputDrainTime, then the pipes are closed in case a child of the process still has them open
+	drained := make(chan struct{})
+	go func() {
+		listening.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(outputDrainTime):
+		stdout.Close()
+		stderr.Close()
+		<-drained
+	}
+	stdout.Close()
+	stderr.Close()
+	close(exited)
+
+	record := exitRecord(startedAt, command.ProcessState, err)
+	if killedFor := <-reason; killedFor != "" {
+		record.Reason = killedFor
+	}
+
+	prc.lock.Lock()
+	prc.exited = nil
+	prc.lock.Unlock()
+	return record
+}
+
+// startCommand starts the command with its stdout and stderr connected to pipes, returning their read ends. The pipes are created here
+// rather than with StdoutPipe so they can be closed once the process has exited, even if a child it started still has them open.
+func startCommand(command *exec.Cmd) (*os.File, *os.File, error) {
+	stdout, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer stdoutWriter.Close()
+	stderr, stderrWriter, err := os.Pipe()
+	if err != nil {
+		stdout.Close()
+		return nil, nil, err
+	}
+	defer stderrWriter.Close()
+
+	// the process gets its own copies of the write ends, ours are closed so the reads end when it exits
+	command.Stdout = stdoutWriter
+	command.Stderr = stderrWriter
+	if err = command.Start(); err != nil {
+		stdout.Close()
+		stderr.Close()
+		return nil, nil, err
+	}
+	return stdout, stderr, nil
+}
+
+// listen reads one of the process's output streams into its output log. The messages the process sends on stdout are handled,
+// and the lastHeartbeat variable is updated whenever a heartbeat is recieved from the process.
+func (prcMgr *ProcessMgr) listen(prc *process, reader io.Reader, stream string) {
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		text := scanner.Text()
+		if stream == Stdout {
+			text = prcMgr.handleLine(prc, text)
+		} else {
+			prc.plainHeartbeat()
+		}
+		prc.output.write(stream, text)
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, os.ErrClosed) {
+		fmt.Println(err)
+		// keep reading so the process does not block writing to a full pipe
+		io.Copy(ioutil.Discard, reader)
+	}
+}
+
+// watchdog kills the process if it has not sent a heartbeat within the heartbeat timeout. The reason it was killed, or "" if it
+// exited on its own, is sent to 'reason'.
+func (prcMgr *ProcessMgr) watchdog(prc *process, command *exec.Cmd, exited chan struct{}, reason chan<- string) {
+	timeout := time.Duration(prcMgr.configuration.HeartbeatTimeout) * time.Second
+	if timeout <= 0 {
+		reason <- ""
+		return
+	}
+
+	ticker := time.NewTicker(time.Second * 5)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-exited:
+			reason <- ""
+			return
+		case <-ticker.C:
+			if _, lastHeartbeat := prc.state(); time.Since(lastHeartbeat) > timeout {
+				log.Println("Process has not sent a heartbeat in ", timeout, ", restarting it: ", prc.name)
+				command.Process.Kill()
+				reason <- fmt.Sprintf("no heartbeat for %v", timeout)
+				return
+			}
+		}
+	}
+}
+
+// exitRecord creates the record of a process that has exited
+func exitRecord(startedAt time.Time, state *os.ProcessState, err error) ExitRecord {
+	record := ExitRecord{StartedAt: startedAt, ExitedAt: time.Now(), ExitCode: -1}
+	if state == nil {
+		if err != nil {
+			record.Reason = err.Error()
+		}
+		return record
+	}
+
+	record.ExitCode = state.ExitCode()
+	if status, ok := state.Sys().(interface {
+		Signaled() bool
+		Signal() syscall.Signal
+	}); ok && status.Signaled() {
+		record.Signal = status.Signal().String()
+	}
+	return record
+}
+
+// restartDelay returns the delay before the next restart: RestartDelay doubled for each 'attempt', up to MaxRestartDelay,
+// randomised between half and all of that so processes that crash together are not all restarted together
+func (prcMgr *ProcessMgr) restartDelay(attempt int) time.Duration {
+	delay := time.Duration(prcMgr.configuration.RestartDelay) * time.Second
+	maxDelay := time.Duration(prcMgr.configuration.MaxRestartDelay) * time.Second
+	for i := 0; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// restartAttempt returns the attempt number of the next restart after the exit 'record'. A process that ran for a whole window
+// was not crash looping, so it starts again from the shortest delay.
+func restartAttempt(attempt int, record ExitRecord, window time.Duration) int {
+	if record.ExitedAt.Sub(record.StartedAt) >= window {
+		return 0
+	}
+	return attempt
+}
+
+// restartsSince returns the restarts that happened after 'since'
+func restartsSince(restarts []time.Time, since time.Time) []time.Time {
+	var recent []time.Time
+	for _, restart := range restarts {
+		if restart.After(since) {
+			recent = append(recent, restart)
+		}
+	}
+	return recent
+}
+
+// addHistory remembers the exit, forgetting the oldest one once there are maxHistory; the lock must be held
+func (prc *process) addHistory(record ExitRecord) {
+	prc.history = append(prc.history, record)
+	if len(prc.history) > maxHistory {
+		prc.history = prc.history[len(prc.history)-maxHistory:]
+	}
+}
+
+// stopping returns true once Shutdown has been called
+func (prcMgr *ProcessMgr) stopping() bool {
+	select {
+	case <-prcMgr.stop:
+		return true
+	default:
+		return false
+	}
+}
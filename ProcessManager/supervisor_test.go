@@ -0,0 +1,135 @@
+package ProcessManager
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// helperProcessEnv makes the test binary act as a station process that exits straight away with helperExitCode
+const (
+	helperProcessEnv = "CYCLONE_HELPER_PROCESS=1"
+	helperExitCode   = 3
+)
+
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("CYCLONE_HELPER_PROCESS") != "1" {
+		return
+	}
+	os.Exit(helperExitCode)
+}
+
+// newTestManager creates a process manager without a config file
+func newTestManager(config Config) *ProcessMgr {
+	return &ProcessMgr{
+		processes:     make(map[string]*process),
+		configuration: config,
+		stop:          make(chan struct{})}
+}
+
+func TestRestartDelay(t *testing.T) {
+	prcMgr := newTestManager(Config{RestartDelay: 1, MaxRestartDelay: 10})
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{3, 8 * time.Second},
+		{4, 10 * time.Second},
+		{50, 10 * time.Second},
+	}
+	for _, test := range tests {
+		// the delay is randomised between half and all of the backoff
+		for i := 0; i < 100; i++ {
+			if delay := prcMgr.restartDelay(test.attempt); delay < test.max/2 || delay > test.max {
+				t.Fatalf("attempt %v: got a delay of %v, want %v to %v", test.attempt, delay, test.max/2, test.max)
+			}
+		}
+	}
+
+	if delay := newTestManager(Config{}).restartDelay(3); delay != 0 {
+		t.Errorf("got a delay of %v without a RestartDelay, want 0", delay)
+	}
+}
+
+func TestRestartAttempt(t *testing.T) {
+	window := time.Minute
+	startedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		ranFor time.Duration
+		want   int
+	}{
+		{time.Second, 4},
+		{window - time.Second, 4},
+		{window, 0},
+		{time.Hour, 0},
+	}
+	for _, test := range tests {
+		record := ExitRecord{StartedAt: startedAt, ExitedAt: startedAt.Add(test.ranFor)}
+		if got := restartAttempt(4, record, window); got != test.want {
+			t.Errorf("ran for %v: got attempt %v, want %v", test.ranFor, got, test.want)
+		}
+	}
+}
+
+func TestRestartsSince(t *testing.T) {
+	now := time.Now()
+	restarts := []time.Time{now.Add(-3 * time.Minute), now.Add(-2 * time.Minute), now.Add(-time.Minute), now}
+
+	recent := restartsSince(restarts, now.Add(-2*time.Minute))
+	if len(recent) != 2 || !recent[0].Equal(restarts[2]) || !recent[1].Equal(restarts[3]) {
+		t.Errorf("got %v, want the last 2 restarts", recent)
+	}
+	if recent = restartsSince(restarts, now); len(recent) != 0 {
+		t.Errorf("got %v, want none", recent)
+	}
+}
+
+func TestSuperviseFailsAfterMaxRestarts(t *testing.T) {
+	executable, err := os.Executable()
+	if err != nil {
+		t.Skip("the test binary can not be run as a process: ", err)
+	}
+	prcMgr := newTestManager(Config{MaxRestarts: 2, RestartWindow: 60, StopTimeout: 1, OutputLines: 10})
+	defer prcMgr.Shutdown(time.Second)
+
+	_, err = prcMgr.CreateProc(ProcessDefinition{
+		Name: "crashing",
+		Path: executable,
+		Args: []string{"-test.run=^TestHelperProcess$"},
+		Env:  []string{helperProcessEnv}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var status ProcessStatus
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if status, err = prcMgr.Process("crashing"); err != nil {
+			t.Fatal(err)
+		}
+		if status.Status == StatusFailed {
+			break
+		}
+	}
+
+	if status.Status != StatusFailed {
+		t.Fatalf("got status %v, want %v", status.Status, StatusFailed)
+	}
+	if status.Restarts != 2 || status.RecentRestarts != 2 {
+		t.Errorf("got %v restarts (%v recent), want 2", status.Restarts, status.RecentRestarts)
+	}
+	if len(status.History) != 3 {
+		t.Fatalf("got %v exits, want 3", len(status.History))
+	}
+	for i, record := range status.History {
+		if record.ExitCode != helperExitCode {
+			t.Errorf("exit %v: got exit code %v, want %v", i, record.ExitCode, helperExitCode)
+		}
+		// every exit but the last was followed by a restart
+		if restarted := record.RestartAt != nil; restarted != (i < len(status.History)-1) {
+			t.Errorf("exit %v: got RestartAt %v", i, record.RestartAt)
+		}
+	}
+}
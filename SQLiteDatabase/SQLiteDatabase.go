@@ -2,15 +2,20 @@ package SQLiteDatabase
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/Josiah-B/Cyclone/Auth"
 	"github.com/Josiah-B/Cyclone/Interfaces"
 	// this is needed for the sqlite3 database to function properly
 	_ "github.com/mattn/go-sqlite3"
 )
 
-// createDBquery is an SQL query for creating the initial database
+// createDBquery is an SQL query for creating the initial database; it is the first migration in the upgrade chain (see migrations.go)
 // the 'Settings' Table is for version control
 const createDBQuery string = `CREATE TABLE 'Settings'
 (
@@ -73,6 +78,8 @@ INSERT INTO Settings (Version) VALUES (1);`
 type SqliteSettings struct {
 	//Path Defines the filepath to the database
 	Path string
+	//SkipUpgrade opens the database without applying the pending migrations, so they can be listed first
+	SkipUpgrade bool
 }
 
 // DataBase is the type class for the SQLite3 database implementation
@@ -87,38 +94,34 @@ type DataBase struct {
 	version int
 }
 
-func (db *DataBase) Initilize() {
+func (db *DataBase) Initilize() error {
 	// initilize array that will hold the weather stations current conditions
+	return nil
 }
 
 //Open connects to the database, creating it if nessasary
-func (db *DataBase) Open() {
+func (db *DataBase) Open() error {
 	db.BackingDB, db.databaseError = sql.Open("sqlite3", db.Configuration.Path)
 	if db.databaseError != nil {
 		fmt.Println(db.databaseError)
+	} else if db.Configuration.SkipUpgrade {
+		db.version = db.getSchemaVersion()
 	} else {
 		db.createAndUpgrade()
 	}
 
+	return Interfaces.BackendError(db.databaseError)
 }
 
 func (db *DataBase) createAndUpgrade() {
-	db.version = db.getSchemaVersion() // get the current database schema version
-
-	if db.version < 1 { // if the database schema version is < 1 we know the tables have not been created yet
-		db.create()                        // create the database tables
-		db.version = db.getSchemaVersion() // refresh the database version with the current; this also allows os to verify that the create operation succeded
-	}
-	fmt.Printf("DataBase Version is: %v\n", db.version)
-}
+	db.version = db.getSchemaVersion() // get the current database schema version; a version < 1 means the tables have not been created yet
 
-// Create creates the database
-func (db *DataBase) create() {
-	fmt.Println("Creating Database...")
-	_, db.databaseError = db.BackingDB.Exec(createDBQuery)
+	// run every migration that has not been applied yet, this also creates the database tables if needed
+	_, db.databaseError = db.Upgrade(false)
 	if db.databaseError != nil {
 		fmt.Println(db.databaseError)
 	}
+	fmt.Printf("DataBase Version is: %v\n", db.version)
 }
 
 func (db *DataBase) getSchemaVersion() int {
@@ -130,117 +133,149 @@ func (db *DataBase) getSchemaVersion() int {
 	db.databaseError = row.Scan(&version)
 	// if the 'Select version' query throws an error then the database has not been created
 	if db.databaseError != nil {
+		fmt.Println(db.databaseError)
 		db.databaseError = nil // clear the database error
 		version = -1           // set the database version to -1 meaning we do not know
-		fmt.Println(db.databaseError)
 	}
 	return version
 }
 
+// Version returns the schema version of the database; it is -1 if the tables have not been created yet
+func (db *DataBase) Version() int {
+	return db.version
+}
+
 // Close closes the database flushing any changes to disk
-func (db *DataBase) Close() {
-	db.BackingDB.Close()
+func (db *DataBase) Close() error {
+	if db.BackingDB == nil {
+		return nil
+	}
+	return Interfaces.BackendError(db.BackingDB.Close())
 }
 
-// Upgrade checks the database schema version and (if needed) upgrades it to the latest version
-func (db *DataBase) Upgrade() {
+// Upgrade checks the database schema version and (if needed) upgrades it to the latest version.
+// Migrations are applied in order, each in its own transaction; the first one to fail is rolled back and returned as a *MigrationError.
+// If dryRun is true nothing is changed and the list of migrations that would be applied is returned.
+func (db *DataBase) Upgrade(dryRun bool) ([]Migration, error) {
+	pending := db.PendingMigrations()
+	if dryRun {
+		for _, m := range pending {
+			fmt.Printf("Pending migration to version %v: %v\n", m.Version, m.Description)
+		}
+		return pending, nil
+	}
 
+	for index, m := range pending {
+		fmt.Printf("Upgrading database to version %v: %v\n", m.Version, m.Description)
+		if err := db.runMigration(m); err != nil {
+			return pending[index:], &MigrationError{Migration: m, Err: err}
+		}
+		db.version = m.Version
+	}
+	return nil, nil
 }
 
 // AddOrUpdateStation adds a new station to the database. If a station with the stn.StationID is already in the database this function will update it with the new values.
-func (db *DataBase) AddOrUpdateStation(stn *Interfaces.Station) {
-	tx, err := db.BackingDB.Begin()
-	stmt, err := tx.Prepare("INSERT OR REPLACE INTO Station (Name, Description, Latitude, Longitude) VALUES ((SELECT StationID FROM Station WHERE StationID = ?),?,?,?,?)")
-	stmt.Exec(stn.StationID, stn.Name, stn.Description, stn.Latitude, stn.Longitude)
-
-	for i := 0; i < len(stn.Streams); i++ {
-		stmt, err = tx.Prepare("INSERT OR REPLACE INTO DataStream (StationID, StreamID, ObservedPropertyID, SensorID, UnitTypeID) VALUES (?,(SELECT StreamID FROM DataStreams WHERE StreamID = ?),?,?,?)")
-		stmt.Exec(&stn.StationID, &stn.Streams[i].StreamID, &stn.Streams[i].ObservedPropertyID, &stn.Streams[i].SensorID, &stn.Streams[i].UnitTypeID)
+func (db *DataBase) AddOrUpdateStation(stn *Interfaces.Station) error {
+	if err := stn.Validate(); err != nil {
+		return err
 	}
 
-	// rollback the operation if there was an error
-	if err != nil {
-		tx.Rollback()
-	} else { // commit the changes if there were no errors
-		tx.Commit()
+	// keep the current password hash unless a new password was given
+	var passwordHash sql.NullString
+	if stn.UploadPassword != "" {
+		hashed, err := Auth.HashSecret(stn.UploadPassword)
+		if err != nil {
+			return Interfaces.BackendError(err)
+		}
+		passwordHash = sql.NullString{String: hashed, Valid: true}
+		stn.UploadPassword = ""
 	}
 
-}
-
-func (db *DataBase) addStation(stn *Interfaces.StationUploadTemplate) error {
 	tx, err := db.BackingDB.Begin()
-	stmt, err := tx.Prepare("INSERT INTO Station (Name, Description, Latitude, Longitude) VALUES (?,?,?,?)")
-	// rollback the operation if there was an error
 	if err != nil {
-		tx.Rollback()
-		fmt.Println(err)
-		return err
+		return Interfaces.BackendError(err)
 	}
 
-	res, err2 := stmt.Exec(stn.StationName, "none", "n/a", "n/a")
+	res, err := tx.Exec("INSERT OR REPLACE INTO Station (StationID, Name, Description, Latitude, Longitude, TimeZone, Elevation, DeviceKey, UploadPasswordHash) VALUES ((SELECT StationID FROM Station WHERE StationID = ?),?,?,?,?,?,?,?,COALESCE(?,(SELECT UploadPasswordHash FROM Station WHERE StationID = ?)))", stn.StationID, stn.Name, stn.Description, stn.Latitude, stn.Longitude, stn.TimeZone, stn.Elevation, nullString(stn.DeviceKey), passwordHash, stn.StationID)
+	if err == nil {
+		var id int64
+		id, err = res.LastInsertId()
+		stn.StationID = int(id)
+	}
 
-	if err2 != nil {
-		tx.Rollback()
-		return err2
+	for i := 0; i < len(stn.Streams) && err == nil; i++ {
+		stn.Streams[i].StationID = stn.StationID
+		_, err = tx.Exec("INSERT OR REPLACE INTO DataStream (StationID, StreamID, ObservedPropertyID, SensorID, UnitTypeID) VALUES (?,(SELECT StreamID FROM DataStream WHERE StreamID = ?),?,?,?)", stn.StationID, stn.Streams[i].StreamID, stn.Streams[i].ObservedPropertyID, stn.Streams[i].SensorID, stn.Streams[i].UnitTypeID)
 	}
 
-	// commit the changes if there were no errors
-	tx.Commit()
-	fmt.Println(res)
-	return nil
+	// rollback the operation if there was an error, otherwise commit the changes
+	return finishTransaction(tx, err)
+}
 
+func (db *DataBase) addStation(stn *Interfaces.StationUploadTemplate) error {
+	_, err := db.BackingDB.Exec("INSERT INTO Station (Name, Description, Latitude, Longitude) VALUES (?,?,?,?)", stn.StationName, "none", "n/a", "n/a")
+	return Interfaces.BackendError(err)
 }
 
 //LogConditions pushes the current station to the database thus logging the conditions
 func (db *DataBase) LogConditions(currentConditions *Interfaces.StationUploadTemplate) error {
+	if err := currentConditions.Validate(); err != nil {
+		return err
+	}
 
 	currentStation, err := db.GetStationByName(currentConditions.StationName)
-	fmt.Println(err)
-	fmt.Print("Station ")
 
-	if currentStation == nil {
-		fmt.Print(currentConditions.StationName)
-		fmt.Println("does not exist. Attempting to create it...")
-		err := db.addStation(currentConditions)
-		if err != nil {
-			return errors.New("Cannot Find Station; failed to add it to the database")
+	if errors.Is(err, Interfaces.ErrNotFound) {
+		fmt.Println("Station " + currentConditions.StationName + " does not exist. Attempting to create it...")
+		if err = db.addStation(currentConditions); err != nil {
+			return fmt.Errorf("cannot find station; failed to add it to the database: %w", err)
 		}
 		currentStation, err = db.GetStationByName(currentConditions.StationName)
-
-		fmt.Println(currentStation, err)
 		fmt.Println("Station created!")
 	}
+	if err != nil {
+		return err
+	}
 
-	fmt.Println(currentStation.StationID)
-
-	for sensorName, value := range currentConditions.SensorReadings {
-		var currentDataStream = db.GetDataStreamBySensorName(sensorName, int64(currentStation.StationID))
-		var dataStreamID = -1
-		fmt.Print("Current Data Stream: ")
-		fmt.Println(currentDataStream)
-		if currentDataStream != nil {
+	for sensorName, reading := range currentConditions.SensorReadings {
+		var dataStreamID int
+		currentDataStream, err := db.GetDataStreamBySensorName(sensorName, int64(currentStation.StationID))
+		if err == nil {
 			dataStreamID = currentDataStream.StreamID
-		} else {
+		} else if errors.Is(err, Interfaces.ErrNotFound) {
 			// create a new datastream if one does not exist for this sensor
-			dataStreamID = int(db.createDataStream(currentStation.StationID, sensorName, ""))
+			newID, err := db.createDataStream(currentStation.StationID, sensorName, "")
+			if err != nil {
+				return err
+			}
+			dataStreamID = int(newID)
+		} else {
+			return err
 		}
 
 		observ := Interfaces.Observation{
 			DataStreamID: dataStreamID,
 			TimeStamp:    currentConditions.TimeStamp,
-			Value:        value}
+			Value:        reading.Value,
+			RawValue:     reading.Raw}
 
 		// push the current observation to the DB
-		db.AddObservation(&observ)
+		if err = db.AddObservation(&observ); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
 // creates a new dataStream and returns the StreamID
-func (db *DataBase) createDataStream(stationID int, sensorName string, sensorDescription string) int64 {
+func (db *DataBase) createDataStream(stationID int, sensorName string, sensorDescription string) (int64, error) {
 	// Create the sensor
 	tempSensor := Interfaces.Sensor{Name: sensorName, Description: sensorDescription}
-	sensorID := db.AddOrUpdateSensor(&tempSensor)
+	sensorID, err := db.AddOrUpdateSensor(&tempSensor)
+	if err != nil {
+		return -1, err
+	}
 
 	// Create the observed Property... which can be created later
 
@@ -248,265 +283,847 @@ func (db *DataBase) createDataStream(stationID int, sensorName string, sensorDes
 	dataStream := Interfaces.DataStream{
 		StationID: stationID,
 		SensorID:  int(sensorID)}
-	fmt.Println("DataStream:")
-	fmt.Println(dataStream)
 	return db.AddDataStream(&dataStream)
 }
 
-func (db *DataBase) AddOrUpdateUnitType(unit *Interfaces.UnitType) {
+func (db *DataBase) AddOrUpdateUnitType(unit *Interfaces.UnitType) error {
+	if err := unit.Validate(); err != nil {
+		return err
+	}
+
 	var updateQuery = "INSERT OR REPLACE INTO UnitType (UnitTypeID,Name,UnitOfMeasure,Description) VALUES ((SELECT UnitTypeID FROM UnitType WHERE UnitTypeID = ?),?,?,?)"
-	db.BackingDB.Exec(updateQuery, &unit.UnitTypeID, &unit.Name, &unit.UnitOfMeasure, &unit.Description)
+	id, err := db.execInsert(updateQuery, unit.UnitTypeID, unit.Name, unit.UnitOfMeasure, unit.Description)
+	if err == nil {
+		unit.UnitTypeID = int(id)
+	}
+	return err
 }
 
 // AddOrUpdateSensor updates the current sensor or creates a new one if it does not exist. Returns the ID number fot the newly created sensor.
-func (db *DataBase) AddOrUpdateSensor(sensor *Interfaces.Sensor) int64 {
-	var updateQuery = "INSERT OR REPLACE INTO Sensor (SensorID, Name, Description) VALUES ((SELECT SensorID FROM Sensor WHERE SensorID = ?),?,?)"
-	res, _ := db.BackingDB.Exec(updateQuery, &sensor.SensorID, &sensor.Name, &sensor.Description)
-	id, _ := res.LastInsertId()
-	return id
+func (db *DataBase) AddOrUpdateSensor(sensor *Interfaces.Sensor) (int64, error) {
+	if err := sensor.Validate(); err != nil {
+		return -1, err
+	}
 
+	var updateQuery = "INSERT OR REPLACE INTO Sensor (SensorID, Name, Description) VALUES ((SELECT SensorID FROM Sensor WHERE SensorID = ?),?,?)"
+	id, err := db.execInsert(updateQuery, sensor.SensorID, sensor.Name, sensor.Description)
+	if err == nil {
+		sensor.SensorID = int(id)
+	}
+	return id, err
 }
 
-func (db *DataBase) AddOrUpdateObservedProperty(observedProperty *Interfaces.ObservedProperty) {
-	var updateQuery = "INSERT OR REPLACE INTO ObservedProperty (PropertyID, Name, Description) VALUES ((SELECT PropertyID FROM ObservedProprty WHERE PropertyID = ?),?,?)"
-	db.BackingDB.Exec(updateQuery, &observedProperty.PropertyID, &observedProperty.Name, &observedProperty.Description)
+func (db *DataBase) AddOrUpdateObservedProperty(observedProperty *Interfaces.ObservedProperty) error {
+	if err := observedProperty.Validate(); err != nil {
+		return err
+	}
+
+	var updateQuery = "INSERT OR REPLACE INTO ObservedProperty (PropertyID, Name, Description) VALUES ((SELECT PropertyID FROM ObservedProperty WHERE PropertyID = ?),?,?)"
+	id, err := db.execInsert(updateQuery, observedProperty.PropertyID, observedProperty.Name, observedProperty.Description)
+	if err == nil {
+		observedProperty.PropertyID = int(id)
+	}
+	return err
 }
 
-func (db *DataBase) AddDataStream(dataStream *Interfaces.DataStream) int64 {
+func (db *DataBase) AddDataStream(dataStream *Interfaces.DataStream) (int64, error) {
+	if err := dataStream.Validate(); err != nil {
+		return -1, err
+	}
+
 	var updateQuery = "INSERT INTO DataStream (StationID, ObservedPropertyID, SensorID, UnitTypeID) VALUES (?,?,?,?)"
-	res, _ := db.BackingDB.Exec(updateQuery, &dataStream.StationID, &dataStream.ObservedPropertyID, &dataStream.SensorID, &dataStream.UnitTypeID)
-	id, _ := res.LastInsertId()
-	return id
+	id, err := db.execInsert(updateQuery, dataStream.StationID, dataStream.ObservedPropertyID, dataStream.SensorID, dataStream.UnitTypeID)
+	if err == nil {
+		dataStream.StreamID = int(id)
+	}
+	return id, err
+}
+
+func (db *DataBase) UpdateDataStream(dataStream *Interfaces.DataStream) error {
+	if err := dataStream.Validate(); err != nil {
+		return err
+	}
+
+	var updateQuery = "UPDATE DataStream SET StationID = ?, ObservedPropertyID = ?, SensorID = ?, UnitTypeID = ? WHERE StreamID = ?"
+	res, err := db.BackingDB.Exec(updateQuery, dataStream.StationID, dataStream.ObservedPropertyID, dataStream.SensorID, dataStream.UnitTypeID, dataStream.StreamID)
+	if err != nil {
+		return Interfaces.BackendError(err)
+	}
+	if count, _ := res.RowsAffected(); count == 0 {
+		return Interfaces.NotFoundError("data stream", dataStream.StreamID)
+	}
+	return nil
 }
 
-func (db *DataBase) UpdateDataStream(dataStream *Interfaces.DataStream) {
-	var updateQuery = "REPLACE INTO DataStream (StationID, StreamID, ObservedPropertyID, SensorID, UnitTypeID) VALUES (?,(SELECT StreamID FROM DataStream WHERE StreamID = ?),?,?,?,?)"
-	db.BackingDB.Exec(updateQuery, &dataStream.StationID, &dataStream.StreamID, &dataStream.ObservedPropertyID, &dataStream.SensorID, &dataStream.UnitTypeID)
+func (db *DataBase) AddObservation(observation *Interfaces.Observation) error {
+	if err := observation.Validate(); err != nil {
+		return err
+	}
+
+	// time stamps are stored in UTC so that they compare and sort correctly as text
+	var updateQuery = "INSERT INTO Observation (DataStreamID, TimeStamp, Value, RawValue) VALUES (?,?,?,?)"
+	id, err := db.execInsert(updateQuery, observation.DataStreamID, observation.TimeStamp.UTC(), observation.Value, nullString(observation.RawValue))
+	if err == nil {
+		observation.ObservationID = int(id)
+	}
+	return err
 }
 
-func (db *DataBase) AddObservation(observation *Interfaces.Observation) {
-	var updateQuery = "INSERT INTO Observation (DataStreamID, TimeStamp, Value) VALUES (?,?,?)"
-	db.BackingDB.Exec(updateQuery, &observation.DataStreamID, &observation.TimeStamp, &observation.Value)
+// execInsert runs an insert query and returns the ID of the inserted row
+func (db *DataBase) execInsert(query string, args ...interface{}) (int64, error) {
+	res, err := db.BackingDB.Exec(query, args...)
+	if err != nil {
+		return -1, Interfaces.BackendError(err)
+	}
+	id, err := res.LastInsertId()
+	return id, Interfaces.BackendError(err)
 }
 
-// GetStation retrieves from the database a Station with ID number 'stationID'
-func (db *DataBase) GetStation(stationID string) *Interfaces.Station {
+// selectStationQuery selects every column needed by scanStation
+const selectStationQuery = "SELECT StationID, Name, Description, Latitude, Longitude, TimeZone, Elevation, DeviceKey FROM Station"
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanStation reads a station from a row selected with selectStationQuery
+func scanStation(row rowScanner) (*Interfaces.Station, error) {
 	var stn Interfaces.Station
-	row := db.BackingDB.QueryRow("SELECT StationID, Name, Description, Latitude, Longitude FROM Station WHERE StationID = ?", stationID)
-	err := row.Scan(&stn.StationID, &stn.Name, &stn.Description, &stn.Latitude, &stn.Longitude)
+	var elevation sql.NullFloat64
+	var deviceKey sql.NullString
+	err := row.Scan(&stn.StationID, &stn.Name, &stn.Description, &stn.Latitude, &stn.Longitude, &stn.TimeZone, &elevation, &deviceKey)
+	if err != nil {
+		return nil, err
+	}
+	stn.DeviceKey = deviceKey.String
+	if elevation.Valid {
+		stn.Elevation = &elevation.Float64
+	}
+	return &stn, nil
+}
+
+// selectObservationQuery selects every column needed by scanObservation
+const selectObservationQuery = "SELECT Observation.ObservationID, Observation.DataStreamID, Observation.TimeStamp, Observation.Value, Observation.RawValue FROM Observation"
 
+// scanObservation reads an observation from a row selected with selectObservationQuery
+func scanObservation(row rowScanner) (*Interfaces.Observation, error) {
+	var observation Interfaces.Observation
+	var value sql.NullFloat64
+	var rawValue sql.NullString
+
+	err := row.Scan(&observation.ObservationID, &observation.DataStreamID, &observation.TimeStamp, &value, &rawValue)
 	if err != nil {
-		return nil
+		return nil, err
 	}
 
-	return &stn
+	if value.Valid {
+		observation.Value = &value.Float64
+	}
+	observation.RawValue = rawValue.String
+	return &observation, nil
+}
+
+// nullString stores empty strings as NULL
+func nullString(text string) sql.NullString {
+	return sql.NullString{String: text, Valid: text != ""}
+}
+
+// scanError converts the error from scanning a single row into one of the storage errors
+func scanError(err error, itemType string, id interface{}) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return Interfaces.NotFoundError(itemType, id)
+	}
+	return Interfaces.BackendError(err)
+}
+
+// GetStation retrieves from the database a Station with ID number 'stationID'
+func (db *DataBase) GetStation(stationID string) (*Interfaces.Station, error) {
+	stn, err := scanStation(db.BackingDB.QueryRow(selectStationQuery+" WHERE StationID = ?", stationID))
+
+	if err != nil {
+		return nil, scanError(err, "station", stationID)
+	}
+
+	return stn, nil
 }
 
 // GetStation retrieves from the database a Station with name 'stationName'
 func (db *DataBase) GetStationByName(stationName string) (*Interfaces.Station, error) {
-	fmt.Println("Attempting to get the following station from the database: ", stationName)
-	var stn Interfaces.Station
-	row := db.BackingDB.QueryRow("SELECT StationID, Name, Description, Latitude, Longitude FROM Station WHERE Name = ?", stationName)
-	err := row.Scan(&stn.StationID, &stn.Name, &stn.Description, &stn.Latitude, &stn.Longitude)
-	fmt.Println("Results of the database search: ", stn, err)
+	stn, err := scanStation(db.BackingDB.QueryRow(selectStationQuery+" WHERE Name = ?", stationName))
 	if err != nil {
-		return nil, err
+		return nil, scanError(err, "station", stationName)
 	}
 
-	return &stn, nil
+	return stn, nil
 }
 
 // GetStations retrieves all of the stations from the database
-func (db *DataBase) GetStations() []Interfaces.Station {
+func (db *DataBase) GetStations() ([]Interfaces.Station, error) {
 	var stns []Interfaces.Station
 
-	rows, err := db.BackingDB.Query("SELECT StationID, Name, Description, Latitude, Longitude FROM Station")
+	rows, err := db.BackingDB.Query(selectStationQuery)
+	if err != nil {
+		return nil, Interfaces.BackendError(err)
+	}
+	defer rows.Close()
 
 	for rows.Next() {
-		var stn = *new(Interfaces.Station)
+		stn, err := scanStation(rows)
+		if err != nil {
+			return nil, Interfaces.BackendError(err)
+		}
 
-		err = rows.Scan(&stn.StationID, &stn.Name, &stn.Description, &stn.Latitude, &stn.Longitude)
+		stns = append(stns, *stn)
+	}
 
-		stns = append(stns, stn)
+	return stns, Interfaces.BackendError(rows.Err())
+}
+
+// GetStationByDeviceKey retrieves the station whose DeviceKey is 'deviceKey'
+func (db *DataBase) GetStationByDeviceKey(deviceKey string) (*Interfaces.Station, error) {
+	stn, err := scanStation(db.BackingDB.QueryRow(selectStationQuery+" WHERE DeviceKey = ?", deviceKey))
+	if err != nil {
+		return nil, scanError(err, "station with device key", deviceKey)
 	}
 
+	return stn, nil
+}
+
+// AuthenticateStation returns the station named 'stationName' if 'password' matches its upload password, otherwise Interfaces.ErrUnauthorized is returned
+func (db *DataBase) AuthenticateStation(stationName string, password string) (*Interfaces.Station, error) {
+	var passwordHash sql.NullString
+	err := db.BackingDB.QueryRow("SELECT UploadPasswordHash FROM Station WHERE Name = ?", stationName).Scan(&passwordHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: unknown station '%v'", Interfaces.ErrUnauthorized, stationName)
+	}
 	if err != nil {
-		return nil
+		return nil, Interfaces.BackendError(err)
 	}
 
-	return stns
+	if !passwordHash.Valid || !Auth.VerifySecret(password, passwordHash.String) {
+		return nil, fmt.Errorf("%w: the password for station '%v' is not correct", Interfaces.ErrUnauthorized, stationName)
+	}
+
+	// passwords saved before they were hashed with bcrypt are hashed again now that the password is known
+	if Auth.NeedsRehash(passwordHash.String) {
+		if hashed, err := Auth.HashSecret(password); err == nil {
+			if _, err = db.BackingDB.Exec("UPDATE Station SET UploadPasswordHash = ? WHERE Name = ?", hashed, stationName); err != nil {
+				fmt.Println("Unable to update the password hash of station ", stationName, ": ", err)
+			}
+		}
+	}
+	return db.GetStationByName(stationName)
 }
 
 // GetDataStream returns a datastream from the database based on the 'streamID'
-func (db *DataBase) GetDataStream(streamID string) *Interfaces.DataStream {
+func (db *DataBase) GetDataStream(streamID string) (*Interfaces.DataStream, error) {
 	var dataStream Interfaces.DataStream
 	row := db.BackingDB.QueryRow("SELECT StationID, StreamID, ObservedPropertyID, SensorID, UnitTypeID FROM DataStream WHERE StreamID = ?", streamID)
 	err := row.Scan(&dataStream.StationID, &dataStream.StreamID, &dataStream.ObservedPropertyID, &dataStream.SensorID, &dataStream.UnitTypeID)
 
 	if err != nil {
-		return nil
+		return nil, scanError(err, "data stream", streamID)
 	}
 
-	return &dataStream
+	return &dataStream, nil
 }
 
 // GetDataStream returns a datastream from the database based on the 'sensorName'
-func (db *DataBase) GetDataStreamBySensorName(sensorName string, stationIDNum int64) *Interfaces.DataStream {
+func (db *DataBase) GetDataStreamBySensorName(sensorName string, stationIDNum int64) (*Interfaces.DataStream, error) {
 	var dataStream Interfaces.DataStream
 	row := db.BackingDB.QueryRow("SELECT StationID, StreamID, ObservedPropertyID, DataStream.SensorID, UnitTypeID FROM DataStream INNER JOIN Sensor ON DataStream.SensorID = Sensor.SensorID WHERE Sensor.Name = ? AND DataStream.StationID = ?", sensorName, stationIDNum)
 	err := row.Scan(&dataStream.StationID, &dataStream.StreamID, &dataStream.ObservedPropertyID, &dataStream.SensorID, &dataStream.UnitTypeID)
 
 	if err != nil {
-		fmt.Println("DataBase: GetDataStreamBySensorName: ", err)
-		return nil
+		return nil, scanError(err, "data stream for sensor", sensorName)
 	}
 
-	return &dataStream
+	return &dataStream, nil
 }
 
-func (db *DataBase) GetDataStreams() *[]Interfaces.DataStream {
+func (db *DataBase) GetDataStreams() (*[]Interfaces.DataStream, error) {
 	var streams []Interfaces.DataStream
 
 	rows, err := db.BackingDB.Query("SELECT StationID, StreamID, ObservedPropertyID, SensorID, UnitTypeID FROM DataStream")
-
 	if err != nil {
-		fmt.Println(err)
-		return nil
+		return nil, Interfaces.BackendError(err)
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var dataStream = *new(Interfaces.DataStream)
-		err = rows.Scan(&dataStream.StationID, &dataStream.StreamID, &dataStream.ObservedPropertyID, &dataStream.SensorID, &dataStream.UnitTypeID)
+		if err = rows.Scan(&dataStream.StationID, &dataStream.StreamID, &dataStream.ObservedPropertyID, &dataStream.SensorID, &dataStream.UnitTypeID); err != nil {
+			return nil, Interfaces.BackendError(err)
+		}
 		streams = append(streams, dataStream)
 	}
 
-	return &streams
+	return &streams, Interfaces.BackendError(rows.Err())
 }
 
-func (db *DataBase) GetUnitType(unitTypeID string) *Interfaces.UnitType {
+func (db *DataBase) GetUnitType(unitTypeID string) (*Interfaces.UnitType, error) {
 	var unittype = Interfaces.UnitType{}
 
 	row := db.BackingDB.QueryRow("SELECT UnitTypeID, Name, UnitOfMeasure, Description FROM UnitType WHERE UnitTypeID = ?", unitTypeID)
 	err := row.Scan(&unittype.UnitTypeID, &unittype.Name, &unittype.UnitOfMeasure, &unittype.Description)
 	if err != nil {
-		return nil
+		return nil, scanError(err, "unit type", unitTypeID)
 	}
 
-	return &unittype
+	return &unittype, nil
 
 }
 
-func (db *DataBase) GetUnitTypes() *[]Interfaces.UnitType {
+func (db *DataBase) GetUnitTypes() (*[]Interfaces.UnitType, error) {
 	var stns []Interfaces.UnitType
 
 	rows, err := db.BackingDB.Query("SELECT UnitTypeID, Name, UnitOfMeasure, Description FROM UnitType")
-
 	if err != nil {
-		return nil
+		return nil, Interfaces.BackendError(err)
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var unittype = *new(Interfaces.UnitType)
 
-		err = rows.Scan(&unittype.UnitTypeID, &unittype.Name, &unittype.UnitOfMeasure, &unittype.Description)
+		if err = rows.Scan(&unittype.UnitTypeID, &unittype.Name, &unittype.UnitOfMeasure, &unittype.Description); err != nil {
+			return nil, Interfaces.BackendError(err)
+		}
 
 		stns = append(stns, unittype)
 	}
 
-	return &stns
+	return &stns, Interfaces.BackendError(rows.Err())
 }
 
-func (db *DataBase) GetSensor(sensorID string) *Interfaces.Sensor {
+func (db *DataBase) GetSensor(sensorID string) (*Interfaces.Sensor, error) {
 	var sensor = Interfaces.Sensor{}
 
 	row := db.BackingDB.QueryRow("SELECT SensorID, Name, Description FROM Sensor WHERE SensorID = ?", sensorID)
 	err := row.Scan(&sensor.SensorID, &sensor.Name, &sensor.Description)
 	if err != nil {
-		fmt.Println(err)
-		return nil
+		return nil, scanError(err, "sensor", sensorID)
 	}
-	return &sensor
+	return &sensor, nil
 }
 
-func (db *DataBase) GetSensors() *[]Interfaces.Sensor {
+func (db *DataBase) GetSensors() (*[]Interfaces.Sensor, error) {
 	var sensors []Interfaces.Sensor
 
 	rows, err := db.BackingDB.Query("SELECT SensorID, Name, Description FROM Sensor")
-
 	if err != nil {
-		fmt.Println(err)
-		return nil
+		return nil, Interfaces.BackendError(err)
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var sensor = *new(Interfaces.Sensor)
-		err = rows.Scan(&sensor.SensorID, &sensor.Name, &sensor.Description)
+		if err = rows.Scan(&sensor.SensorID, &sensor.Name, &sensor.Description); err != nil {
+			return nil, Interfaces.BackendError(err)
+		}
 		sensors = append(sensors, sensor)
 	}
 
-	return &sensors
+	return &sensors, Interfaces.BackendError(rows.Err())
 }
 
 // GetObservations returns the obseration with 'ObservationID'
-func (db *DataBase) GetObservation(observationID string) *Interfaces.Observation {
-	var selectQuery = "SELECT ObservationID, DataStreamID, TimeStamp, Value FROM Observation WHERE ObservationID = ?"
-
-	row := db.BackingDB.QueryRow(selectQuery, observationID)
-
-	var obser = Interfaces.Observation{}
+func (db *DataBase) GetObservation(observationID string) (*Interfaces.Observation, error) {
+	var selectQuery = selectObservationQuery + " WHERE ObservationID = ?"
 
-	err := row.Scan(&obser.ObservationID, &obser.DataStreamID, &obser.TimeStamp, &obser.Value)
+	obser, err := scanObservation(db.BackingDB.QueryRow(selectQuery, observationID))
 
 	if err != nil {
-		fmt.Println(err)
-		return nil
+		return nil, scanError(err, "observation", observationID)
 	}
-	return &obser
+	return obser, nil
 }
 
-func (db *DataBase) GetObservations(parameters Interfaces.ObservationParameters) *[]Interfaces.Observation {
-	var observations []Interfaces.Observation
+// GetObservations returns the observations matching the 'parameters', ordered by time stamp
+func (db *DataBase) GetObservations(parameters Interfaces.ObservationParameters) (*[]Interfaces.Observation, error) {
+	if err := parameters.Validate(); err != nil {
+		return nil, err
+	}
 
-	rows, err := db.BackingDB.Query("SELECT ObservationID, DataStreamID, TimeStamp, Value FROM Observation INNER JOIN DataStream ON DataStream.StreamID = Observation.DataStreamID WHERE DataStream.SensorID = ?", parameters.SensorID)
+	var observations []Interfaces.Observation
 
+	selectQuery, args := buildObservationsQuery(parameters)
+	rows, err := db.BackingDB.Query(selectQuery, args...)
 	if err != nil {
-		return nil
+		return nil, Interfaces.BackendError(err)
 	}
+	defer rows.Close()
 
 	for rows.Next() {
-		var observation = *new(Interfaces.Observation)
-		err = rows.Scan(&observation.ObservationID, &observation.DataStreamID, &observation.TimeStamp, &observation.Value)
-		observations = append(observations, observation)
+		observation, err := scanObservation(rows)
+		if err != nil {
+			return nil, Interfaces.BackendError(err)
+		}
+		observations = append(observations, *observation)
 	}
 
-	return &observations
+	return &observations, Interfaces.BackendError(rows.Err())
 }
 
-func (db *DataBase) GetObservedProperty(propertyID string) *Interfaces.ObservedProperty {
+// buildObservationsQuery creates the SQL query, and its arguments, for selecting the observations that match the 'parameters'
+func buildObservationsQuery(parameters Interfaces.ObservationParameters) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if parameters.SensorID != 0 {
+		conditions = append(conditions, "DataStream.SensorID = ?")
+		args = append(args, parameters.SensorID)
+	}
+	if parameters.StationID != 0 {
+		conditions = append(conditions, "DataStream.StationID = ?")
+		args = append(args, parameters.StationID)
+	}
+	if parameters.DataStreamID != 0 {
+		conditions = append(conditions, "Observation.DataStreamID = ?")
+		args = append(args, parameters.DataStreamID)
+	}
+	if parameters.NumericOnly {
+		conditions = append(conditions, "Observation.Value IS NOT NULL")
+	}
+	if !parameters.StartTime.IsZero() {
+		conditions = append(conditions, "Observation.TimeStamp >= ?")
+		args = append(args, parameters.StartTime.UTC())
+	}
+	if !parameters.EndTime.IsZero() {
+		conditions = append(conditions, "Observation.TimeStamp <= ?")
+		args = append(args, parameters.EndTime.UTC())
+	}
+
+	// the sort order decides which side of the cursor the next page is on
+	order, comparison := "ASC", ">"
+	if parameters.Descending {
+		order, comparison = "DESC", "<"
+	}
+	if parameters.Cursor != "" {
+		// the parameters have already been validated so the cursor will parse
+		cursorTime, cursorID, _ := Interfaces.ParseObservationCursor(parameters.Cursor)
+		conditions = append(conditions, "(Observation.TimeStamp "+comparison+" ? OR (Observation.TimeStamp = ? AND Observation.ObservationID "+comparison+" ?))")
+		args = append(args, cursorTime, cursorTime, cursorID)
+	}
+
+	selectQuery := selectObservationQuery + " INNER JOIN DataStream ON DataStream.StreamID = Observation.DataStreamID"
+	if len(conditions) > 0 {
+		selectQuery += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	selectQuery += " ORDER BY Observation.TimeStamp " + order + ", Observation.ObservationID " + order
+
+	if parameters.Limit > 0 {
+		selectQuery += " LIMIT ?"
+		args = append(args, parameters.Limit)
+	}
+	return selectQuery, args
+}
+
+func (db *DataBase) GetObservedProperty(propertyID string) (*Interfaces.ObservedProperty, error) {
 	var property = Interfaces.ObservedProperty{}
 
-	row := db.BackingDB.QueryRow("SELECT PropertyID, Name, Description FROM ObserverdProperty WHERE PropertyID = ?", propertyID)
+	row := db.BackingDB.QueryRow("SELECT PropertyID, Name, Description FROM ObservedProperty WHERE PropertyID = ?", propertyID)
 	err := row.Scan(&property.PropertyID, &property.Name, &property.Description)
 	if err != nil {
-		return nil
+		return nil, scanError(err, "observed property", propertyID)
 	}
-	return &property
+	return &property, nil
 }
 
-func (db *DataBase) GetObservedProperties() *[]Interfaces.ObservedProperty {
+func (db *DataBase) GetObservedProperties() (*[]Interfaces.ObservedProperty, error) {
 	var properties []Interfaces.ObservedProperty
 
-	rows, err := db.BackingDB.Query("SELECT PropertyID, Name, Description FROM ObserverdProperty")
-
+	rows, err := db.BackingDB.Query("SELECT PropertyID, Name, Description FROM ObservedProperty")
 	if err != nil {
-		return nil
+		return nil, Interfaces.BackendError(err)
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var property = *new(Interfaces.ObservedProperty)
-		err = rows.Scan(&property.PropertyID, &property.Name, &property.Description)
+		if err = rows.Scan(&property.PropertyID, &property.Name, &property.Description); err != nil {
+			return nil, Interfaces.BackendError(err)
+		}
 		properties = append(properties, property)
 	}
 
-	return &properties
+	return &properties, Interfaces.BackendError(rows.Err())
+}
+
+// DeleteStation removes a station from the database. If cascade is true the station's data streams and their observations are deleted with it,
+// otherwise Interfaces.ErrConflict is returned when the station still has data streams.
+func (db *DataBase) DeleteStation(stationID string, cascade bool) error {
+	tx, err := db.BackingDB.Begin()
+	if err != nil {
+		return Interfaces.BackendError(err)
+	}
+
+	if cascade {
+		_, err = tx.Exec("DELETE FROM Observation WHERE DataStreamID IN (SELECT StreamID FROM DataStream WHERE StationID = ?)", stationID)
+		if err == nil {
+			_, err = tx.Exec("DELETE FROM DataStream WHERE StationID = ?", stationID)
+		}
+	} else {
+		err = checkNotReferenced(tx, "SELECT COUNT(*) FROM DataStream WHERE StationID = ?", stationID)
+	}
+
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM StationLogging WHERE StationID = ?", stationID)
+	}
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM APIToken WHERE StationID = ?", stationID)
+	}
+	if err == nil {
+		err = deleteRow(tx, "DELETE FROM Station WHERE StationID = ?", stationID)
+	}
+	return finishTransaction(tx, err)
+}
+
+// DeleteDataStream removes a data stream. If cascade is true the stream's observations are deleted with it,
+// otherwise Interfaces.ErrConflict is returned when the stream has observations.
+func (db *DataBase) DeleteDataStream(streamID string, cascade bool) error {
+	tx, err := db.BackingDB.Begin()
+	if err != nil {
+		return Interfaces.BackendError(err)
+	}
+
+	if cascade {
+		_, err = tx.Exec("DELETE FROM Observation WHERE DataStreamID = ?", streamID)
+	} else {
+		err = checkNotReferenced(tx, "SELECT COUNT(*) FROM Observation WHERE DataStreamID = ?", streamID)
+	}
+
+	if err == nil {
+		err = deleteRow(tx, "DELETE FROM DataStream WHERE StreamID = ?", streamID)
+	}
+	return finishTransaction(tx, err)
+}
+
+// DeleteUnitType removes a UnitType; Interfaces.ErrConflict is returned if a data stream still uses it
+func (db *DataBase) DeleteUnitType(unitTypeID string) error {
+	return db.deleteUnreferenced("UnitType", "UnitTypeID", "UnitTypeID", unitTypeID)
+}
+
+// DeleteSensor removes a Sensor; Interfaces.ErrConflict is returned if a data stream still uses it
+func (db *DataBase) DeleteSensor(sensorID string) error {
+	return db.deleteUnreferenced("Sensor", "SensorID", "SensorID", sensorID)
+}
+
+// DeleteObservedProperty removes an ObservedProperty; Interfaces.ErrConflict is returned if a data stream still uses it
+func (db *DataBase) DeleteObservedProperty(propertyID string) error {
+	return db.deleteUnreferenced("ObservedProperty", "PropertyID", "ObservedPropertyID", propertyID)
+}
+
+// DeleteObservation removes a single observation
+func (db *DataBase) DeleteObservation(observationID string) error {
+	tx, err := db.BackingDB.Begin()
+	if err != nil {
+		return Interfaces.BackendError(err)
+	}
+	return finishTransaction(tx, deleteRow(tx, "DELETE FROM Observation WHERE ObservationID = ?", observationID))
+}
+
+// deleteUnreferenced deletes the row with 'id' from 'table' as long as no data stream references it through the 'streamColumn' column
+func (db *DataBase) deleteUnreferenced(table string, idColumn string, streamColumn string, id string) error {
+	tx, err := db.BackingDB.Begin()
+	if err != nil {
+		return Interfaces.BackendError(err)
+	}
+
+	err = checkNotReferenced(tx, "SELECT COUNT(*) FROM DataStream WHERE "+streamColumn+" = ?", id)
+	if err == nil {
+		err = deleteRow(tx, "DELETE FROM "+table+" WHERE "+idColumn+" = ?", id)
+	}
+	return finishTransaction(tx, err)
+}
+
+// checkNotReferenced runs the 'countQuery' and returns Interfaces.ErrConflict if it counts any rows
+func checkNotReferenced(tx *sql.Tx, countQuery string, args ...interface{}) error {
+	var count int
+	if err := tx.QueryRow(countQuery, args...).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: still referenced by %v other item(s)", Interfaces.ErrConflict, count)
+	}
+	return nil
+}
+
+// deleteRow runs the 'deleteQuery' and returns Interfaces.ErrNotFound if nothing was deleted
+func deleteRow(tx *sql.Tx, deleteQuery string, args ...interface{}) error {
+	res, err := tx.Exec(deleteQuery, args...)
+	if err != nil {
+		return err
+	}
+	if count, _ := res.RowsAffected(); count == 0 {
+		return fmt.Errorf("%w: nothing was deleted", Interfaces.ErrNotFound)
+	}
+	return nil
+}
+
+// finishTransaction commits the transaction if 'err' is nil, otherwise the transaction is rolled back and 'err' is returned
+func finishTransaction(tx *sql.Tx, err error) error {
+	if err != nil {
+		tx.Rollback()
+		return Interfaces.BackendError(err)
+	}
+	return Interfaces.BackendError(tx.Commit())
+}
+
+// EnsureDataStream returns the station's data stream for the sensor 'sensorName'. The data stream, sensor, observed property and unit type
+// are created if they do not exist yet, and a data stream missing its observed property or unit type has them filled in.
+func (db *DataBase) EnsureDataStream(stationID int, sensorName string, sensorDescription string, propertyName string, unitOfMeasure string) (*Interfaces.DataStream, error) {
+	propertyID, err := db.ensureObservedProperty(propertyName)
+	if err != nil {
+		return nil, err
+	}
+	unitTypeID, err := db.ensureUnitType(unitOfMeasure)
+	if err != nil {
+		return nil, err
+	}
+
+	dataStream, err := db.GetDataStreamBySensorName(sensorName, int64(stationID))
+	if errors.Is(err, Interfaces.ErrNotFound) {
+		sensor := Interfaces.Sensor{Name: sensorName, Description: sensorDescription}
+		if _, err = db.AddOrUpdateSensor(&sensor); err != nil {
+			return nil, err
+		}
+		dataStream = &Interfaces.DataStream{
+			StationID:          stationID,
+			SensorID:           sensor.SensorID,
+			ObservedPropertyID: propertyID,
+			UnitTypeID:         unitTypeID}
+		_, err = db.AddDataStream(dataStream)
+		return dataStream, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// fill in the details of data streams that were created before they were known
+	if (dataStream.ObservedPropertyID == 0 && propertyID != 0) || (dataStream.UnitTypeID == 0 && unitTypeID != 0) {
+		if dataStream.ObservedPropertyID == 0 {
+			dataStream.ObservedPropertyID = propertyID
+		}
+		if dataStream.UnitTypeID == 0 {
+			dataStream.UnitTypeID = unitTypeID
+		}
+		err = db.UpdateDataStream(dataStream)
+	}
+	return dataStream, err
+}
+
+// ensureObservedProperty returns the ID of the observed property called 'name', creating it if needed. An empty name returns 0.
+func (db *DataBase) ensureObservedProperty(name string) (int, error) {
+	if name == "" {
+		return 0, nil
+	}
+
+	var propertyID int
+	err := db.BackingDB.QueryRow("SELECT PropertyID FROM ObservedProperty WHERE Name = ?", name).Scan(&propertyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		property := Interfaces.ObservedProperty{Name: name}
+		err = db.AddOrUpdateObservedProperty(&property)
+		propertyID = property.PropertyID
+	}
+	return propertyID, Interfaces.BackendError(err)
+}
+
+// ensureUnitType returns the ID of the unit type with the unit of measure 'unitOfMeasure', creating it if needed. An empty unit returns 0.
+func (db *DataBase) ensureUnitType(unitOfMeasure string) (int, error) {
+	if unitOfMeasure == "" {
+		return 0, nil
+	}
+
+	var unitTypeID int
+	err := db.BackingDB.QueryRow("SELECT UnitTypeID FROM UnitType WHERE UnitOfMeasure = ?", unitOfMeasure).Scan(&unitTypeID)
+	if errors.Is(err, sql.ErrNoRows) {
+		unit := Interfaces.UnitType{Name: unitOfMeasure, UnitOfMeasure: unitOfMeasure}
+		err = db.AddOrUpdateUnitType(&unit)
+		unitTypeID = unit.UnitTypeID
+	}
+	return unitTypeID, Interfaces.BackendError(err)
+}
+
+// GetLoggingConfigs returns the logging configuration of every station that has one saved
+func (db *DataBase) GetLoggingConfigs() ([]Interfaces.LoggingConfig, error) {
+	rows, err := db.BackingDB.Query("SELECT l.StationID, s.Name, l.Enabled, l.Interval, l.IncludeSensors, l.ExcludeSensors FROM StationLogging l JOIN Station s ON s.StationID = l.StationID")
+	if err != nil {
+		return nil, Interfaces.BackendError(err)
+	}
+	defer rows.Close()
+
+	var configs []Interfaces.LoggingConfig
+	for rows.Next() {
+		var config Interfaces.LoggingConfig
+		var include, exclude string
+		if err = rows.Scan(&config.StationID, &config.StationName, &config.Enabled, &config.Interval, &include, &exclude); err != nil {
+			return nil, Interfaces.BackendError(err)
+		}
+		if err = json.Unmarshal([]byte(include), &config.IncludeSensors); err == nil {
+			err = json.Unmarshal([]byte(exclude), &config.ExcludeSensors)
+		}
+		if err != nil {
+			return nil, Interfaces.BackendError(err)
+		}
+		configs = append(configs, config)
+	}
+	return configs, Interfaces.BackendError(rows.Err())
+}
+
+// SetLoggingConfig saves a station's logging configuration, replacing the one it had
+func (db *DataBase) SetLoggingConfig(config *Interfaces.LoggingConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	stn, err := db.GetStation(strconv.Itoa(config.StationID))
+	if err != nil {
+		return err
+	}
+	config.StationName = stn.Name
+
+	include, err := json.Marshal(nonNilStrings(config.IncludeSensors))
+	if err != nil {
+		return Interfaces.BackendError(err)
+	}
+	exclude, err := json.Marshal(nonNilStrings(config.ExcludeSensors))
+	if err != nil {
+		return Interfaces.BackendError(err)
+	}
+
+	_, err = db.BackingDB.Exec("INSERT OR REPLACE INTO StationLogging (StationID, Enabled, Interval, IncludeSensors, ExcludeSensors) VALUES (?,?,?,?,?)", config.StationID, config.Enabled, config.Interval, string(include), string(exclude))
+	return Interfaces.BackendError(err)
+}
+
+// DeleteLoggingConfig removes a station's logging configuration so the defaults are used again
+func (db *DataBase) DeleteLoggingConfig(stationID string) error {
+	tx, err := db.BackingDB.Begin()
+	if err != nil {
+		return Interfaces.BackendError(err)
+	}
+	return finishTransaction(tx, deleteRow(tx, "DELETE FROM StationLogging WHERE StationID = ?", stationID))
+}
+
+// IssueAPIToken stores a new token and returns its key. Only a hash of the key is stored, so it can not be retrieved again.
+func (db *DataBase) IssueAPIToken(token *Interfaces.APIToken) (string, error) {
+	if err := token.Validate(); err != nil {
+		return "", err
+	}
+	var stationID sql.NullInt64
+	if token.StationName != "" {
+		stn, err := db.GetStationByName(token.StationName)
+		if err != nil {
+			return "", err
+		}
+		stationID = sql.NullInt64{Int64: int64(stn.StationID), Valid: true}
+	}
+
+	key, keyID, secret, err := Auth.GenerateKey()
+	if err != nil {
+		return "", Interfaces.BackendError(err)
+	}
+	keyHash, err := Auth.HashKey(secret)
+	if err != nil {
+		return "", Interfaces.BackendError(err)
+	}
+	scopes, err := json.Marshal(token.Scopes)
+	if err != nil {
+		return "", Interfaces.BackendError(err)
+	}
+
+	token.Created = time.Now().UTC()
+	token.LastUsed = nil
+	res, err := db.BackingDB.Exec("INSERT INTO APIToken (Name, KeyID, KeyHash, Scopes, StationID, Created) VALUES (?,?,?,?,?,?)", token.Name, keyID, keyHash, string(scopes), stationID, token.Created)
+	if err != nil {
+		return "", Interfaces.BackendError(err)
+	}
+	tokenID, err := res.LastInsertId()
+	token.TokenID = int(tokenID)
+	return key, Interfaces.BackendError(err)
+}
+
+// selectAPITokenQuery selects the columns read by scanAPIToken
+const selectAPITokenQuery = "SELECT t.TokenID, t.Name, t.Scopes, COALESCE(s.Name, ''), t.Created, t.LastUsed FROM APIToken t LEFT JOIN Station s ON s.StationID = t.StationID"
+
+// scanAPIToken reads a token selected with selectAPITokenQuery
+func scanAPIToken(row rowScanner) (*Interfaces.APIToken, error) {
+	var token Interfaces.APIToken
+	var scopes string
+	var lastUsed sql.NullTime
+	if err := row.Scan(&token.TokenID, &token.Name, &scopes, &token.StationName, &token.Created, &lastUsed); err != nil {
+		return nil, err
+	}
+	if lastUsed.Valid {
+		token.LastUsed = &lastUsed.Time
+	}
+	return &token, json.Unmarshal([]byte(scopes), &token.Scopes)
+}
+
+// GetAPITokens returns every token that has been issued and not revoked
+func (db *DataBase) GetAPITokens() ([]Interfaces.APIToken, error) {
+	rows, err := db.BackingDB.Query(selectAPITokenQuery + " ORDER BY t.TokenID")
+	if err != nil {
+		return nil, Interfaces.BackendError(err)
+	}
+	defer rows.Close()
+
+	tokens := []Interfaces.APIToken{}
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, Interfaces.BackendError(err)
+		}
+		tokens = append(tokens, *token)
+	}
+	return tokens, Interfaces.BackendError(rows.Err())
+}
+
+// RevokeAPIToken deletes a token so its key is no longer accepted
+func (db *DataBase) RevokeAPIToken(tokenID string) error {
+	tx, err := db.BackingDB.Begin()
+	if err != nil {
+		return Interfaces.BackendError(err)
+	}
+	return finishTransaction(tx, deleteRow(tx, "DELETE FROM APIToken WHERE TokenID = ?", tokenID))
+}
+
+// AuthenticateToken returns the token that 'key' belongs to, otherwise Interfaces.ErrUnauthorized is returned
+func (db *DataBase) AuthenticateToken(key string) (*Interfaces.APIToken, error) {
+	keyID, secret, ok := Auth.ParseKey(key)
+	if !ok {
+		return nil, fmt.Errorf("%w: the API key is not valid", Interfaces.ErrUnauthorized)
+	}
+
+	var keyHash string
+	err := db.BackingDB.QueryRow("SELECT KeyHash FROM APIToken WHERE KeyID = ?", keyID).Scan(&keyHash)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !Auth.VerifyKey(secret, keyHash)) {
+		return nil, fmt.Errorf("%w: the API key is not valid or has been revoked", Interfaces.ErrUnauthorized)
+	}
+	if err != nil {
+		return nil, Interfaces.BackendError(err)
+	}
+
+	token, err := scanAPIToken(db.BackingDB.QueryRow(selectAPITokenQuery+" WHERE t.KeyID = ?", keyID))
+	if err != nil {
+		return nil, scanError(err, "token", keyID)
+	}
+
+	// only record the time every minute so busy tokens do not write to the database on every request
+	now := time.Now().UTC()
+	if token.LastUsed == nil || now.Sub(*token.LastUsed) > time.Minute {
+		if _, err = db.BackingDB.Exec("UPDATE APIToken SET LastUsed = ? WHERE TokenID = ?", now, token.TokenID); err != nil {
+			fmt.Println("Failed to record when token ", token.TokenID, " was used: ", err)
+		}
+		token.LastUsed = &now
+	}
+	return token, nil
+}
+
+// nonNilStrings returns an empty list in place of nil so it is stored as '[]' rather than 'null'
+func nonNilStrings(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
 }
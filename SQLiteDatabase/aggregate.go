@@ -0,0 +1,104 @@
+package SQLiteDatabase
+
+import (
+	"strconv"
+
+	"github.com/Josiah-B/Cyclone/Interfaces"
+)
+
+// bucketAccumulator collects the values that fall into a single time bucket
+type bucketAccumulator struct {
+	bucket Interfaces.AggregateBucket
+	min    float64
+	max    float64
+	sum    float64
+}
+
+func (acc *bucketAccumulator) add(value float64) {
+	if acc.bucket.Count == 0 || value < acc.min {
+		acc.min = value
+	}
+	if acc.bucket.Count == 0 || value > acc.max {
+		acc.max = value
+	}
+	acc.sum += value
+	acc.bucket.Count++
+}
+
+// result returns the finished bucket with its value calculated using the aggregate 'function'
+func (acc *bucketAccumulator) result(function string) Interfaces.AggregateBucket {
+	switch function {
+	case Interfaces.AggregateMin:
+		acc.bucket.Value = acc.min
+	case Interfaces.AggregateMax:
+		acc.bucket.Value = acc.max
+	case Interfaces.AggregateSum:
+		acc.bucket.Value = acc.sum
+	case Interfaces.AggregateCount:
+		acc.bucket.Value = float64(acc.bucket.Count)
+	default:
+		acc.bucket.Value = acc.sum / float64(acc.bucket.Count)
+	}
+	return acc.bucket
+}
+
+// AggregateObservations groups a data stream's observations into time buckets and returns the aggregated value of each bucket.
+// Buckets are calculated in the station's time zone so that, for example, daily buckets start at the station's midnight.
+// Buckets that have no observations are left out.
+func (db *DataBase) AggregateObservations(parameters Interfaces.AggregationParameters) (*[]Interfaces.AggregateBucket, error) {
+	if err := parameters.Validate(); err != nil {
+		return nil, err
+	}
+
+	dataStream, err := db.GetDataStream(strconv.Itoa(parameters.DataStreamID))
+	if err != nil {
+		return nil, err
+	}
+	stn, err := db.GetStation(strconv.Itoa(dataStream.StationID))
+	if err != nil {
+		return nil, err
+	}
+	loc := stn.Location()
+
+	selectQuery, args := buildObservationsQuery(Interfaces.ObservationParameters{
+		DataStreamID: parameters.DataStreamID,
+		StartTime:    parameters.StartTime,
+		EndTime:      parameters.EndTime,
+		NumericOnly:  true})
+
+	rows, err := db.BackingDB.Query(selectQuery, args...)
+	if err != nil {
+		return nil, Interfaces.BackendError(err)
+	}
+	defer rows.Close()
+
+	buckets := []Interfaces.AggregateBucket{}
+	var current *bucketAccumulator
+
+	for rows.Next() {
+		observation, err := scanObservation(rows)
+		if err != nil {
+			return nil, Interfaces.BackendError(err)
+		}
+
+		// the rows are sorted by time so once an observation falls outside of the current bucket that bucket is finished
+		bucketStart := Interfaces.BucketStart(observation.TimeStamp, parameters.BucketWidth, loc)
+		if current == nil || !bucketStart.Equal(current.bucket.StartTime) {
+			if current != nil {
+				buckets = append(buckets, current.result(parameters.Function))
+			}
+			current = &bucketAccumulator{bucket: Interfaces.AggregateBucket{
+				StartTime: bucketStart,
+				EndTime:   Interfaces.NextBucketStart(bucketStart, parameters.BucketWidth)}}
+		}
+		current.add(*observation.Value)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Interfaces.BackendError(err)
+	}
+
+	if current != nil {
+		buckets = append(buckets, current.result(parameters.Function))
+	}
+	return &buckets, nil
+}
@@ -0,0 +1,104 @@
+package SQLiteDatabase
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Josiah-B/Cyclone/Interfaces"
+)
+
+// openAggregateDatabase creates a database holding a station in New York with a single data stream, and an observation at each of 'times'
+func openAggregateDatabase(t *testing.T, times []string) *DataBase {
+	db := &DataBase{Configuration: SqliteSettings{Path: filepath.Join(t.TempDir(), "test.db")}}
+	if err := db.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.AddOrUpdateStation(&Interfaces.Station{Name: "Backyard", TimeZone: "America/New_York"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.BackingDB.Exec("INSERT INTO DataStream (StationID, ObservedPropertyID, SensorID, UnitTypeID) VALUES (1, 1, 1, 1)"); err != nil {
+		t.Fatal(err)
+	}
+	for i, timeStamp := range times {
+		if _, err := db.BackingDB.Exec("INSERT INTO Observation (DataStreamID, TimeStamp, Value) VALUES (1, ?, ?)", utc(t, timeStamp), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func utc(t *testing.T, timeStamp string) time.Time {
+	parsed, err := time.Parse(time.RFC3339, timeStamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.UTC()
+}
+
+// wantBucket is a bucket expected from AggregateObservations, with its times in UTC
+type wantBucket struct {
+	start string
+	end   string
+	count int
+}
+
+func TestAggregateObservationsAcrossDST(t *testing.T) {
+	// New York moves from EST (-5) to EDT (-4) at 07:00Z on 2024-03-10, and back at 06:00Z on 2024-11-03
+	spring := []string{"2024-03-10T06:30:00Z", "2024-03-10T07:30:00Z", "2024-03-11T03:30:00Z", "2024-03-11T04:30:00Z"}
+	fall := []string{"2024-11-02T23:30:00Z", "2024-11-03T04:30:00Z", "2024-11-03T05:30:00Z", "2024-11-03T06:30:00Z",
+		"2024-11-03T07:30:00Z", "2024-11-04T04:30:00Z", "2024-11-04T05:30:00Z"}
+
+	tests := []struct {
+		name   string
+		times  []string
+		bucket string
+		want   []wantBucket
+	}{
+		{"spring days", spring, Interfaces.BucketDay, []wantBucket{
+			// 2024-03-10 is 23 hours long
+			{"2024-03-10T05:00:00Z", "2024-03-11T04:00:00Z", 3},
+			{"2024-03-11T04:00:00Z", "2024-03-12T04:00:00Z", 1}}},
+		{"spring hours", spring[:2], Interfaces.BucketHour, []wantBucket{
+			// 01:30 EST then 03:30 EDT, 02:00 is skipped
+			{"2024-03-10T06:00:00Z", "2024-03-10T07:00:00Z", 1},
+			{"2024-03-10T07:00:00Z", "2024-03-10T08:00:00Z", 1}}},
+		{"fall days", fall, Interfaces.BucketDay, []wantBucket{
+			{"2024-11-02T04:00:00Z", "2024-11-03T04:00:00Z", 1},
+			// 2024-11-03 is 25 hours long
+			{"2024-11-03T04:00:00Z", "2024-11-04T05:00:00Z", 5},
+			{"2024-11-04T05:00:00Z", "2024-11-05T05:00:00Z", 1}}},
+		{"fall hours", fall[1:5], Interfaces.BucketHour, []wantBucket{
+			// 00:30 EDT, 01:30 EDT, 01:30 EST and 02:30 EST; the repeated hour is a bucket of its own
+			{"2024-11-03T04:00:00Z", "2024-11-03T05:00:00Z", 1},
+			{"2024-11-03T05:00:00Z", "2024-11-03T06:00:00Z", 1},
+			{"2024-11-03T06:00:00Z", "2024-11-03T07:00:00Z", 1},
+			{"2024-11-03T07:00:00Z", "2024-11-03T08:00:00Z", 1}}},
+		{"fall month", fall, Interfaces.BucketMonth, []wantBucket{
+			{"2024-11-01T04:00:00Z", "2024-12-01T05:00:00Z", 7}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := openAggregateDatabase(t, test.times)
+			buckets, err := db.AggregateObservations(Interfaces.AggregationParameters{
+				DataStreamID: 1,
+				BucketWidth:  test.bucket,
+				Function:     Interfaces.AggregateCount})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(*buckets) != len(test.want) {
+				t.Fatalf("got %v buckets %+v, want %v", len(*buckets), *buckets, len(test.want))
+			}
+			for i, want := range test.want {
+				got := (*buckets)[i]
+				if !got.StartTime.Equal(utc(t, want.start)) || !got.EndTime.Equal(utc(t, want.end)) || got.Count != want.count {
+					t.Errorf("bucket %v: got %v - %v with %v observations, want %v - %v with %v",
+						i, got.StartTime.UTC(), got.EndTime.UTC(), got.Count, want.start, want.end, want.count)
+				}
+			}
+		})
+	}
+}
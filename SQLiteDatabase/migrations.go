@@ -0,0 +1,207 @@
+package SQLiteDatabase
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Josiah-B/Cyclone/Interfaces"
+)
+
+// Migration is a single step in the chain of database schema upgrades
+type Migration struct {
+	// Version is the schema version the database will be at once this migration has been applied
+	Version int
+	// Description is a short human readable summary of what the migration changes
+	Description string
+	// query holds the SQL statements that perform the migration
+	query string
+	// convert is optional and runs after the query, in the same transaction, for changes that can not be written in SQL alone
+	convert func(tx *sql.Tx) error
+}
+
+// migrations is the ordered list of every schema change; new migrations must be appended to the end with the next version number.
+// Never edit a migration that has already been released, add a new one instead.
+var migrations = []Migration{
+	Migration{
+		Version:     1,
+		Description: "Create the initial database tables",
+		query:       createDBQuery},
+	Migration{
+		Version:     2,
+		Description: "Rename the 'ObserverdProperty' table to 'ObservedProperty'",
+		query:       `ALTER TABLE 'ObserverdProperty' RENAME TO 'ObservedProperty';`},
+	Migration{
+		Version:     3,
+		Description: "Add indexes for looking up data streams and observations",
+		query: `CREATE INDEX IF NOT EXISTS 'IX_DataStream_StationID' ON 'DataStream' (StationID);
+CREATE INDEX IF NOT EXISTS 'IX_DataStream_SensorID' ON 'DataStream' (SensorID);
+CREATE INDEX IF NOT EXISTS 'IX_Observation_DataStreamID_TimeStamp' ON 'Observation' (DataStreamID, TimeStamp);`},
+	Migration{
+		Version:     4,
+		Description: "Add a time zone to stations",
+		query:       `ALTER TABLE 'Station' ADD COLUMN TimeZone TEXT NOT NULL DEFAULT '';`},
+	Migration{
+		Version:     5,
+		Description: "Store observation values as numbers, keeping readings that are not numbers as raw text",
+		query: `ALTER TABLE 'Observation' RENAME TO 'ObservationText';
+DROP INDEX IF EXISTS 'IX_Observation_DataStreamID_TimeStamp';
+CREATE TABLE 'Observation'
+(
+	ObservationID INTEGER PRIMARY KEY AUTOINCREMENT,
+	DataStreamID INTEGER REFERENCES DataStream(StreamID),
+	TimeStamp DATETIME NOT NULL,
+	Value REAL,
+	RawValue TEXT
+);
+CREATE INDEX 'IX_Observation_DataStreamID_TimeStamp' ON 'Observation' (DataStreamID, TimeStamp);`,
+		convert: convertObservationValues},
+	Migration{
+		Version:     6,
+		Description: "Add an elevation to stations",
+		query:       `ALTER TABLE 'Station' ADD COLUMN Elevation REAL;`},
+	Migration{
+		Version:     7,
+		Description: "Add a hashed upload password to stations",
+		query:       `ALTER TABLE 'Station' ADD COLUMN UploadPasswordHash TEXT;`},
+	Migration{
+		Version:     8,
+		Description: "Add a device key to stations for uploads identified by PASSKEY or MAC address",
+		query: `ALTER TABLE 'Station' ADD COLUMN DeviceKey TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS 'IX_Station_DeviceKey' ON 'Station' (DeviceKey);`},
+	Migration{
+		Version:     9,
+		Description: "Add per station logging settings",
+		query: `CREATE TABLE 'StationLogging'
+(
+	StationID INTEGER PRIMARY KEY REFERENCES Station(StationID),
+	Enabled INTEGER NOT NULL DEFAULT 1,
+	Interval INTEGER NOT NULL DEFAULT 0,
+	IncludeSensors TEXT NOT NULL DEFAULT '[]',
+	ExcludeSensors TEXT NOT NULL DEFAULT '[]'
+);`},
+	Migration{
+		Version:     10,
+		Description: "Add API tokens, storing a hash of each token's key",
+		query: `CREATE TABLE 'APIToken'
+(
+	TokenID INTEGER PRIMARY KEY AUTOINCREMENT,
+	Name TEXT NOT NULL,
+	KeyID TEXT NOT NULL UNIQUE,
+	KeyHash TEXT NOT NULL,
+	Scopes TEXT NOT NULL DEFAULT '[]',
+	StationID INTEGER REFERENCES Station(StationID),
+	Created DATETIME NOT NULL,
+	LastUsed DATETIME
+);`},
+}
+
+// PendingMigrations returns the migrations that have not yet been applied to the database, in the order they will run
+func (db *DataBase) PendingMigrations() []Migration {
+	var pending []Migration
+	for _, m := range migrations {
+		if m.Version > db.version {
+			pending = append(pending, m)
+		}
+	}
+	return pending
+}
+
+// runMigration applies a single migration inside of a transaction and records the new schema version.
+// If any part of the migration fails the whole migration is rolled back.
+func (db *DataBase) runMigration(m Migration) error {
+	tx, err := db.BackingDB.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(m.query); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if m.convert != nil {
+		if err = m.convert(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err = setSchemaVersion(tx, m.Version); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// setSchemaVersion writes the schema version to the 'Settings' table
+func setSchemaVersion(tx *sql.Tx, version int) error {
+	res, err := tx.Exec("UPDATE Settings SET Version = ?", version)
+	if err != nil {
+		return err
+	}
+
+	// the first migration creates the settings row, but guard against an empty table anyway
+	if count, _ := res.RowsAffected(); count == 0 {
+		_, err = tx.Exec("INSERT INTO Settings (Version) VALUES (?)", version)
+	}
+	return err
+}
+
+// convertObservationValues copies the observations from the old text based table into the new table, converting the values that parse as numbers
+func convertObservationValues(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT ObservationID, DataStreamID, TimeStamp, Value FROM ObservationText")
+	if err != nil {
+		return err
+	}
+
+	var converted, kept int
+	for rows.Next() {
+		var observationID, dataStreamID int
+		var timeStamp time.Time
+		var text string
+		if err = rows.Scan(&observationID, &dataStreamID, &timeStamp, &text); err != nil {
+			break
+		}
+
+		var value interface{}
+		var rawValue interface{}
+		if reading, parseErr := Interfaces.ParseSensorReading(text); parseErr == nil && reading.IsNumeric() {
+			value = *reading.Value
+			converted++
+		} else {
+			rawValue = text
+			kept++
+		}
+
+		if _, err = tx.Exec("INSERT INTO Observation (ObservationID, DataStreamID, TimeStamp, Value, RawValue) VALUES (?,?,?,?,?)", observationID, dataStreamID, timeStamp.UTC(), value, rawValue); err != nil {
+			break
+		}
+	}
+	rows.Close()
+	if err == nil {
+		err = rows.Err()
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Converted %v observations to numbers, kept %v as raw text\n", converted, kept)
+	_, err = tx.Exec("DROP TABLE 'ObservationText'")
+	return err
+}
+
+// MigrationError is returned when a migration fails and has been rolled back
+type MigrationError struct {
+	Migration Migration
+	Err       error
+}
+
+func (e *MigrationError) Error() string {
+	return fmt.Sprintf("migration to version %v (%v) failed and was rolled back: %v", e.Migration.Version, e.Migration.Description, e.Err)
+}
+
+func (e *MigrationError) Unwrap() error {
+	return e.Err
+}
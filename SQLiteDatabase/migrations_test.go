@@ -0,0 +1,186 @@
+package SQLiteDatabase
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// openTestDatabase opens an empty database in a temporary folder without upgrading it
+func openTestDatabase(t *testing.T) *DataBase {
+	db := &DataBase{Configuration: SqliteSettings{Path: filepath.Join(t.TempDir(), "test.db"), SkipUpgrade: true}}
+	if err := db.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// storedVersion reads the schema version from the 'Settings' table
+func storedVersion(t *testing.T, db *DataBase) int {
+	var version int
+	if err := db.BackingDB.QueryRow("SELECT Version FROM Settings").Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	return version
+}
+
+// tableExists returns true if the database has a table named 'name'
+func tableExists(t *testing.T, db *DataBase, name string) bool {
+	var count int
+	if err := db.BackingDB.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count > 0
+}
+
+func TestOpenCreatesLatestVersion(t *testing.T) {
+	db := &DataBase{Configuration: SqliteSettings{Path: filepath.Join(t.TempDir(), "test.db")}}
+	if err := db.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	latest := migrations[len(migrations)-1].Version
+	if db.Version() != latest || storedVersion(t, db) != latest {
+		t.Errorf("got version %v (stored %v), want %v", db.Version(), storedVersion(t, db), latest)
+	}
+	if pending := db.PendingMigrations(); len(pending) != 0 {
+		t.Errorf("got %v pending migrations, want none", len(pending))
+	}
+}
+
+func TestUpgradeFromVersion1(t *testing.T) {
+	db := openTestDatabase(t)
+	if db.Version() != -1 {
+		t.Fatalf("got version %v for an empty database, want -1", db.Version())
+	}
+
+	// create a version 1 database holding observations stored as text
+	if err := db.runMigration(migrations[0]); err != nil {
+		t.Fatal(err)
+	}
+	db.version = 1
+	timeStamp := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	setup := []string{
+		"INSERT INTO Station (Name, Description, Latitude, Longitude) VALUES ('Backyard', '', '', '')",
+		"INSERT INTO DataStream (StationID, ObservedPropertyID, SensorID, UnitTypeID) VALUES (1, 1, 1, 1)"}
+	for _, query := range setup {
+		if _, err := db.BackingDB.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, value := range []string{"12.5", "-3", "NNW"} {
+		if _, err := db.BackingDB.Exec("INSERT INTO Observation (DataStreamID, TimeStamp, Value) VALUES (1, ?, ?)", timeStamp, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a dry run lists every later migration, in order, without changing anything
+	pending, err := db.Upgrade(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != len(migrations)-1 {
+		t.Fatalf("got %v pending migrations, want %v", len(pending), len(migrations)-1)
+	}
+	for i, m := range pending {
+		if m.Version != i+2 {
+			t.Errorf("pending migration %v is version %v, want %v", i, m.Version, i+2)
+		}
+	}
+	if storedVersion(t, db) != 1 || !tableExists(t, db, "ObserverdProperty") {
+		t.Fatalf("the dry run changed the database")
+	}
+
+	if _, err = db.Upgrade(false); err != nil {
+		t.Fatal(err)
+	}
+	latest := migrations[len(migrations)-1].Version
+	if db.Version() != latest || storedVersion(t, db) != latest {
+		t.Errorf("got version %v (stored %v), want %v", db.Version(), storedVersion(t, db), latest)
+	}
+	for _, table := range []string{"ObservedProperty", "StationLogging", "APIToken"} {
+		if !tableExists(t, db, table) {
+			t.Errorf("the table '%v' was not created", table)
+		}
+	}
+	for _, table := range []string{"ObserverdProperty", "ObservationText"} {
+		if tableExists(t, db, table) {
+			t.Errorf("the table '%v' was not removed", table)
+		}
+	}
+
+	// numbers are converted, anything else is kept as raw text
+	rows, err := db.BackingDB.Query("SELECT Value, RawValue FROM Observation ORDER BY ObservationID")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var value sql.NullFloat64
+		var rawValue sql.NullString
+		if err = rows.Scan(&value, &rawValue); err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case value.Valid && !rawValue.Valid:
+			got = append(got, strconv.FormatFloat(value.Float64, 'g', -1, 64))
+		case rawValue.Valid && !value.Valid:
+			got = append(got, "raw "+rawValue.String)
+		default:
+			got = append(got, "invalid")
+		}
+	}
+	want := []string{"12.5", "-3", "raw NNW"}
+	if len(got) != len(want) {
+		t.Fatalf("got observations %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got observation %v, want %v", got[i], want[i])
+		}
+	}
+}
+
+func TestUpgradeRollsBackFailedMigration(t *testing.T) {
+	tests := map[string]Migration{
+		"failing query": {
+			Version:     3,
+			Description: "Create a table then fail",
+			query:       "CREATE TABLE 'Partial' (ID INTEGER); INSERT INTO 'Missing' VALUES (1);"},
+		"failing conversion": {
+			Version:     3,
+			Description: "Create a table then fail to convert",
+			query:       "CREATE TABLE 'Partial' (ID INTEGER);",
+			convert:     func(tx *sql.Tx) error { return errors.New("conversion failed") }},
+	}
+	for name, broken := range tests {
+		t.Run(name, func(t *testing.T) {
+			saved := migrations
+			migrations = []Migration{saved[0], saved[1], broken, saved[3]}
+			defer func() { migrations = saved }()
+
+			db := openTestDatabase(t)
+			pending, err := db.Upgrade(false)
+
+			var migrationErr *MigrationError
+			if !errors.As(err, &migrationErr) || migrationErr.Migration.Version != 3 {
+				t.Fatalf("got error %v, want a *MigrationError for version 3", err)
+			}
+			if len(pending) != 2 || pending[0].Version != 3 {
+				t.Errorf("got %v migrations left, want versions 3 and 4", len(pending))
+			}
+			if db.Version() != 2 || storedVersion(t, db) != 2 {
+				t.Errorf("got version %v (stored %v), want 2", db.Version(), storedVersion(t, db))
+			}
+			if tableExists(t, db, "Partial") {
+				t.Errorf("the failed migration was not rolled back")
+			}
+		})
+	}
+}
@@ -0,0 +1,335 @@
+/*
+	Settings loads the program's configuration. Every setting has a default, which can be overridden by the config file,
+	then by an environment variable, then by a command line flag.
+*/
+package Settings
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/Josiah-B/Cyclone/Interfaces"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultConfigFilePath is read when no config file is given; unlike a config file that is given, it does not have to exist
+const DefaultConfigFilePath = "./config/cyclone.json"
+
+// envPrefix starts the name of every environment variable, e.g. the flag "http.port" is read from CYCLONE_HTTP_PORT
+const envPrefix = "CYCLONE_"
+
+// Settings holds the configuration of every part of the program
+type Settings struct {
+	// ConfigFilePath is the JSON, YAML or TOML file the settings were read from
+	ConfigFilePath string
+	HTTP           HTTPSettings
+	Storage        StorageSettings
+	Logger         LoggerSettings
+	ProcessManager ProcessManagerSettings
+	MQTT           MQTTSettings
+	Auth           AuthSettings
+
+	// Command holds the arguments after the flags, which run a command instead of the program, e.g. "token issue"
+	Command []string `json:"-"`
+}
+
+// HTTPSettings are the ports the web servers listen on
+type HTTPSettings struct {
+	// Port serves the weather data API and the station uploads
+	Port Port
+	// ConfigAPIPort serves the configuration API
+	ConfigAPIPort Port
+	// ShutdownTimeout is how long requests in progress are given to finish when the program shuts down
+	ShutdownTimeout Duration
+}
+
+// StorageSettings configure the database and the current readings held in memory
+type StorageSettings struct {
+	DatabasePath string
+	// StaleAfter is how long a sensor can go without an update before its current reading is marked stale; 0 never marks readings stale
+	StaleAfter Duration
+}
+
+// LoggerSettings are the defaults for logging the current readings to the database; stations can override some of them through the ConfigAPI
+type LoggerSettings struct {
+	// Interval is the default logging interval, in minutes
+	Interval         int
+	LogDerivedValues bool
+	LogMinMax        bool
+	// Statistics sets the statistic logged for each ObservedProperty, see the Interfaces.Statistic constants
+	Statistics map[string]string `json:",omitempty"`
+}
+
+// ProcessManagerSettings configure the station processes
+type ProcessManagerSettings struct {
+	ConfigFilePath string
+	// ShutdownGracePeriod is how long the processes are given to exit when the program shuts down before they are killed
+	ShutdownGracePeriod Duration
+}
+
+// MQTTSettings configure the MQTT bridge
+type MQTTSettings struct {
+	// ConfigFilePath is the bridge's config file; the bridge is disabled when the file does not exist
+	ConfigFilePath string
+}
+
+// AuthSettings configure the API tokens
+type AuthSettings struct {
+	// AnonymousRead lets requests without an API key read the weather data; changes always need a key
+	AnonymousRead bool
+}
+
+// Defaults returns the settings used when nothing overrides them
+func Defaults() Settings {
+	return Settings{
+		ConfigFilePath: DefaultConfigFilePath,
+		HTTP: HTTPSettings{
+			Port:            "8080",
+			ConfigAPIPort:   "8000",
+			ShutdownTimeout: Duration{10 * time.Second}},
+		Storage: StorageSettings{
+			DatabasePath: "./database.db",
+			StaleAfter:   Duration{10 * time.Minute}},
+		Logger: LoggerSettings{
+			Interval:         15,
+			LogDerivedValues: false,
+			LogMinMax:        false},
+		ProcessManager: ProcessManagerSettings{
+			ConfigFilePath:      "./config/process manager.json",
+			ShutdownGracePeriod: Duration{10 * time.Second}},
+		MQTT: MQTTSettings{
+			ConfigFilePath: "./config/mqtt.json"}}
+}
+
+// Load builds the settings from the defaults, the config file, the environment and the command line 'args', in that order of precedence.
+// The config file is set with the "config" flag or CYCLONE_CONFIG.
+func Load(args []string) (Settings, error) {
+	// the flags and environment are read once to find the config file, then again over the file so they take precedence over it
+	probe := Defaults()
+	if err := probe.override(args); err != nil {
+		return probe, err
+	}
+
+	settings := Defaults()
+	if err := settings.loadFile(probe.ConfigFilePath); err != nil {
+		return settings, err
+	}
+	if err := settings.override(args); err != nil {
+		return settings, err
+	}
+	return settings, settings.Validate()
+}
+
+// loadFile reads the config file at 'path' over the settings. The file's extension picks its format: .json (or none), .yaml, .yml or .toml.
+func (settings *Settings) loadFile(path string) error {
+	configFile, err := os.Open(path)
+	if os.IsNotExist(err) && path == DefaultConfigFilePath {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer configFile.Close()
+
+	data, err := ioutil.ReadAll(configFile)
+	if err != nil {
+		return err
+	}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json", "":
+	case ".yaml", ".yml":
+		data, err = toJSON(data, yaml.Unmarshal)
+	case ".toml":
+		data, err = toJSON(data, toml.Unmarshal)
+	default:
+		return Interfaces.ValidationError("the config file '%v' must be .json, .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return Interfaces.ValidationError("failed to read the config file '%v': %v", path, err)
+	}
+
+	// an unknown field is most likely a misspelled setting, which would otherwise be silently ignored
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(settings); err != nil {
+		return Interfaces.ValidationError("failed to read the config file '%v': %v", path, err)
+	}
+	settings.ConfigFilePath = path
+	return nil
+}
+
+// toJSON converts a YAML or TOML config file to JSON, so every format is read with the same setting names and checks
+func toJSON(data []byte, unmarshal func([]byte, interface{}) error) ([]byte, error) {
+	var document map[string]interface{}
+	if err := unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	return json.Marshal(document)
+}
+
+// override sets the settings given by environment variables, then those given by the command line flags in 'args'
+func (settings *Settings) override(args []string) error {
+	flags := settings.flagSet()
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(EnvironmentVariable(f.Name))
+		if ok && err == nil {
+			if setErr := flags.Set(f.Name, value); setErr != nil {
+				err = Interfaces.ValidationError("invalid value '%v' for %v: %v", value, EnvironmentVariable(f.Name), setErr)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = flags.Parse(args); err != nil && !errors.Is(err, flag.ErrHelp) {
+		err = Interfaces.ValidationError("%v", err)
+	}
+	settings.Command = flags.Args()
+	return err
+}
+
+// flagSet creates the command line flags, each one writing to its setting
+func (settings *Settings) flagSet() *flag.FlagSet {
+	flags := flag.NewFlagSet("cyclone", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage of cyclone: cyclone [flags] [token issue|list|revoke ... | migrate [-dry-run]]")
+		flags.VisitAll(func(f *flag.Flag) {
+			fmt.Fprintf(flags.Output(), "  -%v (%v)\n    \t%v (default %q)\n", f.Name, EnvironmentVariable(f.Name), f.Usage, f.DefValue)
+		})
+	}
+
+	flags.StringVar(&settings.ConfigFilePath, "config", settings.ConfigFilePath, "the JSON, YAML or TOML config file")
+	flags.Var(&settings.HTTP.Port, "http.port", "the port of the weather data API")
+	flags.Var(&settings.HTTP.ConfigAPIPort, "http.configapiport", "the port of the configuration API")
+	flags.Var(&settings.HTTP.ShutdownTimeout, "http.shutdowntimeout", "how long requests are given to finish on shutdown")
+	flags.StringVar(&settings.Storage.DatabasePath, "storage.databasepath", settings.Storage.DatabasePath, "the SQLite database file")
+	flags.Var(&settings.Storage.StaleAfter, "storage.staleafter", "how long before a sensor that has not been updated is marked stale; 0 never marks readings stale")
+	flags.IntVar(&settings.Logger.Interval, "logger.interval", settings.Logger.Interval, "the default logging interval, in minutes")
+	flags.BoolVar(&settings.Logger.LogDerivedValues, "logger.logderivedvalues", settings.Logger.LogDerivedValues, "log the derived readings, such as the dew point")
+	flags.BoolVar(&settings.Logger.LogMinMax, "logger.logminmax", settings.Logger.LogMinMax, "log the lowest and highest reading of each averaged sensor")
+	flags.StringVar(&settings.ProcessManager.ConfigFilePath, "processmanager.configfilepath", settings.ProcessManager.ConfigFilePath, "the process manager's config file")
+	flags.Var(&settings.ProcessManager.ShutdownGracePeriod, "processmanager.shutdowngraceperiod", "how long the station processes are given to exit on shutdown")
+	flags.StringVar(&settings.MQTT.ConfigFilePath, "mqtt.configfilepath", settings.MQTT.ConfigFilePath, "the MQTT bridge's config file")
+	flags.BoolVar(&settings.Auth.AnonymousRead, "auth.anonymousread", settings.Auth.AnonymousRead, "allow reading the weather data without an API key")
+	return flags
+}
+
+// EnvironmentVariable returns the name of the environment variable that sets the flag 'flagName'
+func EnvironmentVariable(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, ".", "_"))
+}
+
+// Validate checks that every setting has a usable value
+func (settings *Settings) Validate() error {
+	if err := validatePort("HTTP.Port", settings.HTTP.Port); err != nil {
+		return err
+	}
+	if err := validatePort("HTTP.ConfigAPIPort", settings.HTTP.ConfigAPIPort); err != nil {
+		return err
+	}
+	if settings.HTTP.Port == settings.HTTP.ConfigAPIPort {
+		return Interfaces.ValidationError("HTTP.Port and HTTP.ConfigAPIPort can not both be %v", settings.HTTP.Port)
+	}
+	if settings.HTTP.ShutdownTimeout.Duration <= 0 {
+		return Interfaces.ValidationError("HTTP.ShutdownTimeout must be greater than 0")
+	}
+
+	if settings.Storage.DatabasePath == "" {
+		return Interfaces.ValidationError("Storage.DatabasePath can not be empty")
+	}
+	if settings.Storage.StaleAfter.Duration < 0 {
+		return Interfaces.ValidationError("Storage.StaleAfter can not be negative")
+	}
+
+	if settings.Logger.Interval < 1 {
+		return Interfaces.ValidationError("Logger.Interval must be at least 1 minute")
+	}
+	for property, statistic := range settings.Logger.Statistics {
+		if !Interfaces.IsStatistic(statistic) {
+			return Interfaces.ValidationError("Logger.Statistics: '%v' for '%v' is not a statistic", statistic, property)
+		}
+	}
+
+	if settings.ProcessManager.ConfigFilePath == "" {
+		return Interfaces.ValidationError("ProcessManager.ConfigFilePath can not be empty")
+	}
+	if settings.ProcessManager.ShutdownGracePeriod.Duration <= 0 {
+		return Interfaces.ValidationError("ProcessManager.ShutdownGracePeriod must be greater than 0")
+	}
+	return nil
+}
+
+// validatePort checks that 'port' is a TCP port number
+func validatePort(name string, port Port) error {
+	number, err := strconv.Atoi(string(port))
+	if err != nil || number < 1 || number > 65535 {
+		return Interfaces.ValidationError("%v '%v' is not a port number between 1 and 65535", name, port)
+	}
+	return nil
+}
+
+// Port is a TCP port number; it can be written as a number or as text in the config file
+type Port string
+
+// Set sets the port from the flag value; it is checked by Validate
+func (p *Port) Set(value string) error {
+	*p = Port(value)
+	return nil
+}
+
+func (p Port) String() string {
+	return string(p)
+}
+
+func (p *Port) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*p = Port(text)
+		return nil
+	}
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return fmt.Errorf("a port must be a number such as 8080")
+	}
+	*p = Port(number.String())
+	return nil
+}
+
+// Duration is a time.Duration that is written as text, e.g. "10m" or "30s", in the config file and flags
+type Duration struct {
+	time.Duration
+}
+
+// Set parses the flag value
+func (d *Duration) Set(value string) error {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("a duration must be text such as \"10m\" or \"30s\"")
+	}
+	return d.Set(value)
+}
@@ -0,0 +1,239 @@
+/*
+	Units converts sensor readings between units of measure. Units are identified by the symbol stored in UnitType.UnitOfMeasure
+*/
+package Units
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Josiah-B/Cyclone/Interfaces"
+)
+
+// Quantity is the kind of thing a unit measures; values can only be converted between units of the same quantity
+type Quantity string
+
+const (
+	Temperature   Quantity = "temperature"
+	Pressure      Quantity = "pressure"
+	Speed         Quantity = "speed"
+	Precipitation Quantity = "precipitation"
+	RainRate      Quantity = "rainRate"
+	Distance      Quantity = "distance"
+)
+
+// Unit describes a single unit of measure and how to convert it to and from the base unit of its quantity
+type Unit struct {
+	Symbol   string
+	Name     string
+	Quantity Quantity
+	// toBase and fromBase convert to and from the quantity's base unit (°C, hPa, m/s, mm, mm/h and m)
+	toBase   func(float64) float64
+	fromBase func(float64) float64
+}
+
+// linear creates a unit that is 'factor' base units in size
+func linear(symbol string, name string, quantity Quantity, factor float64) Unit {
+	return Unit{
+		Symbol:   symbol,
+		Name:     name,
+		Quantity: quantity,
+		toBase:   func(v float64) float64 { return v * factor },
+		fromBase: func(v float64) float64 { return v / factor }}
+}
+
+var (
+	units = []Unit{
+		Unit{Symbol: "C", Name: "Celsius", Quantity: Temperature,
+			toBase:   func(v float64) float64 { return v },
+			fromBase: func(v float64) float64 { return v }},
+		Unit{Symbol: "F", Name: "Fahrenheit", Quantity: Temperature,
+			toBase:   func(v float64) float64 { return (v - 32) * 5 / 9 },
+			fromBase: func(v float64) float64 { return v*9/5 + 32 }},
+		Unit{Symbol: "K", Name: "Kelvin", Quantity: Temperature,
+			toBase:   func(v float64) float64 { return v - 273.15 },
+			fromBase: func(v float64) float64 { return v + 273.15 }},
+
+		linear("hPa", "Hectopascals", Pressure, 1),
+		linear("mbar", "Millibars", Pressure, 1),
+		linear("kPa", "Kilopascals", Pressure, 10),
+		linear("inHg", "Inches of mercury", Pressure, 33.8638866667),
+		linear("mmHg", "Millimeters of mercury", Pressure, 1.33322387415),
+
+		linear("m/s", "Meters per second", Speed, 1),
+		linear("kph", "Kilometers per hour", Speed, 1/3.6),
+		linear("mph", "Miles per hour", Speed, 0.44704),
+		linear("knots", "Knots", Speed, 1852.0/3600),
+
+		linear("mm", "Millimeters", Precipitation, 1),
+		linear("cm", "Centimeters", Precipitation, 10),
+		linear("in", "Inches", Precipitation, 25.4),
+
+		linear("mm/h", "Millimeters per hour", RainRate, 1),
+		linear("in/h", "Inches per hour", RainRate, 25.4),
+
+		linear("m", "Meters", Distance, 1),
+		linear("km", "Kilometers", Distance, 1000),
+		linear("ft", "Feet", Distance, 0.3048),
+		linear("mi", "Miles", Distance, 1609.344),
+	}
+
+	// aliases maps the other common ways of writing a unit to its symbol
+	aliases = map[string]string{
+		"°c": "C", "degc": "C", "celsius": "C",
+		"°f": "F", "degf": "F", "fahrenheit": "F",
+		"kelvin":    "K",
+		"mb":        "mbar",
+		"millibars": "mbar",
+		"in hg":     "inHg",
+		"inchhg":    "inHg",
+		"mm hg":     "mmHg",
+		"ms":        "m/s",
+		"mps":       "m/s",
+		"km/h":      "kph",
+		"kmh":       "kph",
+		"kt":        "knots",
+		"kn":        "knots",
+		"knot":      "knots",
+		"inches":    "in",
+		"inch":      "in",
+		"\"":        "in",
+		"in/hr":     "in/h",
+		"mm/hr":     "mm/h",
+	}
+
+	// systems holds the unit each named measurement system uses for every quantity
+	systems = map[string]map[Quantity]string{
+		"metric": {
+			Temperature:   "C",
+			Pressure:      "hPa",
+			Speed:         "kph",
+			Precipitation: "mm",
+			RainRate:      "mm/h",
+			Distance:      "km"},
+		"imperial": {
+			Temperature:   "F",
+			Pressure:      "inHg",
+			Speed:         "mph",
+			Precipitation: "in",
+			RainRate:      "in/h",
+			Distance:      "mi"},
+	}
+
+	unitsBySymbol = map[string]Unit{}
+)
+
+func init() {
+	for _, u := range units {
+		unitsBySymbol[strings.ToLower(u.Symbol)] = u
+	}
+}
+
+// Lookup finds a unit by its symbol or one of its common aliases, ignoring case
+func Lookup(symbol string) (Unit, bool) {
+	key := strings.ToLower(strings.TrimSpace(symbol))
+	if alias, ok := aliases[key]; ok {
+		key = strings.ToLower(alias)
+	}
+	u, ok := unitsBySymbol[key]
+	return u, ok
+}
+
+// Units returns every unit that can be converted, sorted by quantity then symbol
+func Units() []Unit {
+	list := append([]Unit(nil), units...)
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Quantity != list[j].Quantity {
+			return list[i].Quantity < list[j].Quantity
+		}
+		return list[i].Symbol < list[j].Symbol
+	})
+	return list
+}
+
+// Convert converts 'value' from the unit 'from' to the unit 'to'. Both units must measure the same quantity.
+func Convert(value float64, from string, to string) (float64, error) {
+	fromUnit, ok := Lookup(from)
+	if !ok {
+		return value, Interfaces.ValidationError("unknown unit '%v'", from)
+	}
+	toUnit, ok := Lookup(to)
+	if !ok {
+		return value, Interfaces.ValidationError("unknown unit '%v'", to)
+	}
+	if fromUnit.Quantity != toUnit.Quantity {
+		return value, Interfaces.ValidationError("can not convert %v (%v) to %v (%v)", fromUnit.Symbol, fromUnit.Quantity, toUnit.Symbol, toUnit.Quantity)
+	}
+	return toUnit.fromBase(fromUnit.toBase(value)), nil
+}
+
+// Preferences holds the unit a client wants each quantity converted to
+type Preferences map[Quantity]string
+
+// ParsePreferences reads the value of a '?units=' query parameter. The value is a comma separated list containing
+// a measurement system ('metric' or 'imperial') and/or per quantity overrides written as 'quantity:unit', e.g. "metric,pressure:inHg".
+// Later entries override earlier ones.
+func ParsePreferences(value string) (Preferences, error) {
+	preferences := Preferences{}
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) == 1 {
+			system, ok := systems[strings.ToLower(entry)]
+			if !ok {
+				return nil, Interfaces.ValidationError("unknown unit system '%v'; use metric, imperial or quantity:unit", entry)
+			}
+			for quantity, symbol := range system {
+				preferences[quantity] = symbol
+			}
+			continue
+		}
+
+		u, ok := Lookup(parts[1])
+		if !ok {
+			return nil, Interfaces.ValidationError("unknown unit '%v'", parts[1])
+		}
+		if !strings.EqualFold(string(u.Quantity), strings.TrimSpace(parts[0])) {
+			return nil, Interfaces.ValidationError("unit '%v' does not measure %v", parts[1], parts[0])
+		}
+		preferences[u.Quantity] = u.Symbol
+	}
+	return preferences, nil
+}
+
+// ConvertValue converts 'value' from the unit 'from' into the preferred unit for its quantity. The converted value and its unit symbol are returned;
+// values in units that are unknown, or that have no preference, are returned unchanged.
+func (preferences Preferences) ConvertValue(value float64, from string) (float64, string) {
+	fromUnit, ok := Lookup(from)
+	if !ok {
+		return value, from
+	}
+	to, ok := preferences[fromUnit.Quantity]
+	if !ok {
+		return value, fromUnit.Symbol
+	}
+	converted, err := Convert(value, fromUnit.Symbol, to)
+	if err != nil {
+		return value, fromUnit.Symbol
+	}
+	return converted, to
+}
+
+// ConvertDifference converts a difference or total of values, such as the sum of an aggregate bucket, into the preferred unit.
+// Only the scale of the units is applied; an offset such as the 32° between Celsius and Fahrenheit would otherwise be counted once for every value summed.
+func (preferences Preferences) ConvertDifference(value float64, from string) (float64, string) {
+	converted, unit := preferences.ConvertValue(value, from)
+	zero, _ := preferences.ConvertValue(0, from)
+	return converted - zero, unit
+}
+
+// String describes the unit, e.g. "F (Fahrenheit, temperature)"
+func (u Unit) String() string {
+	return fmt.Sprintf("%v (%v, %v)", u.Symbol, u.Name, u.Quantity)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/Josiah-B/Cyclone/Interfaces"
+	"github.com/Josiah-B/Cyclone/SQLiteDatabase"
+)
+
+// runCommand runs the command given after the flags instead of starting the program, and returns the exit code
+func runCommand(args []string) int {
+	var err error
+	switch {
+	case args[0] == "token" && len(args) >= 2:
+		err = tokenCommand(args)
+	case args[0] == "migrate":
+		err = migrateCommand(args[1:])
+	default:
+		fmt.Println("Unknown command: ", strings.Join(args, " "))
+		fmt.Println("Commands: token issue -name <name> -scopes <read,upload,admin> [-station <station name>] | token list | token revoke <token ID> | migrate [-dry-run]")
+		return 2
+	}
+
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return 0
+}
+
+// tokenCommand runs the 'token issue', 'token list' and 'token revoke' commands
+func tokenCommand(args []string) error {
+	setupDatabase()
+	defer dataStore.Close()
+
+	var err error
+	switch args[1] {
+	case "issue":
+		err = issueTokenCommand(args[2:])
+	case "list":
+		err = listTokensCommand()
+	case "revoke":
+		if len(args) != 3 {
+			err = Interfaces.ValidationError("usage: token revoke <token ID>")
+		} else if err = dataStore.RevokeAPIToken(args[2]); err == nil {
+			fmt.Println("Revoked token ", args[2])
+		}
+	default:
+		err = Interfaces.ValidationError("unknown token command '%v'; use issue, list or revoke", args[1])
+	}
+	return err
+}
+
+// migrateCommand upgrades the database to the latest schema version, or with -dry-run lists the migrations that would be applied
+func migrateCommand(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "list the pending migrations without applying them")
+	if err := flags.Parse(args); err != nil {
+		return Interfaces.ValidationError("%v", err)
+	}
+
+	db := SQLiteDatabase.DataBase{Configuration: SQLiteDatabase.SqliteSettings{Path: settings.Storage.DatabasePath, SkipUpgrade: true}}
+	if err := db.Open(); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	fmt.Printf("The database '%v' is at version %v\n", settings.Storage.DatabasePath, db.Version())
+	pending, err := db.Upgrade(*dryRun)
+	switch {
+	case err != nil:
+		return err
+	case *dryRun && len(pending) == 0:
+		fmt.Println("There are no pending migrations")
+	case *dryRun:
+		fmt.Printf("%v migrations would be applied, run 'migrate' without -dry-run to apply them\n", len(pending))
+	default:
+		fmt.Printf("The database is up to date at version %v\n", db.Version())
+	}
+	return nil
+}
+
+// issueTokenCommand issues an API token and prints its key, which can not be shown again
+func issueTokenCommand(args []string) error {
+	flags := flag.NewFlagSet("token issue", flag.ContinueOnError)
+	name := flags.String("name", "", "who or what the token is for")
+	scopes := flags.String("scopes", "", "comma separated scopes: read, upload and admin")
+	station := flags.String("station", "", "limits an upload token to this station")
+	if err := flags.Parse(args); err != nil {
+		return Interfaces.ValidationError("%v", err)
+	}
+
+	token := Interfaces.APIToken{Name: *name, StationName: *station}
+	for _, scope := range strings.Split(*scopes, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			token.Scopes = append(token.Scopes, scope)
+		}
+	}
+
+	key, err := dataStore.IssueAPIToken(&token)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Issued token %v '%v' with scopes %v\n", token.TokenID, token.Name, strings.Join(token.Scopes, ", "))
+	fmt.Println("Key (it will not be shown again): ", key)
+	return nil
+}
+
+// listTokensCommand prints every API token that has not been revoked
+func listTokensCommand() error {
+	tokens, err := dataStore.GetAPITokens()
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		lastUsed := "never"
+		if token.LastUsed != nil {
+			lastUsed = token.LastUsed.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Printf("%v\t%v\t%v\t%v\tlast used: %v\n", token.TokenID, token.Name, strings.Join(token.Scopes, ","), token.StationName, lastUsed)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Josiah-B/Cyclone/Interfaces"
+)
+
+// ecowittField describes how an Ecowitt / Ambient Weather upload parameter maps onto a sensor reading
+type ecowittField struct {
+	// Property is the ObservedProperty name; it is also used as the sensor name, with the channel appended for multi-channel sensors
+	Property    string
+	Unit        string
+	Description string
+}
+
+// ecowittFields lists the known upload parameters. Parameters of multi-channel sensors use '#' in place of the channel number, e.g. "soilmoisture#".
+var ecowittFields = map[string]ecowittField{
+	"tempf":            ecowittField{Property: "Temperature", Unit: "F", Description: "Outdoor temperature"},
+	"humidity":         ecowittField{Property: "Humidity", Unit: "%", Description: "Outdoor humidity"},
+	"tempinf":          ecowittField{Property: "IndoorTemperature", Unit: "F", Description: "Indoor temperature"},
+	"humidityin":       ecowittField{Property: "IndoorHumidity", Unit: "%", Description: "Indoor humidity"},
+	"baromrelin":       ecowittField{Property: "Barometer", Unit: "inHg", Description: "Relative (sea level) barometric pressure"},
+	"baromabsin":       ecowittField{Property: "Pressure", Unit: "inHg", Description: "Absolute (station) barometric pressure"},
+	"winddir":          ecowittField{Property: "WindDirection", Unit: "deg", Description: "Wind direction"},
+	"windspeedmph":     ecowittField{Property: "WindSpeed", Unit: "mph", Description: "Wind speed"},
+	"windgustmph":      ecowittField{Property: "WindGust", Unit: "mph", Description: "Wind gust"},
+	"maxdailygust":     ecowittField{Property: "MaxDailyGust", Unit: "mph", Description: "Highest wind gust today"},
+	"rainratein":       ecowittField{Property: "RainRate", Unit: "in/h", Description: "Rain rate"},
+	"eventrainin":      ecowittField{Property: "EventRain", Unit: "in", Description: "Rain this rain event"},
+	"hourlyrainin":     ecowittField{Property: "HourlyRain", Unit: "in", Description: "Rain this hour"},
+	"dailyrainin":      ecowittField{Property: "DailyRain", Unit: "in", Description: "Rain today"},
+	"weeklyrainin":     ecowittField{Property: "WeeklyRain", Unit: "in", Description: "Rain this week"},
+	"monthlyrainin":    ecowittField{Property: "MonthlyRain", Unit: "in", Description: "Rain this month"},
+	"yearlyrainin":     ecowittField{Property: "YearlyRain", Unit: "in", Description: "Rain this year"},
+	"totalrainin":      ecowittField{Property: "TotalRain", Unit: "in", Description: "Rain since the gauge was reset"},
+	"solarradiation":   ecowittField{Property: "SolarRadiation", Unit: "W/m2", Description: "Solar radiation"},
+	"uv":               ecowittField{Property: "UV", Unit: "index", Description: "UV index"},
+	"co2":              ecowittField{Property: "CO2", Unit: "ppm", Description: "Carbon dioxide"},
+	"lightning":        ecowittField{Property: "LightningDistance", Unit: "km", Description: "Distance to the last lightning strike"},
+	"lightning_num":    ecowittField{Property: "LightningStrikes", Unit: "count", Description: "Lightning strikes today"},
+	"temp#f":           ecowittField{Property: "Temperature", Unit: "F", Description: "Temperature"},
+	"humidity#":        ecowittField{Property: "Humidity", Unit: "%", Description: "Humidity"},
+	"soilmoisture#":    ecowittField{Property: "SoilMoisture", Unit: "%", Description: "Soil moisture"},
+	"soiltemp#f":       ecowittField{Property: "SoilTemperature", Unit: "F", Description: "Soil temperature"},
+	"leafwetness_ch#":  ecowittField{Property: "LeafWetness", Unit: "%", Description: "Leaf wetness"},
+	"pm25_ch#":         ecowittField{Property: "PM2.5", Unit: "ug/m3", Description: "PM2.5 particulates"},
+	"pm25_avg_24h_ch#": ecowittField{Property: "PM2.5Avg24h", Unit: "ug/m3", Description: "PM2.5 particulates, 24 hour average"},
+	"pm25":             ecowittField{Property: "PM2.5", Unit: "ug/m3", Description: "PM2.5 particulates"},
+	"pm10":             ecowittField{Property: "PM10", Unit: "ug/m3", Description: "PM10 particulates"},
+	"leak_ch#":         ecowittField{Property: "Leak", Unit: "", Description: "Water leak detector"},
+}
+
+// ecowittChannelPattern splits a parameter such as "temp2f" or "pm25_ch3" into its name, channel number and suffix
+var ecowittChannelPattern = regexp.MustCompile(`^(.*?)(\d+)([a-z]*)$`)
+
+// ecowittReading is a single parsed reading along with the metadata used to create its data stream
+type ecowittReading struct {
+	SensorName string
+	Field      ecowittField
+	Reading    Interfaces.SensorReading
+}
+
+// lookupEcowittField finds the field for an upload parameter and returns the sensor name to store it under
+func lookupEcowittField(key string) (ecowittField, string, bool) {
+	key = strings.ToLower(key)
+	if field, ok := ecowittFields[key]; ok {
+		return field, field.Property, true
+	}
+
+	match := ecowittChannelPattern.FindStringSubmatch(key)
+	if match == nil {
+		return ecowittField{}, "", false
+	}
+	field, ok := ecowittFields[match[1]+"#"+match[3]]
+	if !ok {
+		return ecowittField{}, "", false
+	}
+	field.Description = fmt.Sprintf("%v, channel %v", field.Description, match[2])
+	return field, field.Property + "Ch" + match[2], true
+}
+
+// parseEcowittUpload converts the parameters of an Ecowitt / Ambient Weather upload into readings; unknown parameters are ignored
+func parseEcowittUpload(form url.Values) ([]ecowittReading, error) {
+	var readings []ecowittReading
+	for key, values := range form {
+		field, sensorName, ok := lookupEcowittField(key)
+		if !ok || len(values) == 0 || values[0] == "" || values[0] == wuMissingValue {
+			continue
+		}
+
+		reading, err := Interfaces.ParseSensorReading(values[0])
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", key, err)
+		}
+		if reading.IsNumeric() {
+			reading.Unit = field.Unit
+		}
+		readings = append(readings, ecowittReading{SensorName: sensorName, Field: field, Reading: reading})
+	}
+	return readings, nil
+}
+
+// ecowittUpload handles the custom server uploads sent by Ecowitt gateways (form encoded POST) and Ambient Weather consoles (query string).
+// The station is found by the PASSKEY or MAC parameter, which must match a station's DeviceKey.
+func (httpMux *HTTPMux) ecowittUpload(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeErrorResponse(w, Interfaces.ValidationError("unable to read the upload: %v", err))
+		return
+	}
+
+	stn, err := httpMux.findEcowittStation(r.Form)
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	timeStamp, err := parseUploadTime(getQueryValue(r.Form, "dateutc"))
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+	upload := Interfaces.StationUploadTemplate{
+		StationName:    stn.Name,
+		TimeStamp:      timeStamp,
+		SensorReadings: make(map[string]Interfaces.SensorReading)}
+
+	readings, err := parseEcowittUpload(r.Form)
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	// describe the sensors with the hardware that sent them
+	model := getQueryValue(r.Form, "model")
+	if model == "" {
+		model = getQueryValue(r.Form, "stationtype")
+	}
+
+	for _, reading := range readings {
+		description := reading.Field.Description
+		if model != "" {
+			description += " (" + model + ")"
+		}
+		if err = httpMux.ensureDataStream(stn.StationID, reading.SensorName, description, reading.Field.Property, reading.Field.Unit); err != nil {
+			writeErrorResponse(w, err)
+			return
+		}
+		upload.SensorReadings[reading.SensorName] = reading.Reading
+	}
+
+	fmt.Println("Setting current weather conditions for Ecowitt / Ambient Weather station: " + upload.StationName)
+	err = httpMux.db.SetCurrentSensorReadings(upload)
+	writeResult(w, http.StatusOK, upload, err)
+}
+
+// findEcowittStation looks up the station by the upload's PASSKEY, falling back to its MAC address
+func (httpMux *HTTPMux) findEcowittStation(form url.Values) (*Interfaces.Station, error) {
+	for _, key := range []string{"PASSKEY", "MAC"} {
+		deviceKey := getQueryValue(form, key)
+		if deviceKey == "" {
+			continue
+		}
+
+		stn, err := httpMux.db.GetStationByDeviceKey(deviceKey)
+		if errors.Is(err, Interfaces.ErrNotFound) {
+			continue
+		}
+		return stn, err
+	}
+	return nil, fmt.Errorf("%w: no station has a DeviceKey matching the upload's PASSKEY or MAC", Interfaces.ErrUnauthorized)
+}
+
+// forgetEnsuredStreams clears the remembered data streams, so the streams that were deleted are created again by the next upload
+func (httpMux *HTTPMux) forgetEnsuredStreams() {
+	httpMux.ensuredStreamsLock.Lock()
+	defer httpMux.ensuredStreamsLock.Unlock()
+	httpMux.ensuredStreams = make(map[string]bool)
+}
+
+// ensureDataStream makes sure the data stream exists, remembering the streams that have been checked so each upload does not hit the database
+func (httpMux *HTTPMux) ensureDataStream(stationID int, sensorName string, description string, property string, unit string) error {
+	key := strconv.Itoa(stationID) + "/" + sensorName
+
+	httpMux.ensuredStreamsLock.Lock()
+	defer httpMux.ensuredStreamsLock.Unlock()
+	if httpMux.ensuredStreams[key] {
+		return nil
+	}
+
+	if _, err := httpMux.db.EnsureDataStream(stationID, sensorName, description, property, unit); err != nil {
+		return err
+	}
+	httpMux.ensuredStreams[key] = true
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Josiah-B/Cyclone/Interfaces"
+)
+
+func (storage *uploadStorage) GetStationByDeviceKey(deviceKey string) (*Interfaces.Station, error) {
+	if deviceKey != storage.station.DeviceKey {
+		return nil, Interfaces.NotFoundError("station", deviceKey)
+	}
+	return storage.station, nil
+}
+
+func (storage *uploadStorage) EnsureDataStream(stationID int, sensorName string, sensorDescription string, propertyName string, unitOfMeasure string) (*Interfaces.DataStream, error) {
+	storage.streams = append(storage.streams, sensorName)
+	return &Interfaces.DataStream{StationID: stationID}, nil
+}
+
+// gatewayForm is an upload as sent by an Ecowitt GW1100 gateway
+const gatewayForm = "PASSKEY=A1B2C3D4E5F6&stationtype=GW1100A_V2.1.4&runtime=3&dateutc=2024-05-01+12:34:56&tempinf=72.5&humidityin=40" +
+	"&baromrelin=29.920&baromabsin=29.800&tempf=60.1&humidity=55&winddir=180&windspeedmph=3.36&windgustmph=5.82&maxdailygust=10.29" +
+	"&solarradiation=120.50&uv=1&rainratein=0.000&eventrainin=0.000&dailyrainin=0.020&temp1f=65.3&humidity1=48&soilmoisture1=33" +
+	"&wh65batt=0&freq=915M&model=GW1100A"
+
+func TestEcowittUpload(t *testing.T) {
+	storage := &uploadStorage{station: &Interfaces.Station{StationID: 3, Name: "Backyard", DeviceKey: "A1B2C3D4E5F6"}}
+	httpMux := newUploadMux(storage)
+
+	request := httptest.NewRequest("POST", "/data/report/", strings.NewReader(gatewayForm))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response := httptest.NewRecorder()
+	httpMux.router.ServeHTTP(response, request)
+
+	if response.Code != http.StatusOK {
+		t.Fatalf("got status %v: %v", response.Code, response.Body.String())
+	}
+	if len(storage.uploads) != 1 {
+		t.Fatalf("got %v uploads, want 1", len(storage.uploads))
+	}
+	upload := storage.uploads[0]
+	if upload.StationName != "Backyard" {
+		t.Errorf("got StationName '%v', want 'Backyard'", upload.StationName)
+	}
+	if want := time.Date(2024, 5, 1, 12, 34, 56, 0, time.UTC); !upload.TimeStamp.Equal(want) {
+		t.Errorf("got TimeStamp %v, want %v", upload.TimeStamp, want)
+	}
+	for sensorName, want := range map[string]float64{"Temperature": 60.1, "TemperatureCh1": 65.3, "SoilMoistureCh1": 33, "Barometer": 29.92} {
+		reading, ok := upload.SensorReadings[sensorName]
+		if !ok || reading.Value == nil || *reading.Value != want {
+			t.Errorf("got %v = %+v, want %v", sensorName, reading, want)
+		}
+	}
+	if len(storage.streams) != len(upload.SensorReadings) {
+		t.Errorf("got %v data streams for %v readings", len(storage.streams), len(upload.SensorReadings))
+	}
+}
+
+func TestEcowittUploadWithoutDate(t *testing.T) {
+	storage := &uploadStorage{station: &Interfaces.Station{StationID: 3, Name: "Backyard", DeviceKey: "00:11:22:33:44:55"}}
+	httpMux := newUploadMux(storage)
+
+	// Ambient Weather consoles send a GET, identified by their MAC address
+	query := url.Values{"MAC": {"00:11:22:33:44:55"}, "tempf": {"50.0"}}
+	response := httptest.NewRecorder()
+	httpMux.router.ServeHTTP(response, httptest.NewRequest("GET", "/data/report/?"+query.Encode(), nil))
+
+	if response.Code != http.StatusOK {
+		t.Fatalf("got status %v: %v", response.Code, response.Body.String())
+	}
+	if len(storage.uploads) != 1 || time.Since(storage.uploads[0].TimeStamp) > time.Minute {
+		t.Fatalf("the upload was not stored at the current time: %+v", storage.uploads)
+	}
+}
+
+func TestEcowittUploadUnknownStation(t *testing.T) {
+	storage := &uploadStorage{station: &Interfaces.Station{StationID: 3, Name: "Backyard", DeviceKey: "A1B2C3D4E5F6"}}
+	httpMux := newUploadMux(storage)
+
+	request := httptest.NewRequest("POST", "/data/report/", strings.NewReader("PASSKEY=FFFFFFFFFFFF&tempf=60.1"))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response := httptest.NewRecorder()
+	httpMux.router.ServeHTTP(response, request)
+
+	if response.Code != http.StatusUnauthorized {
+		t.Fatalf("got status %v, want %v", response.Code, http.StatusUnauthorized)
+	}
+	if len(storage.uploads) != 0 {
+		t.Fatalf("the upload of an unknown station was stored")
+	}
+}
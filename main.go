@@ -2,38 +2,40 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
+	"github.com/Josiah-B/Cyclone/Derived"
+	"github.com/Josiah-B/Cyclone/EventBus"
 	"github.com/Josiah-B/Cyclone/Logger"
+	"github.com/Josiah-B/Cyclone/MQTTBridge"
 	"github.com/Josiah-B/Cyclone/MemoryCache"
 	"github.com/Josiah-B/Cyclone/ProcessManager"
+	"github.com/Josiah-B/Cyclone/Settings"
 
 	"github.com/Josiah-B/Cyclone/Interfaces"
 
 	"github.com/Josiah-B/Cyclone/ConfigAPI"
 )
 
-// structure for holding the settings: this is a temporary measure until we can get a standard in place
-type Settings struct {
-	configAPIport             string
-	hostPort                  string
-	dbPath                    string
-	procManagerConfigFilePath string
-}
-
 var (
 	httpMuxRouter HTTPMux
 	dataStore     Interfaces.Storage
 
-	//Configuration options
-	settings = Settings{
-		configAPIport: "8000",
-		hostPort:      "8080",
-		dbPath:        "./database.db",
-		procManagerConfigFilePath: "./config/process manager.json"}
+	//this passes every upload on to the clients streaming current conditions; it remembers the last 100 uploads so streams can resume
+	eventBus = EventBus.NewBus(100)
+
+	//Configuration options, loaded from the config file, environment variables and flags
+	settings Settings.Settings
 
 	//Proccess Management API
 	confAPI ConfigAPI.HTTPMux
@@ -43,51 +45,160 @@ var (
 
 	//this monitors our station processes and restarts them if they crash
 	processManager *ProcessManager.ProcessMgr
+
+	//this subscribes to the MQTT topics stations publish their readings to; nil when there is no MQTT config file
+	mqttBridge *MQTTBridge.Bridge
 )
 
 func main() {
+	var err error
+	settings, err = Settings.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Println("Invalid settings: ", err)
+		os.Exit(2)
+	}
+	fmt.Println("Settings loaded from: ", settings.ConfigFilePath)
+
+	if len(settings.Command) > 0 {
+		os.Exit(runCommand(settings.Command))
+	}
+
+	// the program runs until it is interrupted, terminated or the exit command is entered
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	setupDatabase()
+	setupMQTTBridge()
 
 	//setup the process manager
-	processManager = ProcessManager.NewProcessMgr(settings.procManagerConfigFilePath)
-	//setup the configAPI
-	confAPI.Create(processManager)
-	go http.ListenAndServe(":"+settings.configAPIport, confAPI.Router)
-
-	httpMuxRouter.Create(dataStore)
+	processManager = ProcessManager.NewProcessMgr(settings.ProcessManager.ConfigFilePath, dataStore)
+	httpMuxRouter.Create(dataStore, eventBus, settings.Auth.AnonymousRead)
 	logger = new(Logger.Logger)
-	logger.Interval = 15 //Logging interval in Minutes
-	logger.Initilize(dataStore)
-
+	logger.Interval = settings.Logger.Interval //Default logging interval in Minutes
+	logger.LogDerivedValues = settings.Logger.LogDerivedValues
+	logger.LogMinMax = settings.Logger.LogMinMax
+	logger.Statistics = settings.Logger.Statistics
+	loggerDone := logger.Initilize(ctx, dataStore)
+	addCurrentReadingsListener(logger)
 	fmt.Println("Data Logger started")
-	//fmt.Println("Closing Database...")
-	//dataStore.Close()
 
-	fmt.Println("Starting Webserver")
+	if mqttBridge != nil {
+		mqttBridge.Start()
+	}
 
-	// start the web server
-	go http.ListenAndServe(":"+settings.hostPort, httpMuxRouter.router)
+	//setup the configAPI
+	confAPI.Create(processManager, mqttBridge, logger, settings, dataStore)
+	configServer := startServer(ctx, stop, ":"+settings.HTTP.ConfigAPIPort.String(), confAPI.Router)
 
+	// start the web server
+	fmt.Println("Starting Webserver")
+	webServer := startServer(ctx, stop, ":"+settings.HTTP.Port.String(), httpMuxRouter.router)
 	fmt.Println("Webserver started")
-	fmt.Println("Starting Logger")
 
-	// wait for the user to enter the exit commend
-	listenForExit()
+	// wait for the user to enter the exit commend, or a signal
+	go listenForExit(stop)
+	<-ctx.Done()
 
+	shutdown(loggerDone, webServer, configServer)
 	fmt.Println("Program Completed!")
 }
 
+// startServer serves 'handler' on 'address' until the server is shut down. Requests are cancelled when 'ctx' is, so streams end on shutdown.
+// If the server can not start, 'stop' is called to shut the program down.
+func startServer(ctx context.Context, stop context.CancelFunc, address string, handler http.Handler) *http.Server {
+	server := &http.Server{
+		Addr:        address,
+		Handler:     handler,
+		BaseContext: func(net.Listener) context.Context { return ctx }}
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Println("Failed to start the server on ", address, ": ", err)
+			stop()
+		}
+	}()
+	return server
+}
+
+// shutdown stops the program in order: the servers stop accepting requests, the MQTT bridge disconnects, the station processes are ended,
+// the Logger waits for its timers to stop ('loggerDone' is closed) and logs what has been uploaded since its last pass, and finally the database is closed.
+func shutdown(loggerDone <-chan struct{}, servers ...*http.Server) {
+	fmt.Println("Shutting down...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), settings.HTTP.ShutdownTimeout.Duration)
+	defer cancel()
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			fmt.Println("Failed to shut down the server on ", server.Addr, ": ", err)
+		}
+	}
+
+	if mqttBridge != nil {
+		mqttBridge.Stop()
+	}
+
+	// the processes may still upload readings while they stop, so they are stopped before the interval is logged
+	fmt.Println("Stopping the station processes")
+	processManager.Shutdown(settings.ProcessManager.ShutdownGracePeriod.Duration)
+
+	<-loggerDone
+	fmt.Println("Logging the current interval")
+	logger.Flush()
+
+	fmt.Println("Closing Database...")
+	if err := dataStore.Close(); err != nil {
+		fmt.Println("Failed to close the database: ", err)
+	}
+}
+
 func setupDatabase() {
 	var temp = new(MemoryCache.Cache)
-	temp.DataBasePath = settings.dbPath
+	temp.DataBasePath = settings.Storage.DatabasePath
+	temp.Derivers = Derived.DefaultRegistry()
+	temp.Listeners = []Interfaces.CurrentReadingsListener{eventBus}
+	temp.StaleAfter = settings.Storage.StaleAfter.Duration
 	dataStore = temp
 
-	dataStore.Initilize()
+	if err := dataStore.Initilize(); err != nil {
+		fmt.Println("Failed to setup the database: ", err)
+	}
+
+}
+
+// setupMQTTBridge creates the MQTT bridge if there is an MQTT config file; it is started once the rest of the program is setup
+func setupMQTTBridge() {
+	config, err := MQTTBridge.LoadConfig(settings.MQTT.ConfigFilePath)
+	if os.IsNotExist(err) {
+		fmt.Println("No MQTT config file found, the MQTT bridge is disabled")
+		return
+	}
+	if err != nil {
+		fmt.Println("Failed to load the MQTT config file: ", err)
+		return
+	}
 
+	mqttBridge, err = MQTTBridge.NewBridge(config, dataStore)
+	if err != nil {
+		fmt.Println("Failed to setup the MQTT bridge: ", err)
+		return
+	}
+	// publish every upload through the bridge
+	addCurrentReadingsListener(mqttBridge)
+}
+
+// addCurrentReadingsListener has 'listener' notified of every upload to the data store
+func addCurrentReadingsListener(listener Interfaces.CurrentReadingsListener) {
+	if cache, ok := dataStore.(*MemoryCache.Cache); ok {
+		cache.Listeners = append(cache.Listeners, listener)
+	}
 }
 
-// listenForExit listens to the keyboard for the 'exit' command before returning.
-func listenForExit() {
+// listenForExit listens to the keyboard for the 'exit' command, then calls 'stop'.
+// If there is no keyboard (e.g. running as a service) it stops listening and the program runs until it receives a signal.
+func listenForExit(stop context.CancelFunc) {
 	fmt.Println("Type 'Exit' shutdown the program")
 	buf := bufio.NewReader(os.Stdin)
 	fmt.Print("> ")
@@ -97,13 +208,17 @@ func listenForExit() {
 	for continueToWait == true {
 		sentence, err := buf.ReadBytes('\n')
 
-		if err != nil {
+		if errors.Is(err, io.EOF) {
+			fmt.Println("No more input, send an interrupt signal to shutdown the program")
+			return
+		} else if err != nil {
 			fmt.Println(err)
 		} else {
 			var trimmedString = string(sentence[:])
 			if strings.Contains(strings.ToLower(trimmedString), "exit") {
 				fmt.Println("Exiting program...")
 				continueToWait = false
+				stop()
 			} else {
 				fmt.Println("Unknown Command: " + trimmedString)
 				fmt.Print("> ")
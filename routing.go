@@ -4,27 +4,47 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 
+	"github.com/Josiah-B/Cyclone/Auth"
+	"github.com/Josiah-B/Cyclone/EventBus"
 	"github.com/Josiah-B/Cyclone/Interfaces"
+	"github.com/Josiah-B/Cyclone/Units"
 	"github.com/gorilla/mux"
 )
 
 type HTTPMux struct {
 	router *mux.Router
 	db     Interfaces.Storage
+
+	// ensuredStreams remembers the data streams the upload handlers have already created or checked
+	ensuredStreams     map[string]bool
+	ensuredStreamsLock sync.Mutex
+
+	// events delivers each upload to the clients streaming current conditions
+	events *EventBus.Bus
+
+	// guard checks that each request has a token with the scope its route needs
+	guard Auth.Guard
 }
 
 var (
 	apiRoutes []Interfaces.APIRoute
 )
 
-// Create the url mappings for the REST operations
-func (httpMux *HTTPMux) Create(storage Interfaces.Storage) {
+// Create the url mappings for the REST operations. If 'anonymousRead' is true the routes that only read data can be used without an API key.
+func (httpMux *HTTPMux) Create(storage Interfaces.Storage, events *EventBus.Bus, anonymousRead bool) {
 	fmt.Println("Setting up storage object...")
 	httpMux.db = storage
+	httpMux.ensuredStreams = make(map[string]bool)
+	httpMux.events = events
+	httpMux.guard = Auth.Guard{Tokens: storage, AnonymousRead: anonymousRead, WriteError: writeErrorResponse}
 	fmt.Println("Storage object setup")
 	httpMux.router = mux.NewRouter()
 
@@ -51,7 +71,7 @@ func (httpMux *HTTPMux) Create(storage Interfaces.Storage) {
 			HTTPMethod:    "PUT",
 			Description:   "Modifies a current UnitType"},
 		Interfaces.APIRoute{
-			Route:         "/unitTypes",
+			Route:         "/unitTypes/{unitTypeID}",
 			HandlerMethod: httpMux.deleteUnitType,
 			HTTPMethod:    "DELETE",
 			Description:   "Deletes a UnitType"},
@@ -77,7 +97,7 @@ func (httpMux *HTTPMux) Create(storage Interfaces.Storage) {
 			HTTPMethod:    "PUT",
 			Description:   "Modifies a current sensor"},
 		Interfaces.APIRoute{
-			Route:         "/sensors",
+			Route:         "/sensors/{sensorID}",
 			HandlerMethod: httpMux.deleteSensor,
 			HTTPMethod:    "DELETE",
 			Description:   "Deletes a sensor"},
@@ -103,7 +123,7 @@ func (httpMux *HTTPMux) Create(storage Interfaces.Storage) {
 			HTTPMethod:    "PUT",
 			Description:   "Modifies a current Observed Property"},
 		Interfaces.APIRoute{
-			Route:         "/observedProperties",
+			Route:         "/observedProperties/{propertyID}",
 			HandlerMethod: httpMux.deleteObservedProperty,
 			HTTPMethod:    "DELETE",
 			Description:   "Deletes an Observed Property"},
@@ -129,10 +149,10 @@ func (httpMux *HTTPMux) Create(storage Interfaces.Storage) {
 			HTTPMethod:    "PUT",
 			Description:   "Modifies a current data stream"},
 		Interfaces.APIRoute{
-			Route:         "/dataStreams",
+			Route:         "/dataStreams/{streamID}",
 			HandlerMethod: httpMux.deleteDataStream,
 			HTTPMethod:    "DELETE",
-			Description:   "Deletes a current data stream"},
+			Description:   "Deletes a current data stream; add '?cascade=true' to also delete its observations"},
 
 		Interfaces.APIRoute{
 			Route:         "/observation/{observationID}",
@@ -143,7 +163,17 @@ func (httpMux *HTTPMux) Create(storage Interfaces.Storage) {
 			Route:         "/observations/{sensorID}",
 			HandlerMethod: httpMux.getObservations,
 			HTTPMethod:    "GET",
-			Description:   "Gets all of the logged observations for the specified sensor"},
+			Description:   "Gets the logged observations for the specified sensor; accepts the same query parameters as '/observations'"},
+		Interfaces.APIRoute{
+			Route:         "/observations",
+			HandlerMethod: httpMux.getObservations,
+			HTTPMethod:    "GET",
+			Description:   "Gets logged observations. Query parameters: start, end (RFC3339), sensor, station, stream, limit, cursor, sort (asc|desc), numeric (true to skip non-numeric readings). The cursor for the next page is returned in the 'X-Next-Cursor' header"},
+		Interfaces.APIRoute{
+			Route:         "/observations/{streamID}/aggregate",
+			HandlerMethod: httpMux.getAggregatedObservations,
+			HTTPMethod:    "GET",
+			Description:   "Aggregates a data stream's observations into buckets. Query parameters: bucket (hour|day|month|year), function (min|max|avg|sum|count), start, end (RFC3339)"},
 		Interfaces.APIRoute{
 			Route:         "/observation",
 			HandlerMethod: httpMux.addObservation,
@@ -179,37 +209,95 @@ func (httpMux *HTTPMux) Create(storage Interfaces.Storage) {
 			Route:         "/stations/logConditions",
 			HandlerMethod: httpMux.logConditions,
 			HTTPMethod:    "POST",
-			Description:   "Logs conditions to the Database"},
+			Description:   "Logs conditions to the Database",
+			Scope:         Interfaces.ScopeUpload},
 		Interfaces.APIRoute{
 			Route:         "/stations/setCurrentConditions",
 			HandlerMethod: httpMux.setCurrentConditions,
 			HTTPMethod:    "POST",
-			Description:   "Sets the current conditions for a station"},
+			Description:   "Sets the current conditions for a station. The readings are merged into the station's current readings; add '?mode=replace' or set \"Replace\" to replace them all",
+			Scope:         Interfaces.ScopeUpload},
 		Interfaces.APIRoute{
 			Route:         "/stations",
 			HandlerMethod: httpMux.modifyStation,
 			HTTPMethod:    "PUT",
 			Description:   "Modifies a current station"},
 		Interfaces.APIRoute{
-			Route:         "/stations",
+			Route:         "/stations/{stationID}",
 			HandlerMethod: httpMux.deleteStation,
 			HTTPMethod:    "DELETE",
-			Description:   "Deletes a station"},
+			Description:   "Deletes a station; add '?cascade=true' to also delete its data streams and observations"},
 
+		Interfaces.APIRoute{
+			Route:         "/weatherstation/updateweatherstation.php",
+			HandlerMethod: httpMux.wuUpload,
+			HTTPMethod:    "GET",
+			Description:   "Sets the current conditions for a station using the Weather Underground PWS upload protocol; ID is the station name and PASSWORD its upload password or an upload key for the station",
+			Scope:         Interfaces.ScopePublic},
+		Interfaces.APIRoute{
+			Route:         "/weatherstation/updateweatherstation.php",
+			HandlerMethod: httpMux.wuUpload,
+			HTTPMethod:    "POST",
+			Description:   "Same as the GET version, with the parameters sent as a form encoded body",
+			Scope:         Interfaces.ScopePublic},
+		Interfaces.APIRoute{
+			Route:         "/data/report/",
+			HandlerMethod: httpMux.ecowittUpload,
+			HTTPMethod:    "POST",
+			Description:   "Sets the current conditions for a station using the Ecowitt custom server protocol; the PASSKEY must match the station's DeviceKey",
+			Scope:         Interfaces.ScopePublic},
+		Interfaces.APIRoute{
+			Route:         "/data/report/",
+			HandlerMethod: httpMux.ecowittUpload,
+			HTTPMethod:    "GET",
+			Description:   "Sets the current conditions for a station using the Ambient Weather custom server protocol; the PASSKEY or MAC must match the station's DeviceKey",
+			Scope:         Interfaces.ScopePublic},
+		Interfaces.APIRoute{
+			Route:         "/current",
+			HandlerMethod: httpMux.getAllCurrentConditions,
+			HTTPMethod:    "GET",
+			Description:   "Gets the current conditions of every station that has uploaded, with when each sensor was last updated and whether it is stale; accepts '?units='"},
 		Interfaces.APIRoute{
 			Route:         "/current/{stationName}",
 			HandlerMethod: httpMux.getCurrentConditions,
 			HTTPMethod:    "GET",
-			Description:   "Gets the current conditions for a specific station"},
+			Description:   "Gets the current conditions for a specific station, with when each sensor was last updated and whether it is stale; add '?units=metric|imperial|quantity:unit,...' to convert the readings"},
+		Interfaces.APIRoute{
+			Route:         "/stream/current",
+			HandlerMethod: httpMux.streamCurrentConditions,
+			HTTPMethod:    "GET",
+			Description:   "Streams the current conditions of every station as Server-Sent Events; filter with '?stations=a,b&sensors=x,y' and resume with the 'Last-Event-ID' header or '?lastEventID='"},
+		Interfaces.APIRoute{
+			Route:         "/stream/current/{stationName}",
+			HandlerMethod: httpMux.streamCurrentConditions,
+			HTTPMethod:    "GET",
+			Description:   "Streams the current conditions of a station as Server-Sent Events; accepts the same parameters as '/stream/current'"},
+		Interfaces.APIRoute{
+			Route:         "/stream/ws",
+			HandlerMethod: httpMux.streamCurrentConditionsWebSocket,
+			HTTPMethod:    "GET",
+			Description:   "Streams current conditions over a WebSocket; accepts the same parameters as '/stream/current', send {\"Stations\":[...],\"Sensors\":[...]} to change the subscription"},
+		Interfaces.APIRoute{
+			Route:         "/units",
+			HandlerMethod: httpMux.getUnits,
+			HTTPMethod:    "GET",
+			Description:   "Lists the units of measure that readings can be converted between with the '?units=' parameter"},
 	}
 
 	//fmt.Println(apiRoutes)
 
 	httpMux.router.HandleFunc("/", httpMux.showHomePage)
 
-	//Setup the webserver to handle the apiRoutes
-	for _, v := range apiRoutes {
-		httpMux.router.HandleFunc(v.Route, v.HandlerMethod).Methods(v.HTTPMethod)
+	//Setup the webserver to handle the apiRoutes; routes that do not set a scope need ScopeRead to read and ScopeAdmin to make changes
+	for i, v := range apiRoutes {
+		if v.Scope == "" {
+			v.Scope = Interfaces.ScopeAdmin
+			if v.HTTPMethod == "GET" {
+				v.Scope = Interfaces.ScopeRead
+			}
+			apiRoutes[i].Scope = v.Scope
+		}
+		httpMux.router.HandleFunc(v.Route, httpMux.guard.Require(v.Scope, v.HandlerMethod)).Methods(v.HTTPMethod)
 	}
 	/* old routing configuration setup; DELETE this once the new API declaration has been tested.
 
@@ -258,20 +346,23 @@ func (httpMux *HTTPMux) Create(storage Interfaces.Storage) {
 	httpMux.router.PathPrefix("/website/").Handler(s)
 }
 
-// unmarshalToObject parses the http.request's body into the 'obj' variable
-func (httpMux *HTTPMux) unmarshalToObject(webRequest *http.Request, obj interface{}) {
+// unmarshalToObject parses the http.request's body into the 'obj' variable. An ErrValidation error is returned if the body is not valid JSON for 'obj'.
+func (httpMux *HTTPMux) unmarshalToObject(webRequest *http.Request, obj interface{}) error {
 	body, err := ioutil.ReadAll(webRequest.Body)
 	defer webRequest.Body.Close()
 
 	if err != nil {
-		fmt.Println(err)
+		return Interfaces.ValidationError("unable to read the request body: %v", err)
 	}
 
-	errr := json.Unmarshal(body, &obj)
-	if errr != nil {
-		fmt.Println(errr)
+	if err = json.Unmarshal(body, &obj); err != nil {
+		// the sensor readings validate themselves while being decoded
+		if errors.Is(err, Interfaces.ErrValidation) {
+			return err
+		}
+		return Interfaces.ValidationError("the request body is not valid JSON: %v", err)
 	}
-
+	return nil
 }
 
 func (httpMux *HTTPMux) showHomePage(w http.ResponseWriter, r *http.Request) {
@@ -281,183 +372,472 @@ func (httpMux *HTTPMux) showHomePage(w http.ResponseWriter, r *http.Request) {
 }
 
 func writeResponsePrettyfied(webResponseWriter http.ResponseWriter, obj interface{}, indentationString string) {
+	writeResponseWithStatus(webResponseWriter, http.StatusOK, obj, indentationString)
+}
+
+// writeResponseWithStatus marshals 'obj' to JSON and sends it to the client with the http 'statusCode'
+func writeResponseWithStatus(webResponseWriter http.ResponseWriter, statusCode int, obj interface{}, indentationString string) {
 	webResponseWriter.Header().Set("Content-Type", "application/json")
 	objects, _ := json.MarshalIndent(obj, "", indentationString)
+	webResponseWriter.WriteHeader(statusCode)
 	webResponseWriter.Write(objects)
 }
 
+// errorResponse is the JSON body sent to the client when a request fails
+type errorResponse struct {
+	Status int
+	Error  string
+}
+
+// writeErrorResponse sends 'err' back to the client as a JSON error body with the matching http status code
+func writeErrorResponse(webResponseWriter http.ResponseWriter, err error) {
+	statusCode := Interfaces.HTTPStatusCode(err)
+	if statusCode == http.StatusInternalServerError {
+		fmt.Println(err)
+	}
+	writeResponseWithStatus(webResponseWriter, statusCode, errorResponse{Status: statusCode, Error: err.Error()}, "\t")
+}
+
+// writeResult sends 'obj' to the client with 'statusCode' if 'err' is nil, otherwise the error is sent
+func writeResult(webResponseWriter http.ResponseWriter, statusCode int, obj interface{}, err error) {
+	if err != nil {
+		writeErrorResponse(webResponseWriter, err)
+		return
+	}
+	writeResponseWithStatus(webResponseWriter, statusCode, obj, "\t")
+}
+
+// writeDeleteResponse sends the result of a delete operation back to the client:
+// 204 if the item was deleted, otherwise the error is sent (404 if it does not exist and 409 if other items still depend on it)
+func writeDeleteResponse(webResponseWriter http.ResponseWriter, err error) {
+	if err != nil {
+		writeErrorResponse(webResponseWriter, err)
+		return
+	}
+	webResponseWriter.WriteHeader(http.StatusNoContent)
+}
+
+// cascadeRequested returns true if the request has the '?cascade=true' query parameter set
+func cascadeRequested(webRequest *http.Request) bool {
+	cascade, _ := strconv.ParseBool(webRequest.URL.Query().Get("cascade"))
+	return cascade
+}
+
 // these functions route the http requests to Database actions, then marshall the result to JSON and send it back to the client
 
 func (httpMux *HTTPMux) getUnitType(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
-	unitType := httpMux.db.GetUnitType(vars["unitTypeID"])
-	writeResponsePrettyfied(w, unitType, "\t")
+	unitType, err := httpMux.db.GetUnitType(vars["unitTypeID"])
+	writeResult(w, http.StatusOK, unitType, err)
 }
 
 func (httpMux *HTTPMux) getUnitTypes(w http.ResponseWriter, r *http.Request) {
 
-	unitTypes := httpMux.db.GetUnitTypes()
-	writeResponsePrettyfied(w, unitTypes, "\t")
+	unitTypes, err := httpMux.db.GetUnitTypes()
+	writeResult(w, http.StatusOK, unitTypes, err)
 }
 
 func (httpMux *HTTPMux) modifyUnitType(w http.ResponseWriter, r *http.Request) {
 	var unit Interfaces.UnitType
-	httpMux.unmarshalToObject(r, &unit)
-	httpMux.db.AddOrUpdateUnitType(&unit)
+	err := httpMux.unmarshalToObject(r, &unit)
+	if err == nil {
+		err = httpMux.db.AddOrUpdateUnitType(&unit)
+	}
+	writeResult(w, http.StatusOK, unit, err)
+}
+func (httpMux *HTTPMux) deleteUnitType(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	writeDeleteResponse(w, httpMux.db.DeleteUnitType(vars["unitTypeID"]))
 }
-func (httpMux *HTTPMux) deleteUnitType(w http.ResponseWriter, r *http.Request) {}
 func (httpMux *HTTPMux) addUnitType(w http.ResponseWriter, r *http.Request) {
 	var unit Interfaces.UnitType
-	httpMux.unmarshalToObject(r, &unit)
-	httpMux.db.AddOrUpdateUnitType(&unit)
+	err := httpMux.unmarshalToObject(r, &unit)
+	if err == nil {
+		err = httpMux.db.AddOrUpdateUnitType(&unit)
+	}
+	writeResult(w, http.StatusCreated, unit, err)
 }
 
 func (httpMux *HTTPMux) getSensor(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
-	sensor := httpMux.db.GetSensor(vars["sensorID"])
-	writeResponsePrettyfied(w, sensor, "\t")
+	sensor, err := httpMux.db.GetSensor(vars["sensorID"])
+	writeResult(w, http.StatusOK, sensor, err)
 }
 
 func (httpMux *HTTPMux) getSensors(w http.ResponseWriter, r *http.Request) {
-	sensors := httpMux.db.GetSensors()
-	writeResponsePrettyfied(w, sensors, "\t")
+	sensors, err := httpMux.db.GetSensors()
+	writeResult(w, http.StatusOK, sensors, err)
 }
 
 func (httpMux *HTTPMux) modifySensor(w http.ResponseWriter, r *http.Request) {
 	var unit Interfaces.Sensor
-	httpMux.unmarshalToObject(r, &unit)
-	httpMux.db.AddOrUpdateSensor(&unit)
+	err := httpMux.unmarshalToObject(r, &unit)
+	if err == nil {
+		_, err = httpMux.db.AddOrUpdateSensor(&unit)
+	}
+	writeResult(w, http.StatusOK, unit, err)
+}
+func (httpMux *HTTPMux) deleteSensor(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	writeDeleteResponse(w, httpMux.db.DeleteSensor(vars["sensorID"]))
 }
-func (httpMux *HTTPMux) deleteSensor(w http.ResponseWriter, r *http.Request) {}
 func (httpMux *HTTPMux) addSensor(w http.ResponseWriter, r *http.Request) {
 	var unit Interfaces.Sensor
-	httpMux.unmarshalToObject(r, &unit)
-	httpMux.db.AddOrUpdateSensor(&unit)
+	err := httpMux.unmarshalToObject(r, &unit)
+	if err == nil {
+		_, err = httpMux.db.AddOrUpdateSensor(&unit)
+	}
+	writeResult(w, http.StatusCreated, unit, err)
 }
 
 func (httpMux *HTTPMux) getObservedProperty(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
-	observations := httpMux.db.GetObservedProperty(vars["propertyID"])
-	writeResponsePrettyfied(w, observations, "\t")
+	observations, err := httpMux.db.GetObservedProperty(vars["propertyID"])
+	writeResult(w, http.StatusOK, observations, err)
 }
 
 func (httpMux *HTTPMux) getObservedProperties(w http.ResponseWriter, r *http.Request) {
-	observations := httpMux.db.GetObservedProperties()
-	writeResponsePrettyfied(w, observations, "\t")
+	observations, err := httpMux.db.GetObservedProperties()
+	writeResult(w, http.StatusOK, observations, err)
 }
 
 func (httpMux *HTTPMux) modifyObservedProperty(w http.ResponseWriter, r *http.Request) {
 	var unit Interfaces.ObservedProperty
-	httpMux.unmarshalToObject(r, &unit)
-	httpMux.db.AddOrUpdateObservedProperty(&unit)
+	err := httpMux.unmarshalToObject(r, &unit)
+	if err == nil {
+		err = httpMux.db.AddOrUpdateObservedProperty(&unit)
+	}
+	writeResult(w, http.StatusOK, unit, err)
+}
+func (httpMux *HTTPMux) deleteObservedProperty(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	writeDeleteResponse(w, httpMux.db.DeleteObservedProperty(vars["propertyID"]))
 }
-func (httpMux *HTTPMux) deleteObservedProperty(w http.ResponseWriter, r *http.Request) {}
 func (httpMux *HTTPMux) addObservedProperty(w http.ResponseWriter, r *http.Request) {
 	var unit Interfaces.ObservedProperty
-	httpMux.unmarshalToObject(r, &unit)
-	httpMux.db.AddOrUpdateObservedProperty(&unit)
+	err := httpMux.unmarshalToObject(r, &unit)
+	if err == nil {
+		err = httpMux.db.AddOrUpdateObservedProperty(&unit)
+	}
+	writeResult(w, http.StatusCreated, unit, err)
 }
 
 func (httpMux *HTTPMux) getDataStream(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
-	dataStream := httpMux.db.GetDataStream(vars["streamID"])
-	writeResponsePrettyfied(w, dataStream, "\t")
+	dataStream, err := httpMux.db.GetDataStream(vars["streamID"])
+	writeResult(w, http.StatusOK, dataStream, err)
 }
 
 func (httpMux *HTTPMux) getDataStreams(w http.ResponseWriter, r *http.Request) {
-	dataStreams := httpMux.db.GetDataStreams()
-	writeResponsePrettyfied(w, dataStreams, "\t")
+	dataStreams, err := httpMux.db.GetDataStreams()
+	writeResult(w, http.StatusOK, dataStreams, err)
 }
 
 func (httpMux *HTTPMux) modifyDataStream(w http.ResponseWriter, r *http.Request) {
 	var unit Interfaces.DataStream
-	httpMux.unmarshalToObject(r, &unit)
-	httpMux.db.UpdateDataStream(&unit)
+	err := httpMux.unmarshalToObject(r, &unit)
+	if err == nil {
+		err = httpMux.db.UpdateDataStream(&unit)
+	}
+	writeResult(w, http.StatusOK, unit, err)
+}
+func (httpMux *HTTPMux) deleteDataStream(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	err := httpMux.db.DeleteDataStream(vars["streamID"], cascadeRequested(r))
+	if err == nil {
+		httpMux.forgetEnsuredStreams()
+	}
+	writeDeleteResponse(w, err)
 }
-func (httpMux *HTTPMux) deleteDataStream(w http.ResponseWriter, r *http.Request) {}
 func (httpMux *HTTPMux) addDataStream(w http.ResponseWriter, r *http.Request) {
 	var unit Interfaces.DataStream
-	httpMux.unmarshalToObject(r, &unit)
-	httpMux.db.AddDataStream(&unit)
+	err := httpMux.unmarshalToObject(r, &unit)
+	if err == nil {
+		_, err = httpMux.db.AddDataStream(&unit)
+	}
+	writeResult(w, http.StatusCreated, unit, err)
 }
 
 func (httpMux *HTTPMux) getObservation(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
-	observations := httpMux.db.GetObservation(vars["observationID"])
-	writeResponsePrettyfied(w, observations, "\t")
+	converter, err := httpMux.newUnitConverter(r)
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	observation, err := httpMux.db.GetObservation(vars["observationID"])
+	if err == nil && converter != nil {
+		converter.convertObservation(observation)
+	}
+	writeResult(w, http.StatusOK, observation, err)
 }
 
 func (httpMux *HTTPMux) getObservations(w http.ResponseWriter, r *http.Request) {
+	observationParams, err := parseObservationParameters(r)
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+	converter, err := httpMux.newUnitConverter(r)
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	observations, err := httpMux.db.GetObservations(observationParams)
+	if err == nil && observationParams.Limit > 0 && len(*observations) == observationParams.Limit {
+		// there may be more observations, let the client know where to continue from
+		w.Header().Set("X-Next-Cursor", Interfaces.NewObservationCursor((*observations)[len(*observations)-1]))
+	}
+	if err == nil && converter != nil {
+		converter.convertObservations(*observations)
+	}
+	writeResult(w, http.StatusOK, observations, err)
+}
+
+// parseObservationParameters reads the observation filters from the route variables and the query string
+func parseObservationParameters(r *http.Request) (Interfaces.ObservationParameters, error) {
+	var observationParams Interfaces.ObservationParameters
+	var err error
+	query := r.URL.Query()
+
+	sensorID := mux.Vars(r)["sensorID"]
+	if sensorID == "" {
+		sensorID = query.Get("sensor")
+	}
+	if observationParams.SensorID, err = parseOptionalInt("sensor", sensorID); err != nil {
+		return observationParams, err
+	}
+	if observationParams.StationID, err = parseOptionalInt("station", query.Get("station")); err != nil {
+		return observationParams, err
+	}
+	if observationParams.DataStreamID, err = parseOptionalInt("stream", query.Get("stream")); err != nil {
+		return observationParams, err
+	}
+	if observationParams.Limit, err = parseOptionalInt("limit", query.Get("limit")); err != nil {
+		return observationParams, err
+	}
+	if observationParams.StartTime, err = parseOptionalTime("start", query.Get("start")); err != nil {
+		return observationParams, err
+	}
+	if observationParams.EndTime, err = parseOptionalTime("end", query.Get("end")); err != nil {
+		return observationParams, err
+	}
+
+	switch strings.ToLower(query.Get("sort")) {
+	case "", "asc":
+		observationParams.Descending = false
+	case "desc":
+		observationParams.Descending = true
+	default:
+		return observationParams, Interfaces.ValidationError("sort must be 'asc' or 'desc'")
+	}
+
+	if query.Get("numeric") != "" {
+		if observationParams.NumericOnly, err = strconv.ParseBool(query.Get("numeric")); err != nil {
+			return observationParams, Interfaces.ValidationError("numeric '%v' is not true or false", query.Get("numeric"))
+		}
+	}
+
+	observationParams.Cursor = query.Get("cursor")
+	return observationParams, observationParams.Validate()
+}
+
+// parseOptionalInt converts 'value' to an int; an empty value returns 0
+func parseOptionalInt(name string, value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	intval, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, Interfaces.ValidationError("%v '%v' is not a number", name, value)
+	}
+	return intval, nil
+}
+
+// parseOptionalTime converts an RFC3339 'value' to a time; an empty value returns the zero time
+func parseOptionalTime(name string, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	timeValue, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, Interfaces.ValidationError("%v '%v' is not an RFC3339 time", name, value)
+	}
+	return timeValue, nil
+}
+
+func (httpMux *HTTPMux) getAggregatedObservations(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	observationParams := new(Interfaces.ObservationParameters)
+	query := r.URL.Query()
+	var err error
 
-	intval, _ := strconv.ParseInt(vars["sensorID"], 10, 0)
-	observationParams.SensorID = int(intval)
-	observations := httpMux.db.GetObservations(*observationParams)
-	writeResponsePrettyfied(w, observations, "\t")
+	aggregationParams := Interfaces.AggregationParameters{
+		BucketWidth: strings.ToLower(query.Get("bucket")),
+		Function:    strings.ToLower(query.Get("function"))}
+
+	if aggregationParams.DataStreamID, err = parseOptionalInt("streamID", vars["streamID"]); err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+	if aggregationParams.StartTime, err = parseOptionalTime("start", query.Get("start")); err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+	if aggregationParams.EndTime, err = parseOptionalTime("end", query.Get("end")); err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	converter, err := httpMux.newUnitConverter(r)
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	buckets, err := httpMux.db.AggregateObservations(aggregationParams)
+	if err == nil && converter != nil {
+		converter.convertBuckets(aggregationParams.DataStreamID, aggregationParams.Function, *buckets)
+	}
+	writeResult(w, http.StatusOK, buckets, err)
 }
 
 func (httpMux *HTTPMux) modifyObservation(w http.ResponseWriter, r *http.Request) {}
-func (httpMux *HTTPMux) deleteObservation(w http.ResponseWriter, r *http.Request) {}
+func (httpMux *HTTPMux) deleteObservation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	writeDeleteResponse(w, httpMux.db.DeleteObservation(vars["observationID"]))
+}
 func (httpMux *HTTPMux) addObservation(w http.ResponseWriter, r *http.Request) {
 	var unit Interfaces.Observation
-	httpMux.unmarshalToObject(r, &unit)
-	httpMux.db.AddObservation(&unit)
+	err := httpMux.unmarshalToObject(r, &unit)
+	if err == nil {
+		err = httpMux.db.AddObservation(&unit)
+	}
+	writeResult(w, http.StatusCreated, unit, err)
 }
 
 func (httpMux *HTTPMux) getStation(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
-	wxstation := httpMux.db.GetStation(vars["stationID"])
-	writeResponsePrettyfied(w, wxstation, "\t")
+	wxstation, err := httpMux.db.GetStation(vars["stationID"])
+	writeResult(w, http.StatusOK, wxstation, err)
 }
 
 func (httpMux *HTTPMux) getCurrentConditions(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	station := httpMux.db.GetCurrentSensorReadings(vars["stationName"])
-	fmt.Println("Station: " + station.StationName)
-	writeResponsePrettyfied(w, station, "\t")
+	converter, err := httpMux.newUnitConverter(r)
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	station, err := httpMux.db.GetCurrentSensorReadings(vars["stationName"])
+	if err == nil && converter != nil {
+		converter.convertCurrentConditions(&station)
+	}
+	writeResult(w, http.StatusOK, station, err)
+}
+
+func (httpMux *HTTPMux) getAllCurrentConditions(w http.ResponseWriter, r *http.Request) {
+	converter, err := httpMux.newUnitConverter(r)
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	stations, err := httpMux.db.GetAllCurrentSensorReadings()
+	if err == nil && converter != nil {
+		for i := range stations {
+			converter.convertCurrentConditions(&stations[i])
+		}
+	}
+	writeResult(w, http.StatusOK, stations, err)
+}
+
+func (httpMux *HTTPMux) getUnits(w http.ResponseWriter, r *http.Request) {
+	writeResponsePrettyfied(w, Units.Units(), "\t")
 }
 
 func (httpMux *HTTPMux) getStations(w http.ResponseWriter, r *http.Request) {
-	wxstations := httpMux.db.GetStations()
-	writeResponsePrettyfied(w, wxstations, "\t")
+	wxstations, err := httpMux.db.GetStations()
+	writeResult(w, http.StatusOK, wxstations, err)
 }
 
 func (httpMux *HTTPMux) modifyStation(w http.ResponseWriter, r *http.Request) {
 	var unit Interfaces.Station
-	httpMux.unmarshalToObject(r, &unit)
-	httpMux.db.AddOrUpdateStation(&unit)
+	err := httpMux.unmarshalToObject(r, &unit)
+	if err == nil {
+		err = httpMux.db.AddOrUpdateStation(&unit)
+	}
+	writeResult(w, http.StatusOK, unit, err)
+}
+func (httpMux *HTTPMux) deleteStation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	err := httpMux.db.DeleteStation(vars["stationID"], cascadeRequested(r))
+	if err == nil {
+		httpMux.forgetEnsuredStreams()
+	}
+	writeDeleteResponse(w, err)
 }
-func (httpMux *HTTPMux) deleteStation(w http.ResponseWriter, r *http.Request) {}
 func (httpMux *HTTPMux) addStation(w http.ResponseWriter, r *http.Request) {
 	var unit Interfaces.Station
-	httpMux.unmarshalToObject(r, &unit)
-	httpMux.db.AddOrUpdateStation(&unit)
+	err := httpMux.unmarshalToObject(r, &unit)
+	if err == nil {
+		err = httpMux.db.AddOrUpdateStation(&unit)
+	}
+	writeResult(w, http.StatusCreated, unit, err)
 }
 
 func (httpMux *HTTPMux) setCurrentConditions(w http.ResponseWriter, r *http.Request) {
 	// convert the json to an object
 	currentConditions := Interfaces.StationUploadTemplate{}
-	httpMux.unmarshalToObject(r, &currentConditions)
+	err := httpMux.unmarshalToObject(r, &currentConditions)
+	if err == nil {
+		currentConditions.Replace, err = parseUploadMode(r, currentConditions.Replace)
+	}
+	if err == nil {
+		err = Auth.CheckStation(r, Interfaces.ScopeUpload, currentConditions.StationName)
+	}
 
-	fmt.Println("Setting current weather conditions for station: " + currentConditions.StationName)
+	if err == nil {
+		fmt.Println("Setting current weather conditions for station: " + currentConditions.StationName)
 
-	//store the current station in our in-memory listing of current conditions.
-	httpMux.db.SetCurrentSensorReadings(currentConditions)
+		//store the current station in our in-memory listing of current conditions.
+		err = httpMux.db.SetCurrentSensorReadings(currentConditions)
+	}
+	writeResult(w, http.StatusOK, currentConditions, err)
+}
+
+// parseUploadMode reads the 'mode' parameter, which is either "merge" or "replace"; 'replace' is returned unchanged when there is no parameter
+func parseUploadMode(r *http.Request, replace bool) (bool, error) {
+	switch strings.ToLower(r.URL.Query().Get("mode")) {
+	case "":
+		return replace, nil
+	case "merge":
+		return false, nil
+	case "replace":
+		return true, nil
+	}
+	return replace, Interfaces.ValidationError("'mode' must be 'merge' or 'replace', got '%v'", r.URL.Query().Get("mode"))
 }
 
 //logConditions logs the sensor info to the database
 func (httpMux *HTTPMux) logConditions(w http.ResponseWriter, r *http.Request) {
 	// convert the json to an object
 	var currentConditions Interfaces.StationUploadTemplate
-	fmt.Println(r)
-	httpMux.unmarshalToObject(r, &currentConditions)
+	err := httpMux.unmarshalToObject(r, &currentConditions)
+	if err == nil {
+		err = Auth.CheckStation(r, Interfaces.ScopeUpload, currentConditions.StationName)
+	}
 
-	httpMux.db.LogConditions(&currentConditions)
+	if err == nil {
+		err = httpMux.db.LogConditions(&currentConditions)
+	}
+	writeResult(w, http.StatusCreated, currentConditions, err)
 }
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Josiah-B/Cyclone/EventBus"
+	"github.com/Josiah-B/Cyclone/Interfaces"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// streamKeepAlive is how often an idle stream is sent something so proxies and clients do not time it out
+const streamKeepAlive = 30 * time.Second
+
+// streamMessage is a single message sent to a WebSocket client
+type streamMessage struct {
+	// Type is "current" for a new upload, or "snapshot" for the readings a station had when the stream started or its filter changed
+	Type string
+	// ID is the event ID to send back as 'lastEventID' to resume the stream; snapshots do not have one
+	ID uint64 `json:",omitempty"`
+	Interfaces.StationUploadTemplate
+}
+
+// streamRequest is sent by a WebSocket client to change the stations and sensors it receives
+type streamRequest struct {
+	Stations []string
+	Sensors  []string
+}
+
+var websocketUpgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+
+// parseStreamParameters reads the filter and the event to resume after from a stream request.
+// Stations come from the {stationName} route variable and the 'stations' parameter, sensors from the 'sensors' parameter (both comma separated),
+// and the last event from the 'Last-Event-ID' header sent by reconnecting EventSource clients or the 'lastEventID' parameter.
+func parseStreamParameters(r *http.Request) (EventBus.Filter, uint64, error) {
+	query := r.URL.Query()
+	filter := EventBus.ParseFilter(query.Get("stations"), query.Get("sensors"))
+	if stationName := mux.Vars(r)["stationName"]; stationName != "" {
+		filter.Stations = append(filter.Stations, stationName)
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = query.Get("lastEventID")
+	}
+	if lastEventID == "" {
+		return filter, 0, nil
+	}
+	id, err := strconv.ParseUint(lastEventID, 10, 64)
+	if err != nil {
+		return filter, 0, Interfaces.ValidationError("'lastEventID' must be a whole number, got '%v'", lastEventID)
+	}
+	return filter, id, nil
+}
+
+// currentSnapshot returns the current readings of the stations that match the filter
+func (httpMux *HTTPMux) currentSnapshot(filter EventBus.Filter) ([]Interfaces.StationUploadTemplate, error) {
+	var snapshot []Interfaces.StationUploadTemplate
+	if len(filter.Stations) == 0 {
+		all, err := httpMux.db.GetAllCurrentSensorReadings()
+		if err != nil {
+			return nil, err
+		}
+		for _, current := range all {
+			if current, ok := filter.Apply(current); ok {
+				snapshot = append(snapshot, current)
+			}
+		}
+		return snapshot, nil
+	}
+
+	for _, stationName := range filter.Stations {
+		current, err := httpMux.db.GetCurrentSensorReadings(stationName)
+		if errors.Is(err, Interfaces.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if current, ok := filter.Apply(current); ok {
+			snapshot = append(snapshot, current)
+		}
+	}
+	return snapshot, nil
+}
+
+// streamCurrentConditions sends each station's current readings as Server-Sent Events as they are uploaded.
+// A new stream starts with a "snapshot" event for each station, followed by a "current" event for every upload.
+func (httpMux *HTTPMux) streamCurrentConditions(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeErrorResponse(w, errors.New("streaming is not supported by this connection"))
+		return
+	}
+	filter, lastEventID, err := parseStreamParameters(r)
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+	converter, err := httpMux.newUnitConverter(r)
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	sub, complete := httpMux.events.Subscribe(filter, lastEventID)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	// clients that are new, or that were gone long enough to miss events, start from the current readings
+	if lastEventID == 0 || !complete {
+		snapshot, err := httpMux.currentSnapshot(filter)
+		if err != nil {
+			fmt.Println("Unable to send the current conditions snapshot: ", err)
+		}
+		for _, current := range snapshot {
+			writeServerSentEvent(w, "snapshot", 0, current, converter)
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event, ok := <-sub.Events:
+			if !ok {
+				return
+			}
+			writeServerSentEvent(w, "current", event.ID, event.StationUploadTemplate, converter)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// writeServerSentEvent writes the readings as a single event; an 'id' of 0 leaves the event without an ID
+func writeServerSentEvent(w http.ResponseWriter, eventType string, id uint64, current Interfaces.StationUploadTemplate, converter *unitConverter) {
+	if converter != nil {
+		converter.convertCurrentConditions(&current)
+	}
+	data, err := json.Marshal(current)
+	if err != nil {
+		fmt.Println("Unable to write the event: ", err)
+		return
+	}
+
+	if id != 0 {
+		fmt.Fprintf(w, "id: %v\n", id)
+	}
+	fmt.Fprintf(w, "event: %v\ndata: %s\n\n", eventType, data)
+}
+
+// streamCurrentConditionsWebSocket sends each station's current readings over a WebSocket as they are uploaded.
+// The client can send a streamRequest at any time to change the stations and sensors it receives.
+func (httpMux *HTTPMux) streamCurrentConditionsWebSocket(w http.ResponseWriter, r *http.Request) {
+	filter, lastEventID, err := parseStreamParameters(r)
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+	converter, err := httpMux.newUnitConverter(r)
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	conn, err := websocketUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has already sent the client an error
+		return
+	}
+	defer conn.Close()
+
+	sub, complete := httpMux.events.Subscribe(filter, lastEventID)
+	defer sub.Close()
+
+	// read the client's requests on their own goroutine, the connection only allows one reader and one writer
+	requests := make(chan streamRequest)
+	closed := make(chan struct{})
+	conn.SetReadDeadline(time.Now().Add(2 * streamKeepAlive))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * streamKeepAlive))
+	})
+	go func() {
+		defer close(closed)
+		for {
+			var request streamRequest
+			if err := conn.ReadJSON(&request); err != nil {
+				return
+			}
+			select {
+			case requests <- request:
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}()
+
+	if lastEventID == 0 || !complete {
+		if err = httpMux.writeSnapshotMessages(conn, filter, converter); err != nil {
+			return
+		}
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event, ok := <-sub.Events:
+			if !ok {
+				return
+			}
+			if converter != nil {
+				converter.convertCurrentConditions(&event.StationUploadTemplate)
+			}
+			err = conn.WriteJSON(streamMessage{Type: "current", ID: event.ID, StationUploadTemplate: event.StationUploadTemplate})
+		case request := <-requests:
+			filter = EventBus.Filter{Stations: request.Stations, Sensors: request.Sensors}
+			sub.SetFilter(filter)
+			err = httpMux.writeSnapshotMessages(conn, filter, converter)
+		case <-keepAlive.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamKeepAlive))
+		case <-closed:
+			return
+		case <-r.Context().Done():
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// writeSnapshotMessages sends the current readings of every station matching the filter
+func (httpMux *HTTPMux) writeSnapshotMessages(conn *websocket.Conn, filter EventBus.Filter, converter *unitConverter) error {
+	snapshot, err := httpMux.currentSnapshot(filter)
+	if err != nil {
+		fmt.Println("Unable to send the current conditions snapshot: ", err)
+	}
+	for _, current := range snapshot {
+		if converter != nil {
+			converter.convertCurrentConditions(&current)
+		}
+		if err = conn.WriteJSON(streamMessage{Type: "snapshot", StationUploadTemplate: current}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
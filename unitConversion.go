@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Josiah-B/Cyclone/Interfaces"
+	"github.com/Josiah-B/Cyclone/Units"
+)
+
+// unitConverter converts the readings sent to a client into the units it asked for with the '?units=' query parameter
+type unitConverter struct {
+	db          Interfaces.Storage
+	preferences Units.Preferences
+	// streamUnits caches the unit of measure of each data stream that has been looked up
+	streamUnits map[int]string
+}
+
+// newUnitConverter creates a converter for the request's '?units=' parameter. nil is returned if the parameter is not set.
+func (httpMux *HTTPMux) newUnitConverter(r *http.Request) (*unitConverter, error) {
+	value := r.URL.Query().Get("units")
+	if value == "" {
+		return nil, nil
+	}
+
+	preferences, err := Units.ParsePreferences(value)
+	if err != nil {
+		return nil, err
+	}
+	return &unitConverter{db: httpMux.db, preferences: preferences, streamUnits: make(map[int]string)}, nil
+}
+
+// streamUnit returns the unit of measure of the data stream, or an empty string if the stream has no unit type
+func (converter *unitConverter) streamUnit(streamID int) string {
+	if unit, ok := converter.streamUnits[streamID]; ok {
+		return unit
+	}
+
+	var unit string
+	if dataStream, err := converter.db.GetDataStream(strconv.Itoa(streamID)); err == nil && dataStream.UnitTypeID != 0 {
+		if unitType, err := converter.db.GetUnitType(strconv.Itoa(dataStream.UnitTypeID)); err == nil {
+			unit = unitType.UnitOfMeasure
+		}
+	}
+	converter.streamUnits[streamID] = unit
+	return unit
+}
+
+// convertObservations converts each numeric observation into the preferred unit
+func (converter *unitConverter) convertObservations(observations []Interfaces.Observation) {
+	for index := range observations {
+		converter.convertObservation(&observations[index])
+	}
+}
+
+// convertObservation converts a numeric observation into the preferred unit
+func (converter *unitConverter) convertObservation(observation *Interfaces.Observation) {
+	if observation.Value == nil {
+		return
+	}
+
+	value, unit := converter.preferences.ConvertValue(*observation.Value, converter.streamUnit(observation.DataStreamID))
+	observation.Value = &value
+	observation.Unit = unit
+}
+
+// convertBuckets converts the aggregated values of a data stream into the preferred unit; counts are left alone, and sums are converted as totals
+func (converter *unitConverter) convertBuckets(streamID int, function string, buckets []Interfaces.AggregateBucket) {
+	if function == Interfaces.AggregateCount {
+		return
+	}
+
+	fromUnit := converter.streamUnit(streamID)
+	for index := range buckets {
+		if function == Interfaces.AggregateSum {
+			buckets[index].Value, buckets[index].Unit = converter.preferences.ConvertDifference(buckets[index].Value, fromUnit)
+		} else {
+			buckets[index].Value, buckets[index].Unit = converter.preferences.ConvertValue(buckets[index].Value, fromUnit)
+		}
+	}
+}
+
+// convertCurrentConditions converts the station's current readings into the preferred units. Readings uploaded with a unit use that unit,
+// otherwise the unit of the sensor's data stream is used.
+func (converter *unitConverter) convertCurrentConditions(currentConditions *Interfaces.StationUploadTemplate) {
+	stn, _ := converter.db.GetStationByName(currentConditions.StationName)
+
+	converted := make(map[string]Interfaces.SensorReading, len(currentConditions.SensorReadings))
+	for sensorName, reading := range currentConditions.SensorReadings {
+		if reading.Value != nil {
+			fromUnit := reading.Unit
+			if fromUnit == "" && stn != nil {
+				if dataStream, err := converter.db.GetDataStreamBySensorName(sensorName, int64(stn.StationID)); err == nil {
+					fromUnit = converter.streamUnit(dataStream.StreamID)
+				}
+			}
+
+			value, unit := converter.preferences.ConvertValue(*reading.Value, fromUnit)
+			reading.Value = &value
+			reading.Unit = unit
+		}
+		converted[sensorName] = reading
+	}
+	currentConditions.SensorReadings = converted
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Josiah-B/Cyclone/Auth"
+	"github.com/Josiah-B/Cyclone/Interfaces"
+)
+
+// wuMissingValue is sent by some stations in place of a reading they do not have
+const wuMissingValue = "-9999"
+
+// wuField maps a Weather Underground upload parameter onto a sensor reading
+type wuField struct {
+	SensorName string
+	Unit       string
+}
+
+// wuFields lists the Weather Underground upload parameters that are turned into sensor readings; parameter names are matched ignoring case.
+// Sensor names match the ObservedProperty names used by the derivers so dew point, heat index, etc. are computed for these stations too.
+var wuFields = map[string]wuField{
+	"tempf":            wuField{SensorName: "Temperature", Unit: "F"},
+	"humidity":         wuField{SensorName: "Humidity", Unit: "%"},
+	"dewptf":           wuField{SensorName: "DewPoint", Unit: "F"},
+	"windchillf":       wuField{SensorName: "WindChill", Unit: "F"},
+	"winddir":          wuField{SensorName: "WindDirection", Unit: "deg"},
+	"windspeedmph":     wuField{SensorName: "WindSpeed", Unit: "mph"},
+	"windgustmph":      wuField{SensorName: "WindGust", Unit: "mph"},
+	"windgustdir":      wuField{SensorName: "WindGustDirection", Unit: "deg"},
+	"windspdmph_avg2m": wuField{SensorName: "WindSpeedAvg2m", Unit: "mph"},
+	"winddir_avg2m":    wuField{SensorName: "WindDirectionAvg2m", Unit: "deg"},
+	"windgustmph_10m":  wuField{SensorName: "WindGust10m", Unit: "mph"},
+	"windgustdir_10m":  wuField{SensorName: "WindGustDirection10m", Unit: "deg"},
+	"rainin":           wuField{SensorName: "RainLastHour", Unit: "in"},
+	"dailyrainin":      wuField{SensorName: "DailyRain", Unit: "in"},
+	"weeklyrainin":     wuField{SensorName: "WeeklyRain", Unit: "in"},
+	"monthlyrainin":    wuField{SensorName: "MonthlyRain", Unit: "in"},
+	"yearlyrainin":     wuField{SensorName: "YearlyRain", Unit: "in"},
+	"baromin":          wuField{SensorName: "Barometer", Unit: "inHg"},
+	"solarradiation":   wuField{SensorName: "SolarRadiation", Unit: "W/m2"},
+	"uv":               wuField{SensorName: "UV", Unit: "index"},
+	"visibility":       wuField{SensorName: "Visibility", Unit: "mi"},
+	"indoortempf":      wuField{SensorName: "IndoorTemperature", Unit: "F"},
+	"indoorhumidity":   wuField{SensorName: "IndoorHumidity", Unit: "%"},
+	"soiltempf":        wuField{SensorName: "SoilTemperature", Unit: "F"},
+	"soilmoisture":     wuField{SensorName: "SoilMoisture", Unit: "%"},
+	"leafwetness":      wuField{SensorName: "LeafWetness", Unit: "%"},
+	"aqpm2.5":          wuField{SensorName: "PM2.5", Unit: "ug/m3"},
+	"aqpm10":           wuField{SensorName: "PM10", Unit: "ug/m3"},
+}
+
+// wuTimeFormat is the layout of the 'dateutc' parameter
+const wuTimeFormat = "2006-01-02 15:04:05"
+
+// parseWUUpload converts the query string of a Weather Underground upload into a StationUploadTemplate.
+// Parameters that are not known, or that hold the missing value, are ignored.
+func parseWUUpload(query url.Values) (Interfaces.StationUploadTemplate, error) {
+	upload := Interfaces.StationUploadTemplate{
+		StationName:    getQueryValue(query, "ID"),
+		SensorReadings: make(map[string]Interfaces.SensorReading)}
+
+	timeStamp, err := parseUploadTime(getQueryValue(query, "dateutc"))
+	if err != nil {
+		return upload, err
+	}
+	upload.TimeStamp = timeStamp
+
+	for key, values := range query {
+		field, ok := wuFields[strings.ToLower(key)]
+		if !ok || len(values) == 0 || values[0] == "" || values[0] == wuMissingValue {
+			continue
+		}
+
+		reading, err := Interfaces.ParseSensorReading(values[0])
+		if err != nil {
+			return upload, fmt.Errorf("%v: %w", key, err)
+		}
+		if reading.IsNumeric() {
+			reading.Unit = field.Unit
+		}
+		upload.SensorReadings[field.SensorName] = reading
+	}
+
+	return upload, upload.Validate()
+}
+
+// parseUploadTime reads the 'dateutc' parameter of an upload; an empty value or "now" is the current time
+func parseUploadTime(dateUTC string) (time.Time, error) {
+	if dateUTC == "" || strings.EqualFold(dateUTC, "now") {
+		return time.Now().UTC(), nil
+	}
+	timeStamp, err := time.ParseInLocation(wuTimeFormat, dateUTC, time.UTC)
+	if err != nil {
+		return timeStamp, Interfaces.ValidationError("dateutc '%v' is not a valid time", dateUTC)
+	}
+	return timeStamp, nil
+}
+
+// getQueryValue returns the first value of the query parameter 'key', matching the key ignoring case
+func getQueryValue(query url.Values, key string) string {
+	if value := query.Get(key); value != "" {
+		return value
+	}
+	for k, values := range query {
+		if strings.EqualFold(k, key) && len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// authenticateWUStation checks that 'password' is the station's upload password, or an API key that can upload for the station
+func (httpMux *HTTPMux) authenticateWUStation(stationName string, password string) error {
+	_, err := httpMux.db.AuthenticateStation(stationName, password)
+	if !errors.Is(err, Interfaces.ErrUnauthorized) {
+		return err
+	}
+	if _, _, isKey := Auth.ParseKey(password); !isKey {
+		return err
+	}
+
+	token, err := httpMux.db.AuthenticateToken(password)
+	if err == nil && !token.Allows(Interfaces.ScopeUpload, stationName) {
+		err = fmt.Errorf("%w: the API key can not upload for station '%v'", Interfaces.ErrUnauthorized, stationName)
+	}
+	return err
+}
+
+// wuUpload handles uploads sent with the Weather Underground PWS protocol ('updateweatherstation.php').
+// The ID parameter is the station name and PASSWORD must match the station's upload password.
+// Responses are plain text because that is what station firmware expects.
+func (httpMux *HTTPMux) wuUpload(w http.ResponseWriter, r *http.Request) {
+	// accept the parameters from either the query string or a form encoded body
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "ERROR: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	upload, err := parseWUUpload(r.Form)
+	if err == nil {
+		err = httpMux.authenticateWUStation(upload.StationName, getQueryValue(r.Form, "PASSWORD"))
+	}
+	if err == nil {
+		fmt.Println("Setting current weather conditions for Weather Underground station: " + upload.StationName)
+		err = httpMux.db.SetCurrentSensorReadings(upload)
+	}
+
+	switch {
+	case err == nil:
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("success\n"))
+	case errors.Is(err, Interfaces.ErrUnauthorized):
+		http.Error(w, "INVALIDPASSWORDID|Password or key and/or id are incorrect", http.StatusUnauthorized)
+	default:
+		http.Error(w, "ERROR: "+err.Error(), Interfaces.HTTPStatusCode(err))
+	}
+}
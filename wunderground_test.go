@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Josiah-B/Cyclone/EventBus"
+	"github.com/Josiah-B/Cyclone/Interfaces"
+)
+
+// uploadStorage is the part of the storage used by the upload handlers; calling anything else panics
+type uploadStorage struct {
+	Interfaces.Storage
+	station  *Interfaces.Station
+	password string
+	streams  []string
+	uploads  []Interfaces.StationUploadTemplate
+	// tokens are the API tokens by key
+	tokens map[string]*Interfaces.APIToken
+}
+
+func (storage *uploadStorage) AuthenticateStation(stationName string, password string) (*Interfaces.Station, error) {
+	if stationName != storage.station.Name || password != storage.password {
+		return nil, fmt.Errorf("%w: the password for station '%v' is not correct", Interfaces.ErrUnauthorized, stationName)
+	}
+	return storage.station, nil
+}
+
+func (storage *uploadStorage) AuthenticateToken(key string) (*Interfaces.APIToken, error) {
+	token, ok := storage.tokens[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown API key", Interfaces.ErrUnauthorized)
+	}
+	return token, nil
+}
+
+func (storage *uploadStorage) SetCurrentSensorReadings(currentSensorReadings Interfaces.StationUploadTemplate) error {
+	storage.uploads = append(storage.uploads, currentSensorReadings)
+	return nil
+}
+
+func newUploadMux(storage *uploadStorage) *HTTPMux {
+	var httpMux HTTPMux
+	httpMux.Create(storage, EventBus.NewBus(10), false)
+	return &httpMux
+}
+
+func TestParseWUUpload(t *testing.T) {
+	query := url.Values{
+		"ID":           {"KXYZ1"},
+		"PASSWORD":     {"secret"},
+		"dateutc":      {"2024-05-01 12:34:56"},
+		"TempF":        {"60.1"},
+		"humidity":     {"55"},
+		"winddir":      {"180"},
+		"baromin":      {"29.92"},
+		"rainin":       {wuMissingValue},
+		"softwaretype": {"WeatherLink"},
+		"action":       {"updateraw"}}
+
+	upload, err := parseWUUpload(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upload.StationName != "KXYZ1" {
+		t.Errorf("got StationName '%v', want 'KXYZ1'", upload.StationName)
+	}
+	if want := time.Date(2024, 5, 1, 12, 34, 56, 0, time.UTC); !upload.TimeStamp.Equal(want) {
+		t.Errorf("got TimeStamp %v, want %v", upload.TimeStamp, want)
+	}
+	want := map[string]Interfaces.SensorReading{
+		"Temperature":   {Value: floatPointer(60.1), Unit: "F"},
+		"Humidity":      {Value: floatPointer(55), Unit: "%"},
+		"WindDirection": {Value: floatPointer(180), Unit: "deg"},
+		"Barometer":     {Value: floatPointer(29.92), Unit: "inHg"}}
+	if len(upload.SensorReadings) != len(want) {
+		t.Errorf("got readings %v, want %v", upload.SensorReadings, want)
+	}
+	for sensorName, wantReading := range want {
+		reading, ok := upload.SensorReadings[sensorName]
+		if !ok || reading.Value == nil || *reading.Value != *wantReading.Value || reading.Unit != wantReading.Unit {
+			t.Errorf("got %v = %+v, want %v %v", sensorName, reading, *wantReading.Value, wantReading.Unit)
+		}
+	}
+}
+
+func TestParseWUUploadTime(t *testing.T) {
+	for _, dateUTC := range []string{"", "now", "NOW"} {
+		upload, err := parseWUUpload(url.Values{"ID": {"KXYZ1"}, "dateutc": {dateUTC}, "tempf": {"50"}})
+		if err != nil {
+			t.Fatalf("dateutc '%v': %v", dateUTC, err)
+		}
+		if time.Since(upload.TimeStamp) > time.Minute {
+			t.Errorf("dateutc '%v': got TimeStamp %v, want the current time", dateUTC, upload.TimeStamp)
+		}
+	}
+}
+
+func TestParseWUUploadInvalid(t *testing.T) {
+	tests := map[string]url.Values{
+		"bad time":   {"ID": {"KXYZ1"}, "dateutc": {"yesterday"}, "tempf": {"50"}},
+		"no station": {"dateutc": {"now"}, "tempf": {"50"}},
+		"not finite": {"ID": {"KXYZ1"}, "dateutc": {"now"}, "tempf": {"NaN"}}}
+	for name, query := range tests {
+		if _, err := parseWUUpload(query); !errors.Is(err, Interfaces.ErrValidation) {
+			t.Errorf("%v: got error %v, want %v", name, err, Interfaces.ErrValidation)
+		}
+	}
+}
+
+func TestWUUpload(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		status   int
+		response string
+		stored   int
+	}{
+		{"valid", "ID=KXYZ1&PASSWORD=secret&dateutc=now&tempf=60.1", http.StatusOK, "success\n", 1},
+		{"wrong password", "ID=KXYZ1&PASSWORD=guess&dateutc=now&tempf=60.1", http.StatusUnauthorized, "INVALIDPASSWORDID", 0},
+		{"unknown station", "ID=KABC9&PASSWORD=secret&dateutc=now&tempf=60.1", http.StatusUnauthorized, "INVALIDPASSWORDID", 0},
+		{"bad time", "ID=KXYZ1&PASSWORD=secret&dateutc=yesterday&tempf=60.1", http.StatusBadRequest, "ERROR", 0},
+	}
+	for _, test := range tests {
+		storage := &uploadStorage{station: &Interfaces.Station{StationID: 1, Name: "KXYZ1"}, password: "secret"}
+		httpMux := newUploadMux(storage)
+
+		response := httptest.NewRecorder()
+		httpMux.router.ServeHTTP(response, httptest.NewRequest("GET", "/weatherstation/updateweatherstation.php?"+test.query, nil))
+
+		if response.Code != test.status || !strings.HasPrefix(response.Body.String(), test.response) {
+			t.Errorf("%v: got %v '%v', want %v '%v'", test.name, response.Code, response.Body.String(), test.status, test.response)
+		}
+		if len(storage.uploads) != test.stored {
+			t.Errorf("%v: got %v uploads stored, want %v", test.name, len(storage.uploads), test.stored)
+		}
+	}
+}
+
+func TestWUUploadForm(t *testing.T) {
+	storage := &uploadStorage{station: &Interfaces.Station{StationID: 1, Name: "KXYZ1"}, password: "secret"}
+	httpMux := newUploadMux(storage)
+
+	request := httptest.NewRequest("POST", "/weatherstation/updateweatherstation.php", strings.NewReader("ID=KXYZ1&PASSWORD=secret&dateutc=now&tempf=60.1"))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response := httptest.NewRecorder()
+	httpMux.router.ServeHTTP(response, request)
+
+	if response.Code != http.StatusOK || len(storage.uploads) != 1 {
+		t.Fatalf("got status %v with %v uploads: %v", response.Code, len(storage.uploads), response.Body.String())
+	}
+}
+
+func TestAuthenticateWUStation(t *testing.T) {
+	storage := &uploadStorage{
+		station:  &Interfaces.Station{StationID: 1, Name: "KXYZ1"},
+		password: "secret",
+		tokens: map[string]*Interfaces.APIToken{
+			"cyc_1_upload": {TokenID: 1, Scopes: []string{Interfaces.ScopeUpload}, StationName: "KXYZ1"},
+			"cyc_2_other":  {TokenID: 2, Scopes: []string{Interfaces.ScopeUpload}, StationName: "KABC9"},
+			"cyc_3_read":   {TokenID: 3, Scopes: []string{Interfaces.ScopeRead}},
+			"cyc_4_admin":  {TokenID: 4, Scopes: []string{Interfaces.ScopeAdmin}}}}
+	httpMux := newUploadMux(storage)
+
+	tests := []struct {
+		password string
+		allowed  bool
+	}{
+		{"secret", true},
+		{"guess", false},
+		{"cyc_1_upload", true},
+		{"cyc_2_other", false},
+		{"cyc_3_read", false},
+		{"cyc_4_admin", true},
+		{"cyc_5_unknown", false},
+	}
+	for _, test := range tests {
+		err := httpMux.authenticateWUStation("KXYZ1", test.password)
+		if test.allowed && err != nil {
+			t.Errorf("'%v' was not accepted: %v", test.password, err)
+		}
+		if !test.allowed && !errors.Is(err, Interfaces.ErrUnauthorized) {
+			t.Errorf("'%v': got error %v, want %v", test.password, err, Interfaces.ErrUnauthorized)
+		}
+	}
+}
+
+func floatPointer(value float64) *float64 {
+	return &value
+}